@@ -0,0 +1,67 @@
+// Package auth decides what a user is allowed to do.
+package auth
+
+import "errors"
+
+// Role is stored in users.role.
+type Role string
+
+const (
+	Guest     Role = "" // not logged in
+	Banned    Role = "banned"
+	Member    Role = "member"
+	Moderator Role = "moderator"
+	Admin     Role = "admin"
+	// Unverified is the role of users who have not verified their email
+	// address yet, while the verification policy keeps them from writing.
+	// It is never stored.
+	Unverified Role = "unverified"
+)
+
+// Permission names one kind of action a route or handler guards.
+type Permission string
+
+const (
+	CreatePost    Permission = "create-post"
+	CreateComment Permission = "create-comment"
+	React         Permission = "react"
+	Report        Permission = "report"
+	// EditOwnContent lets users edit and delete their own posts and comments.
+	EditOwnContent Permission = "edit-own-content"
+	// EditAnyContent lets users edit and delete anybody's posts and comments.
+	EditAnyContent Permission = "edit-any-content"
+	// ModerateContent lets users work through the reports queue.
+	ModerateContent  Permission = "moderate-content"
+	ManageCategories Permission = "manage-categories"
+	ManageUsers      Permission = "manage-users"
+)
+
+var ErrInvalidRole = errors.New("role must be one of member, moderator, admin or banned")
+
+var member = []Permission{CreatePost, CreateComment, React, Report, EditOwnContent}
+
+var permissions = map[Role][]Permission{
+	Member:    member,
+	Moderator: append(append([]Permission{}, member...), EditAnyContent, ModerateContent),
+	Admin:     append(append([]Permission{}, member...), EditAnyContent, ModerateContent, ManageCategories, ManageUsers),
+}
+
+// Can reports whether a user with the role holds the permission. Guests,
+// banned and unverified users hold none.
+func (r Role) Can(permission Permission) bool {
+	for _, p := range permissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRole checks that s names a role a user can be given.
+func ParseRole(s string) (Role, error) {
+	switch role := Role(s); role {
+	case Member, Moderator, Admin, Banned:
+		return role, nil
+	}
+	return "", ErrInvalidRole
+}
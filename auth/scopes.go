@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+)
+
+// Scope limits what an API token may do on its owner's behalf. A token never
+// holds a permission its owner's role lacks.
+type Scope string
+
+const (
+	// ScopeRead lets a token read as its owner, e.g. the owner's liked posts.
+	ScopeRead Scope = "read"
+	// ScopeWrite lets a token post, comment, react and report.
+	ScopeWrite Scope = "write"
+	// ScopeModerate lets a token work through the reports queue and edit
+	// anybody's content.
+	ScopeModerate Scope = "moderate"
+)
+
+// AllScopes lists the scopes in the order they are offered.
+var AllScopes = []Scope{ScopeRead, ScopeWrite, ScopeModerate}
+
+var ErrInvalidScope = errors.New("scopes must be some of read, write and moderate")
+
+// Managing categories and users is left to the website.
+var scopePermissions = map[Scope][]Permission{
+	ScopeWrite:    {CreatePost, CreateComment, React, Report, EditOwnContent},
+	ScopeModerate: {EditAnyContent, ModerateContent},
+}
+
+// Scopes is the set of scopes granted to a token.
+type Scopes []Scope
+
+// Has reports whether the scope was granted.
+func (s Scopes) Has(scope Scope) bool {
+	for _, granted := range s {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow reports whether one of the scopes covers the permission.
+func (s Scopes) Allow(permission Permission) bool {
+	for _, scope := range s {
+		for _, p := range scopePermissions[scope] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseScopes checks a list of scope names, dropping duplicates. At least
+// one scope is required.
+func ParseScopes(names []string) (Scopes, error) {
+	var scopes Scopes
+	for _, name := range names {
+		scope := Scope(strings.TrimSpace(name))
+		switch scope {
+		case ScopeRead, ScopeWrite, ScopeModerate:
+		default:
+			return nil, ErrInvalidScope
+		}
+		if !scopes.Has(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	return scopes, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/auth"
+	"forum/database"
+	"forum/database/migrations"
+	"forum/events"
+	"forum/helpers"
+	"forum/mail"
+	"forum/ranking"
+	"forum/routes"
+	"forum/sessions"
+	"forum/store"
+	"os"
+)
+
+const usage = `usage:
+  forum                         start the web server (applies pending migrations)
+  forum migrate up              apply every pending migration
+  forum migrate down            roll back the most recent migration
+  forum migrate status          list migrations and whether they are applied
+  forum seed                    fill the database with demo data
+  forum recount                 rebuild the stored like, dislike and comment counts
+  forum role <username> <role>  make a user a member, moderator or admin, or ban them
+  forum openapi                 print the OpenAPI document served at /openapi.json
+  forum reactions               list the reaction types
+  forum reactions add <name> <emoji>
+                                offer a new reaction type
+  forum reactions enable <name>
+  forum reactions disable <name>
+                                offer or stop offering a reaction type`
+
+func runCommand(db *sql.DB, dialect database.Dialect, args []string) error {
+	switch args[0] {
+	case "migrate":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		return migrate(db, dialect, args[1])
+	case "seed":
+		if err := database.Migrate(db, dialect); err != nil {
+			return err
+		}
+		if err := database.Seed(db); err != nil {
+			return fmt.Errorf("seeding database: %w", err)
+		}
+		// The demo data inserts its likes and comments without counting them
+		if _, _, err := store.NewSQL(db, dialect).Recount(); err != nil {
+			return fmt.Errorf("counting demo data: %w", err)
+		}
+		fmt.Println("Database seeded")
+		return nil
+	case "recount":
+		if len(args) != 1 {
+			return errors.New(usage)
+		}
+		return recount(db, dialect)
+	case "role":
+		if len(args) != 3 {
+			return errors.New(usage)
+		}
+		return setRole(db, dialect, args[1], args[2])
+	case "reactions":
+		return reactions(db, dialect, args[1:])
+	case "openapi":
+		if len(args) != 1 {
+			return errors.New(usage)
+		}
+		return printOpenAPI(db, dialect)
+	default:
+		return errors.New(usage)
+	}
+}
+
+func migrate(db *sql.DB, dialect database.Dialect, direction string) error {
+	migrator, err := migrations.New(db, string(dialect))
+	if err != nil {
+		return err
+	}
+
+	switch direction {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+	case "down":
+		migration, err := migrator.Down()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back %04d_%s\n", migration.Version, migration.Name)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt
+			}
+			fmt.Printf("%04d_%-30s %s\n", status.Version, status.Name, state)
+		}
+	default:
+		return errors.New(usage)
+	}
+	return nil
+}
+
+func setRole(db *sql.DB, dialect database.Dialect, username, role string) error {
+	parsed, err := auth.ParseRole(role)
+	if err != nil {
+		return err
+	}
+	if err := database.Migrate(db, dialect); err != nil {
+		return err
+	}
+	err = store.NewSQL(db, dialect).SetUserRole(username, string(parsed))
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("no user named %q", username)
+	} else if err != nil {
+		return err
+	}
+	fmt.Printf("%s is now %s\n", username, parsed)
+	return nil
+}
+
+func recount(db *sql.DB, dialect database.Dialect) error {
+	if err := database.Migrate(db, dialect); err != nil {
+		return err
+	}
+	posts, comments, err := store.NewSQL(db, dialect).Recount()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Fixed the counts of %d posts and %d comments\n", posts, comments)
+	return nil
+}
+
+func reactions(db *sql.DB, dialect database.Dialect, args []string) error {
+	if err := database.Migrate(db, dialect); err != nil {
+		return err
+	}
+	st := store.NewSQL(db, dialect)
+
+	switch {
+	case len(args) == 0:
+		types, err := st.GetReactionTypes()
+		if err != nil {
+			return err
+		}
+		for _, t := range types {
+			state := "enabled"
+			if !t.Enabled {
+				state = "disabled"
+			}
+			fmt.Printf("%-3d %s %-12s %s\n", t.Type, t.Emoji, t.Name, state)
+		}
+		return nil
+	case len(args) == 3 && args[0] == "add":
+		name, emoji := args[1], args[2]
+		if name == "" || store.Slugify(name) != name {
+			return errors.New("reaction names are lowercase letters, digits and dashes")
+		}
+		reactionType, err := st.AddReactionType(name, emoji)
+		if errors.Is(err, store.ErrDuplicate) {
+			return fmt.Errorf("there already is a reaction named %q", name)
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("Added %s %s as type %d\n", emoji, name, reactionType)
+		return nil
+	case len(args) == 2 && (args[0] == "enable" || args[0] == "disable"):
+		err := st.SetReactionTypeEnabled(args[1], args[0] == "enable")
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("no reaction named %q", args[1])
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("%s is now %sd\n", args[1], args[0])
+		return nil
+	default:
+		return errors.New(usage)
+	}
+}
+
+// printOpenAPI registers the routes as the server does, which also checks
+// that every one of them is described, and prints their document.
+func printOpenAPI(db *sql.DB, dialect database.Dialect) error {
+	st := store.NewSQL(db, dialect)
+	reg := routes.NewRegistry()
+	err := registerRoutes(reg, st, ranking.NewCache(st, ranking.Hot), events.NewBus(), sessions.NewManager(st),
+		&helpers.Mail{Mailer: mail.Log{}}, &helpers.Settings{})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(reg.OpenAPI(apiInfo))
+}
@@ -0,0 +1,7 @@
+//go:build sqlite_fts5
+
+package database
+
+// builtWithFTS5 reports whether the tests were built with the sqlite_fts5
+// tag, which compiles FTS5 into SQLite.
+const builtWithFTS5 = true
@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS categories (
+	category_ID SERIAL PRIMARY KEY ,
+	category TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS users (
+	user_ID SERIAL PRIMARY KEY ,
+	email TEXT DEFAULT NULL ,
+	username TEXT NOT NULL UNIQUE ,
+	password TEXT DEFAULT NULL ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS posts (
+	post_ID SERIAL PRIMARY KEY ,
+	user_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	title TEXT NOT NULL ,
+	content TEXT NOT NULL ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS comments (
+	comment_ID SERIAL PRIMARY KEY ,
+	post_ID INTEGER NOT NULL REFERENCES posts(post_ID) ,
+	user_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	content TEXT NOT NULL ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS sessions (
+	session_ID SERIAL PRIMARY KEY ,
+	token TEXT NOT NULL ,
+	user_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ,
+	expires_at BIGINT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS likes (
+	like_ID SERIAL PRIMARY KEY ,
+	post_ID INTEGER REFERENCES posts(post_ID) ,
+	comment_ID INTEGER REFERENCES comments(comment_ID) ,
+	user_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	type INTEGER NOT NULL ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS post_categories (
+	post_ID INTEGER NOT NULL REFERENCES posts(post_ID) ,
+	category_ID INTEGER NOT NULL REFERENCES categories(category_ID)
+);
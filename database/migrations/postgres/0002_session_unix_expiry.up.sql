@@ -0,0 +1 @@
+-- PostgreSQL has always stored expires_at as unix seconds.
@@ -0,0 +1,14 @@
+ALTER TABLE posts ADD COLUMN updated_at TIMESTAMP DEFAULT NULL;
+CREATE TABLE IF NOT EXISTS post_revisions (
+	revision_ID SERIAL PRIMARY KEY ,
+	post_ID INTEGER NOT NULL REFERENCES posts(post_ID) ,
+	editor_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	title TEXT NOT NULL ,
+	content TEXT NOT NULL ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS post_revision_categories (
+	revision_ID INTEGER NOT NULL REFERENCES post_revisions(revision_ID) ,
+	category_ID INTEGER NOT NULL REFERENCES categories(category_ID)
+);
+CREATE INDEX IF NOT EXISTS post_revisions_post ON post_revisions(post_ID);
@@ -0,0 +1,2 @@
+ALTER TABLE comments ADD COLUMN parent_comment_ID INTEGER DEFAULT NULL REFERENCES comments(comment_ID);
+CREATE INDEX IF NOT EXISTS comments_parent ON comments(parent_comment_ID);
@@ -0,0 +1,2 @@
+ALTER TABLE comments DROP COLUMN deleted_at;
+ALTER TABLE comments DROP COLUMN updated_at;
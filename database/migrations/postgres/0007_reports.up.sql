@@ -0,0 +1,36 @@
+ALTER TABLE posts ADD COLUMN hidden_at TIMESTAMP DEFAULT NULL;
+ALTER TABLE comments ADD COLUMN hidden_at TIMESTAMP DEFAULT NULL;
+CREATE TABLE IF NOT EXISTS reports (
+	report_ID SERIAL PRIMARY KEY ,
+	reporter_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	post_ID INTEGER REFERENCES posts(post_ID) ,
+	comment_ID INTEGER REFERENCES comments(comment_ID) ,
+	reason TEXT NOT NULL ,
+	status TEXT NOT NULL DEFAULT 'open' ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ,
+	resolved_at TIMESTAMP DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS reports_status ON reports(status);
+-- Decisions keep no reference to the report or its target so they outlive
+-- deleted posts.
+CREATE TABLE IF NOT EXISTS moderation_actions (
+	action_ID SERIAL PRIMARY KEY ,
+	moderator_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	author_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	target_type TEXT NOT NULL ,
+	target_ID INTEGER NOT NULL ,
+	post_ID INTEGER NOT NULL ,
+	decision TEXT NOT NULL ,
+	reason TEXT NOT NULL ,
+	note TEXT NOT NULL DEFAULT '' ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS warnings (
+	warning_ID SERIAL PRIMARY KEY ,
+	user_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	moderator_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	reason TEXT NOT NULL ,
+	note TEXT NOT NULL DEFAULT '' ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS warnings_user ON warnings(user_ID);
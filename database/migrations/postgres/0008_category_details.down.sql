@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS categories_slug;
+ALTER TABLE categories DROP COLUMN retired_at;
+ALTER TABLE categories DROP COLUMN sort_order;
+ALTER TABLE categories DROP COLUMN color;
+ALTER TABLE categories DROP COLUMN description;
+ALTER TABLE categories DROP COLUMN slug;
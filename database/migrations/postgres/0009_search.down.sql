@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS comments_search;
+DROP INDEX IF EXISTS posts_search;
+ALTER TABLE comments DROP COLUMN search;
+ALTER TABLE posts DROP COLUMN search;
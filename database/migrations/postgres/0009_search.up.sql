@@ -0,0 +1,11 @@
+-- Generated columns keep the search vectors in step with every write, as
+-- the FTS5 triggers do in SQLite. Titles weigh more than content.
+ALTER TABLE posts ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(content, '')), 'B')
+) STORED;
+ALTER TABLE comments ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	to_tsvector('english', coalesce(content, ''))
+) STORED;
+CREATE INDEX IF NOT EXISTS posts_search ON posts USING GIN (search);
+CREATE INDEX IF NOT EXISTS comments_search ON comments USING GIN (search);
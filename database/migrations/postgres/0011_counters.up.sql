@@ -0,0 +1,19 @@
+ALTER TABLE posts ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN dislike_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN comment_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN dislike_count INTEGER NOT NULL DEFAULT 0;
+-- The number of direct replies
+ALTER TABLE comments ADD COLUMN comment_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE posts SET
+	like_count = (SELECT COUNT(*) FROM likes WHERE likes.post_ID = posts.post_ID AND likes.type = 0),
+	dislike_count = (SELECT COUNT(*) FROM likes WHERE likes.post_ID = posts.post_ID AND likes.type = 1),
+	comment_count = (SELECT COUNT(*) FROM comments WHERE comments.post_ID = posts.post_ID);
+UPDATE comments SET
+	like_count = (SELECT COUNT(*) FROM likes WHERE likes.comment_ID = comments.comment_ID AND likes.type = 0),
+	dislike_count = (SELECT COUNT(*) FROM likes WHERE likes.comment_ID = comments.comment_ID AND likes.type = 1),
+	comment_count = (SELECT COUNT(*) FROM comments AS replies WHERE replies.parent_comment_ID = comments.comment_ID);
+
+CREATE INDEX IF NOT EXISTS posts_like_count ON posts(like_count);
+CREATE INDEX IF NOT EXISTS posts_comment_count ON posts(comment_count);
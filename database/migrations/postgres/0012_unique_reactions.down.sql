@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS likes_user_comment;
+DROP INDEX IF EXISTS likes_user_post;
@@ -0,0 +1,16 @@
+-- Keep only the latest reaction of a user to the same post or comment
+DELETE FROM likes WHERE post_ID IS NOT NULL AND like_ID NOT IN (
+	SELECT MAX(like_ID) FROM likes WHERE post_ID IS NOT NULL GROUP BY user_ID, post_ID
+);
+DELETE FROM likes WHERE comment_ID IS NOT NULL AND like_ID NOT IN (
+	SELECT MAX(like_ID) FROM likes WHERE comment_ID IS NOT NULL GROUP BY user_ID, comment_ID
+);
+CREATE UNIQUE INDEX IF NOT EXISTS likes_user_post ON likes(user_ID, post_ID) WHERE post_ID IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS likes_user_comment ON likes(user_ID, comment_ID) WHERE comment_ID IS NOT NULL;
+
+UPDATE posts SET
+	like_count = (SELECT COUNT(*) FROM likes WHERE likes.post_ID = posts.post_ID AND likes.type = 0),
+	dislike_count = (SELECT COUNT(*) FROM likes WHERE likes.post_ID = posts.post_ID AND likes.type = 1);
+UPDATE comments SET
+	like_count = (SELECT COUNT(*) FROM likes WHERE likes.comment_ID = comments.comment_ID AND likes.type = 0),
+	dislike_count = (SELECT COUNT(*) FROM likes WHERE likes.comment_ID = comments.comment_ID AND likes.type = 1);
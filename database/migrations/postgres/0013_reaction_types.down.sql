@@ -0,0 +1,3 @@
+-- Reactions of the types that are going away have nothing to fall back to
+DELETE FROM likes WHERE type NOT IN (0, 1);
+DROP TABLE IF EXISTS reaction_types;
@@ -0,0 +1,13 @@
+-- Personal access tokens. Only a SHA-256 hash of each token is kept; scopes
+-- is a comma-separated list of the auth package's scopes.
+CREATE TABLE IF NOT EXISTS api_tokens (
+	token_ID SERIAL PRIMARY KEY ,
+	user_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	name TEXT NOT NULL ,
+	token_hash TEXT NOT NULL UNIQUE ,
+	scopes TEXT NOT NULL ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ,
+	last_used_at TIMESTAMP DEFAULT NULL ,
+	revoked_at TIMESTAMP DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS api_tokens_user ON api_tokens(user_ID);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS sessions;
+CREATE TABLE sessions (
+	session_ID SERIAL PRIMARY KEY ,
+	token TEXT NOT NULL ,
+	user_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ,
+	expires_at BIGINT NOT NULL
+);
@@ -0,0 +1,16 @@
+-- Sessions are looked up by a SHA-256 hash of their token, and a user may
+-- have one on each device. The old rows hold plain tokens and cannot be
+-- hashed in SQL, so everybody logs in again. All times are unix seconds, like
+-- expires_at always was.
+DROP TABLE IF EXISTS sessions;
+CREATE TABLE sessions (
+	session_ID SERIAL PRIMARY KEY ,
+	token_hash TEXT NOT NULL UNIQUE ,
+	user_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	user_agent TEXT NOT NULL DEFAULT '' ,
+	ip TEXT NOT NULL DEFAULT '' ,
+	created_at BIGINT NOT NULL ,
+	last_seen_at BIGINT NOT NULL ,
+	expires_at BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sessions_user ON sessions(user_ID);
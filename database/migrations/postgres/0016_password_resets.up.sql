@@ -0,0 +1,12 @@
+-- Password reset links. Only a SHA-256 hash of each token is kept. A reset
+-- works once, and using it uses up the user's other resets too. Times are
+-- unix seconds, like those of sessions.
+CREATE TABLE IF NOT EXISTS password_resets (
+	reset_ID SERIAL PRIMARY KEY ,
+	user_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	token_hash TEXT NOT NULL UNIQUE ,
+	created_at BIGINT NOT NULL ,
+	expires_at BIGINT NOT NULL ,
+	used_at BIGINT DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS password_resets_user ON password_resets(user_ID);
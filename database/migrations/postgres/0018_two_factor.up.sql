@@ -0,0 +1,33 @@
+-- Two-factor authentication. totp_secret is set when a user starts setting
+-- up an authenticator app, and totp_enabled_at once they confirmed it with
+-- a code; totp_last_step is the time step of the last code used, so each
+-- code works once. Times are unix seconds.
+ALTER TABLE users ADD COLUMN totp_secret TEXT DEFAULT NULL;
+ALTER TABLE users ADD COLUMN totp_enabled_at BIGINT DEFAULT NULL;
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT DEFAULT NULL;
+
+-- Codes that stand in for the app once each. Only a SHA-256 hash of each
+-- code is kept.
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	code_ID SERIAL PRIMARY KEY ,
+	user_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	code_hash TEXT NOT NULL ,
+	used_at BIGINT DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS recovery_codes_user ON recovery_codes(user_ID);
+
+-- Logins waiting for their second factor, by the hash of the token in the
+-- visitor's cookie.
+CREATE TABLE IF NOT EXISTS login_challenges (
+	challenge_ID SERIAL PRIMARY KEY ,
+	user_ID INTEGER NOT NULL REFERENCES users(user_ID) ,
+	token_hash TEXT NOT NULL UNIQUE ,
+	expires_at BIGINT NOT NULL ,
+	attempts INTEGER NOT NULL DEFAULT 0
+);
+
+-- Settings admins change from the forum.
+CREATE TABLE IF NOT EXISTS settings (
+	name TEXT PRIMARY KEY NOT NULL ,
+	value TEXT NOT NULL
+);
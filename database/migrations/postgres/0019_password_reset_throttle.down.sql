@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN password_reset_sent_at;
@@ -0,0 +1,5 @@
+-- Wrong two-factor codes in a row, over every login and page they were
+-- entered on, and until when too many of them lock the user's second
+-- factor, in unix seconds.
+ALTER TABLE users ADD COLUMN totp_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN totp_locked_until BIGINT DEFAULT NULL;
@@ -0,0 +1,3 @@
+-- PostgreSQL TIMESTAMP columns keep no offset, so the rows written in the
+-- server's local time before the store wrote UTC cannot be told apart from
+-- the others. They are left as they are.
@@ -0,0 +1 @@
+-- Nothing to undo: the deleted sessions are gone either way.
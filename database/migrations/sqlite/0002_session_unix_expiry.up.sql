@@ -0,0 +1,4 @@
+-- Sessions used to store expires_at as a formatted timestamp, which never
+-- compared correctly against the current time. They are now unix seconds;
+-- drop the old rows so nobody keeps a session that cannot expire.
+DELETE FROM sessions WHERE typeof(expires_at) <> 'integer';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS post_revision_categories;
+DROP TABLE IF EXISTS post_revisions;
+ALTER TABLE posts DROP COLUMN updated_at;
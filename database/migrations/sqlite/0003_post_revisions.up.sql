@@ -0,0 +1,18 @@
+ALTER TABLE posts ADD COLUMN updated_at TIMESTAMP DEFAULT NULL;
+CREATE TABLE IF NOT EXISTS post_revisions (
+	revision_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
+	post_ID INTEGER NOT NULL ,
+	editor_ID INTEGER NOT NULL ,
+	title TEXT NOT NULL ,
+	content TEXT NOT NULL ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ,
+	FOREIGN KEY(post_ID) REFERENCES posts(post_ID) ,
+	FOREIGN KEY(editor_ID) REFERENCES users(user_ID)
+);
+CREATE TABLE IF NOT EXISTS post_revision_categories (
+	revision_ID INTEGER NOT NULL ,
+	category_ID INTEGER NOT NULL ,
+	FOREIGN KEY(revision_ID) REFERENCES post_revisions(revision_ID) ,
+	FOREIGN KEY(category_ID) REFERENCES categories(category_ID)
+);
+CREATE INDEX IF NOT EXISTS post_revisions_post ON post_revisions(post_ID);
@@ -0,0 +1,2 @@
+ALTER TABLE comments ADD COLUMN updated_at TIMESTAMP DEFAULT NULL;
+ALTER TABLE comments ADD COLUMN deleted_at TIMESTAMP DEFAULT NULL;
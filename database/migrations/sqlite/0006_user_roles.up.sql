@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
+UPDATE users SET role = 'admin' WHERE username = 'admin';
+UPDATE users SET role = 'moderator' WHERE username = 'moderator';
@@ -0,0 +1,43 @@
+ALTER TABLE posts ADD COLUMN hidden_at TIMESTAMP DEFAULT NULL;
+ALTER TABLE comments ADD COLUMN hidden_at TIMESTAMP DEFAULT NULL;
+CREATE TABLE IF NOT EXISTS reports (
+	report_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
+	reporter_ID INTEGER NOT NULL ,
+	post_ID INTEGER ,
+	comment_ID INTEGER ,
+	reason TEXT NOT NULL ,
+	status TEXT NOT NULL DEFAULT 'open' ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ,
+	resolved_at TIMESTAMP DEFAULT NULL ,
+	FOREIGN KEY(reporter_ID) REFERENCES users(user_ID) ,
+	FOREIGN KEY(post_ID) REFERENCES posts(post_ID) ,
+	FOREIGN KEY(comment_ID) REFERENCES comments(comment_ID)
+);
+CREATE INDEX IF NOT EXISTS reports_status ON reports(status);
+-- Decisions keep no reference to the report or its target so they outlive
+-- deleted posts.
+CREATE TABLE IF NOT EXISTS moderation_actions (
+	action_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
+	moderator_ID INTEGER NOT NULL ,
+	author_ID INTEGER NOT NULL ,
+	target_type TEXT NOT NULL ,
+	target_ID INTEGER NOT NULL ,
+	post_ID INTEGER NOT NULL ,
+	decision TEXT NOT NULL ,
+	reason TEXT NOT NULL ,
+	note TEXT NOT NULL DEFAULT '' ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ,
+	FOREIGN KEY(moderator_ID) REFERENCES users(user_ID) ,
+	FOREIGN KEY(author_ID) REFERENCES users(user_ID)
+);
+CREATE TABLE IF NOT EXISTS warnings (
+	warning_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
+	user_ID INTEGER NOT NULL ,
+	moderator_ID INTEGER NOT NULL ,
+	reason TEXT NOT NULL ,
+	note TEXT NOT NULL DEFAULT '' ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ,
+	FOREIGN KEY(user_ID) REFERENCES users(user_ID) ,
+	FOREIGN KEY(moderator_ID) REFERENCES users(user_ID)
+);
+CREATE INDEX IF NOT EXISTS warnings_user ON warnings(user_ID);
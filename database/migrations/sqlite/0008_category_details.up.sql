@@ -0,0 +1,7 @@
+ALTER TABLE categories ADD COLUMN slug TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN color TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE categories ADD COLUMN retired_at TIMESTAMP DEFAULT NULL;
+UPDATE categories SET slug = LOWER(REPLACE(TRIM(category), ' ', '-')), sort_order = category_ID;
+CREATE UNIQUE INDEX IF NOT EXISTS categories_slug ON categories(slug);
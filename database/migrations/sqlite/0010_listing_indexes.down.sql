@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS posts_created;
+DROP INDEX IF EXISTS post_categories_post;
+DROP INDEX IF EXISTS comments_post;
+DROP INDEX IF EXISTS likes_comment;
+DROP INDEX IF EXISTS likes_post;
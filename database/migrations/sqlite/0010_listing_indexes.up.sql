@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS likes_post ON likes(post_ID, type);
+CREATE INDEX IF NOT EXISTS likes_comment ON likes(comment_ID, type);
+CREATE INDEX IF NOT EXISTS comments_post ON comments(post_ID);
+CREATE INDEX IF NOT EXISTS post_categories_post ON post_categories(post_ID);
+CREATE INDEX IF NOT EXISTS posts_created ON posts(created_at);
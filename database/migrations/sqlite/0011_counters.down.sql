@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS posts_comment_count;
+DROP INDEX IF EXISTS posts_like_count;
+ALTER TABLE comments DROP COLUMN comment_count;
+ALTER TABLE comments DROP COLUMN dislike_count;
+ALTER TABLE comments DROP COLUMN like_count;
+ALTER TABLE posts DROP COLUMN comment_count;
+ALTER TABLE posts DROP COLUMN dislike_count;
+ALTER TABLE posts DROP COLUMN like_count;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS reaction_types (
+	type INTEGER PRIMARY KEY NOT NULL ,
+	name TEXT NOT NULL UNIQUE ,
+	emoji TEXT NOT NULL ,
+	sort_order INTEGER NOT NULL DEFAULT 0 ,
+	disabled_at TIMESTAMP DEFAULT NULL
+);
+
+-- Like and dislike keep the types they always had; the others start out
+-- disabled and can be turned on with "forum reactions enable <name>"
+INSERT INTO reaction_types (type, name, emoji, sort_order) VALUES
+	(0, 'like', '👍', 0),
+	(1, 'dislike', '👎', 1);
+INSERT INTO reaction_types (type, name, emoji, sort_order, disabled_at) VALUES
+	(2, 'love', '❤️', 2, CURRENT_TIMESTAMP),
+	(3, 'laugh', '😂', 3, CURRENT_TIMESTAMP),
+	(4, 'wow', '😮', 4, CURRENT_TIMESTAMP),
+	(5, 'sad', '😢', 5, CURRENT_TIMESTAMP);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS sessions;
+CREATE TABLE sessions (
+	session_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
+	token TEXT NOT NULL ,
+	user_ID INTEGER NOT NULL ,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ,
+	expires_at INTEGER NOT NULL ,
+	FOREIGN KEY(user_ID) REFERENCES users(user_ID)
+);
@@ -0,0 +1,17 @@
+-- Sessions are looked up by a SHA-256 hash of their token, and a user may
+-- have one on each device. The old rows hold plain tokens and cannot be
+-- hashed in SQL, so everybody logs in again. All times are unix seconds, like
+-- expires_at always was.
+DROP TABLE IF EXISTS sessions;
+CREATE TABLE sessions (
+	session_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
+	token_hash TEXT NOT NULL UNIQUE ,
+	user_ID INTEGER NOT NULL ,
+	user_agent TEXT NOT NULL DEFAULT '' ,
+	ip TEXT NOT NULL DEFAULT '' ,
+	created_at INTEGER NOT NULL ,
+	last_seen_at INTEGER NOT NULL ,
+	expires_at INTEGER NOT NULL ,
+	FOREIGN KEY(user_ID) REFERENCES users(user_ID)
+);
+CREATE INDEX IF NOT EXISTS sessions_user ON sessions(user_ID);
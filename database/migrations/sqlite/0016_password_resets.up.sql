@@ -0,0 +1,13 @@
+-- Password reset links. Only a SHA-256 hash of each token is kept. A reset
+-- works once, and using it uses up the user's other resets too. Times are
+-- unix seconds, like those of sessions.
+CREATE TABLE IF NOT EXISTS password_resets (
+	reset_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
+	user_ID INTEGER NOT NULL ,
+	token_hash TEXT NOT NULL UNIQUE ,
+	created_at INTEGER NOT NULL ,
+	expires_at INTEGER NOT NULL ,
+	used_at INTEGER DEFAULT NULL ,
+	FOREIGN KEY(user_ID) REFERENCES users(user_ID)
+);
+CREATE INDEX IF NOT EXISTS password_resets_user ON password_resets(user_ID);
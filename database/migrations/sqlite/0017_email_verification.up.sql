@@ -0,0 +1,6 @@
+-- When users verified their email address, and when they were last sent a
+-- link to verify it, in unix seconds. Users from before verification count
+-- as verified.
+ALTER TABLE users ADD COLUMN email_verified_at INTEGER DEFAULT NULL;
+ALTER TABLE users ADD COLUMN verification_sent_at INTEGER DEFAULT NULL;
+UPDATE users SET email_verified_at = CAST(strftime('%s', 'now') AS INTEGER);
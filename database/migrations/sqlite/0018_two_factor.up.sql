@@ -0,0 +1,35 @@
+-- Two-factor authentication. totp_secret is set when a user starts setting
+-- up an authenticator app, and totp_enabled_at once they confirmed it with
+-- a code; totp_last_step is the time step of the last code used, so each
+-- code works once. Times are unix seconds.
+ALTER TABLE users ADD COLUMN totp_secret TEXT DEFAULT NULL;
+ALTER TABLE users ADD COLUMN totp_enabled_at INTEGER DEFAULT NULL;
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER DEFAULT NULL;
+
+-- Codes that stand in for the app once each. Only a SHA-256 hash of each
+-- code is kept.
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	code_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
+	user_ID INTEGER NOT NULL ,
+	code_hash TEXT NOT NULL ,
+	used_at INTEGER DEFAULT NULL ,
+	FOREIGN KEY(user_ID) REFERENCES users(user_ID)
+);
+CREATE INDEX IF NOT EXISTS recovery_codes_user ON recovery_codes(user_ID);
+
+-- Logins waiting for their second factor, by the hash of the token in the
+-- visitor's cookie.
+CREATE TABLE IF NOT EXISTS login_challenges (
+	challenge_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
+	user_ID INTEGER NOT NULL ,
+	token_hash TEXT NOT NULL UNIQUE ,
+	expires_at INTEGER NOT NULL ,
+	attempts INTEGER NOT NULL DEFAULT 0 ,
+	FOREIGN KEY(user_ID) REFERENCES users(user_ID)
+);
+
+-- Settings admins change from the forum.
+CREATE TABLE IF NOT EXISTS settings (
+	name TEXT PRIMARY KEY NOT NULL ,
+	value TEXT NOT NULL
+);
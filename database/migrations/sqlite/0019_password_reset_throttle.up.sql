@@ -0,0 +1,3 @@
+-- When users were last sent a link to reset their password, in unix
+-- seconds, so asking again and again does not flood their inbox.
+ALTER TABLE users ADD COLUMN password_reset_sent_at INTEGER DEFAULT NULL;
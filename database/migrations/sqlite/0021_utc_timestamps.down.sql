@@ -0,0 +1 @@
+-- Nothing to undo: the rewritten timestamps name the same instants.
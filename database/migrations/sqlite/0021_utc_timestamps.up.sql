@@ -0,0 +1,82 @@
+-- Timestamps used to be written in three forms: the server's local time
+-- with its offset (posts, edits, likes...), UTC without one (comments, from
+-- CURRENT_TIMESTAMP) and UTC with " UTC" after it (the demo data). Mixed
+-- forms do not sort together as text, so rewrite them all in the one form
+-- the store now writes through the driver: UTC, the fraction of a second
+-- to the nanosecond without trailing zeros, and a +00:00 offset, e.g.
+-- "2024-05-01 08:30:00.1234+00:00". strftime only keeps milliseconds, so
+-- the fraction is copied over from the old value instead.
+CREATE TEMP TABLE old_timestamps (value TEXT PRIMARY KEY, plain TEXT, rest TEXT, fraction TEXT, utc TEXT);
+INSERT OR IGNORE INTO old_timestamps (value)
+	SELECT created_at FROM users WHERE created_at NOT LIKE '%+00:00'
+	UNION SELECT created_at FROM posts WHERE created_at NOT LIKE '%+00:00'
+	UNION SELECT updated_at FROM posts WHERE updated_at NOT LIKE '%+00:00'
+	UNION SELECT hidden_at FROM posts WHERE hidden_at NOT LIKE '%+00:00'
+	UNION SELECT created_at FROM comments WHERE created_at NOT LIKE '%+00:00'
+	UNION SELECT updated_at FROM comments WHERE updated_at NOT LIKE '%+00:00'
+	UNION SELECT deleted_at FROM comments WHERE deleted_at NOT LIKE '%+00:00'
+	UNION SELECT hidden_at FROM comments WHERE hidden_at NOT LIKE '%+00:00'
+	UNION SELECT created_at FROM likes WHERE created_at NOT LIKE '%+00:00'
+	UNION SELECT created_at FROM post_revisions WHERE created_at NOT LIKE '%+00:00'
+	UNION SELECT retired_at FROM categories WHERE retired_at NOT LIKE '%+00:00'
+	UNION SELECT created_at FROM reports WHERE created_at NOT LIKE '%+00:00'
+	UNION SELECT resolved_at FROM reports WHERE resolved_at NOT LIKE '%+00:00'
+	UNION SELECT created_at FROM moderation_actions WHERE created_at NOT LIKE '%+00:00'
+	UNION SELECT created_at FROM warnings WHERE created_at NOT LIKE '%+00:00'
+	UNION SELECT disabled_at FROM reaction_types WHERE disabled_at NOT LIKE '%+00:00'
+	UNION SELECT created_at FROM api_tokens WHERE created_at NOT LIKE '%+00:00'
+	UNION SELECT last_used_at FROM api_tokens WHERE last_used_at NOT LIKE '%+00:00'
+	UNION SELECT revoked_at FROM api_tokens WHERE revoked_at NOT LIKE '%+00:00';
+
+-- rest is what follows the seconds, e.g. ".123456789+02:00"
+UPDATE old_timestamps SET plain = replace(value, ' UTC', '');
+UPDATE old_timestamps SET rest = substr(plain, 20);
+-- fraction is the digits after the dot, up to the offset if there is one
+UPDATE old_timestamps SET fraction = CASE WHEN rest LIKE '.%' THEN rtrim(substr(rest, 2, COALESCE(
+		NULLIF(instr(rest, '+'), 0), NULLIF(instr(rest, '-'), 0), NULLIF(instr(rest, 'Z'), 0), length(rest) + 1) - 2), '0')
+	ELSE '' END;
+-- Values strftime cannot read are left as they are
+UPDATE old_timestamps SET utc = strftime('%Y-%m-%d %H:%M:%S', plain)
+	|| CASE WHEN fraction = '' THEN '' ELSE '.' || fraction END || '+00:00'
+	WHERE strftime('%Y-%m-%d %H:%M:%S', plain) IS NOT NULL;
+
+UPDATE users SET created_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = created_at), created_at)
+	WHERE created_at NOT LIKE '%+00:00';
+UPDATE posts SET created_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = created_at), created_at)
+	WHERE created_at NOT LIKE '%+00:00';
+UPDATE posts SET updated_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = updated_at), updated_at)
+	WHERE updated_at NOT LIKE '%+00:00';
+UPDATE posts SET hidden_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = hidden_at), hidden_at)
+	WHERE hidden_at NOT LIKE '%+00:00';
+UPDATE comments SET created_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = created_at), created_at)
+	WHERE created_at NOT LIKE '%+00:00';
+UPDATE comments SET updated_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = updated_at), updated_at)
+	WHERE updated_at NOT LIKE '%+00:00';
+UPDATE comments SET deleted_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = deleted_at), deleted_at)
+	WHERE deleted_at NOT LIKE '%+00:00';
+UPDATE comments SET hidden_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = hidden_at), hidden_at)
+	WHERE hidden_at NOT LIKE '%+00:00';
+UPDATE likes SET created_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = created_at), created_at)
+	WHERE created_at NOT LIKE '%+00:00';
+UPDATE post_revisions SET created_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = created_at), created_at)
+	WHERE created_at NOT LIKE '%+00:00';
+UPDATE categories SET retired_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = retired_at), retired_at)
+	WHERE retired_at NOT LIKE '%+00:00';
+UPDATE reports SET created_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = created_at), created_at)
+	WHERE created_at NOT LIKE '%+00:00';
+UPDATE reports SET resolved_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = resolved_at), resolved_at)
+	WHERE resolved_at NOT LIKE '%+00:00';
+UPDATE moderation_actions SET created_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = created_at), created_at)
+	WHERE created_at NOT LIKE '%+00:00';
+UPDATE warnings SET created_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = created_at), created_at)
+	WHERE created_at NOT LIKE '%+00:00';
+UPDATE reaction_types SET disabled_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = disabled_at), disabled_at)
+	WHERE disabled_at NOT LIKE '%+00:00';
+UPDATE api_tokens SET created_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = created_at), created_at)
+	WHERE created_at NOT LIKE '%+00:00';
+UPDATE api_tokens SET last_used_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = last_used_at), last_used_at)
+	WHERE last_used_at NOT LIKE '%+00:00';
+UPDATE api_tokens SET revoked_at = COALESCE((SELECT utc FROM old_timestamps WHERE value = revoked_at), revoked_at)
+	WHERE revoked_at NOT LIKE '%+00:00';
+
+DROP TABLE old_timestamps;
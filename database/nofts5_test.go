@@ -0,0 +1,5 @@
+//go:build !sqlite_fts5
+
+package database
+
+const builtWithFTS5 = false
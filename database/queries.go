@@ -2,126 +2,154 @@ package database
 
 import (
 	"database/sql"
+	_ "embed"
 	"errors"
+	"forum/database/migrations"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-const createtables string = `
-CREATE TABLE IF NOT EXISTS categories (
-	category_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
-	category TEXT NOT NULL
-);
-CREATE TABLE IF NOT EXISTS users (
-	user_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
-	email TEXT DEFAULT NULL ,
-	username TEXT NOT NULL UNIQUE ,
-	password TEXT DEFAULT NULL ,
-	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-CREATE TABLE IF NOT EXISTS posts (
-	post_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
-	user_ID INTEGER NOT NULL ,
-	title TEXT NOT NULL ,
-	content TEXT NOT NULL ,
-	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ,
-	FOREIGN KEY(user_ID) REFERENCES users(user_ID)
-);
-CREATE TABLE IF NOT EXISTS comments (
-	comment_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
-	post_ID INTEGER NOT NULL ,
-	user_ID INTEGER NOT NULL ,
-	content TEXT NOT NULL ,
-	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-	FOREIGN KEY(post_ID) REFERENCES posts(post_ID),
-	FOREIGN KEY(user_ID) REFERENCES users(user_ID)
-);
-CREATE TABLE IF NOT EXISTS sessions (
-	session_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
-	token TEXT NOT NULL ,
-	user_ID INTEGER NOT NULL ,
-	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ,
-	expires_at INTEGER NOT NULL ,
-	FOREIGN KEY(user_ID) REFERENCES users(user_ID)
-);
-CREATE TABLE IF NOT EXISTS likes ( 
-    like_ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL ,
-    post_ID INTEGER , 
-    comment_ID INTEGER , 
-    user_ID INTEGER NOT NULL , 
-    type INTEGER NOT NULL , 
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP , 
-    FOREIGN KEY(post_ID) REFERENCES posts(post_ID) , 
-    FOREIGN KEY(comment_id) REFERENCES comments(comment_id) , 
-    FOREIGN KEY(user_ID) REFERENCES users(user_ID)
-);
-CREATE TABLE IF NOT EXISTS post_categories (
-    post_ID INTEGER NOT NULL, 
-	category_ID INTEGER NOT NULL, 
-    FOREIGN KEY(post_ID) REFERENCES posts(post_ID) , 
-    FOREIGN KEY(category_ID) REFERENCES categories(category_ID)
-);`
-
-func OpenDB() (*sql.DB, error) {
-	dbPath := "./database/database.db"
-
-	// Check if the database file exists
-	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
-		// Open a new database connection
-		db, err := sql.Open("sqlite3", dbPath)
-		if err != nil {
-			return nil, err
-		}
+const dbPath = "./database/database.db"
+
+//go:embed sql/fill_tables.sql
+var fillTables string
+
+// Dialect names the SQL flavour spoken by the database behind a *sql.DB.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
 
-		// Tables
-		if _, err := db.Exec(createtables); err != nil {
-			return nil, err
+// OpenDB opens the database named by the DATABASE_URL environment
+// variable. An empty DATABASE_URL opens the SQLite file in ./database,
+// "sqlite://path" opens another SQLite file and "postgres://..." connects
+// to PostgreSQL.
+func OpenDB() (*sql.DB, Dialect, error) {
+	dialect, dsn, err := ParseURL(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	driver := "sqlite3"
+	if dialect == Postgres {
+		driver = "postgres"
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, "", err
+	}
+	if dialect == SQLite {
+		if err := checkFTS5(db); err != nil {
+			db.Close()
+			return nil, "", err
 		}
+	}
+	return db, dialect, nil
+}
+
+// ErrNoFTS5 is returned by OpenDB when SQLite was compiled without the FTS5
+// extension, which the search migration and search itself need.
+var ErrNoFTS5 = errors.New("SQLite was built without FTS5, which search needs: " +
+	"build or run the forum with the sqlite_fts5 tag, e.g. go run -tags sqlite_fts5 .")
+
+// checkFTS5 returns ErrNoFTS5 unless the SQLite linked in has FTS5.
+func checkFTS5(db *sql.DB) error {
+	var enabled bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrNoFTS5
+	}
+	return nil
+}
+
+// ParseURL splits a DATABASE_URL into its dialect and the data source name
+// handed to the driver.
+func ParseURL(url string) (Dialect, string, error) {
+	switch {
+	case url == "":
+		return SQLite, sqliteDSN(dbPath), nil
+	case strings.HasPrefix(url, "sqlite://"):
+		return SQLite, sqliteDSN(strings.TrimPrefix(url, "sqlite://")), nil
+	case strings.HasPrefix(url, "sqlite:"):
+		return SQLite, sqliteDSN(strings.TrimPrefix(url, "sqlite:")), nil
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		return Postgres, url, nil
+	}
+	return "", "", errors.New("DATABASE_URL must start with sqlite:// or postgres://")
+}
+
+// sqliteOptions are added to every SQLite file name. Requests writing at the
+// same time wait up to five seconds for each other instead of failing with
+// "database is locked", and transactions take the write lock when they
+// begin, so one that reads before it writes is not refused halfway. Options
+// already in DATABASE_URL come first and win.
+const sqliteOptions = "_busy_timeout=5000&_txlock=immediate"
 
-		paths := []string{"./database/sql/fill_tables.sql"}
-		for _, path := range paths {
-			sqlFile, err := os.ReadFile(path)
-			if err != nil {
-				log.Println("Error reading file:", err)
-				continue
-			}
-
-			queries := strings.Split(string(sqlFile), ";")
-			for _, query := range queries {
-				query = strings.TrimSpace(query)
-				if query == "" {
-					continue
-				}
-
-				tx, err := db.Begin()
-				if err != nil {
-					log.Println("Error starting transaction:", err)
-					continue
-				}
-
-				_, err = tx.Exec(query)
-				if err != nil {
-					log.Println("Error executing query:", err)
-					tx.Rollback()
-					continue
-				}
-
-				err = tx.Commit()
-				if err != nil {
-					log.Println("Error committing transaction:", err)
-					continue
-				}
-			}
+func sqliteDSN(path string) string {
+	if strings.Contains(path, "?") {
+		return path + "&" + sqliteOptions
+	}
+	return path + "?" + sqliteOptions
+}
+
+// Rebind rewrites the ? placeholders used throughout the code base into
+// the $1, $2, ... form PostgreSQL expects. Question marks inside quoted
+// strings are left alone.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	inQuote := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == '?' && !inQuote:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
 		}
-		return db, nil
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Migrate brings the schema up to date, logging every migration it applies.
+func Migrate(db *sql.DB, dialect Dialect) error {
+	migrator, err := migrations.New(db, string(dialect))
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		log.Printf("Applied migration %04d_%s\n", migration.Version, migration.Name)
 	}
+	return err
+}
 
-	db, err := sql.Open("sqlite3", dbPath)
+// Seed fills an empty database with the demo categories, users, posts,
+// comments and likes. It runs in a single transaction, so seeding a
+// database that already holds the demo users fails without changes.
+func Seed(db *sql.DB) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if _, err := tx.Exec(fillTables); err != nil {
+		tx.Rollback()
+		return err
 	}
-	return db, nil
+	return tx.Commit()
 }
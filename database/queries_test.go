@@ -0,0 +1,44 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestOpenDBChecksFTS5 checks that SQLite without FTS5 is refused when the
+// database is opened, before any migration runs.
+func TestOpenDBChecksFTS5(t *testing.T) {
+	t.Setenv("DATABASE_URL", "sqlite://"+filepath.Join(t.TempDir(), "forum.db"))
+	db, _, err := OpenDB()
+	if builtWithFTS5 {
+		if err != nil {
+			t.Fatalf("OpenDB = %v, want no error with the sqlite_fts5 tag", err)
+		}
+		db.Close()
+	} else if !errors.Is(err, ErrNoFTS5) {
+		t.Fatalf("OpenDB = %v, want ErrNoFTS5 without the sqlite_fts5 tag", err)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		dialect Dialect
+		dsn     string
+	}{
+		{"", SQLite, dbPath + "?" + sqliteOptions},
+		{"sqlite:///tmp/forum.db", SQLite, "/tmp/forum.db?" + sqliteOptions},
+		{"sqlite:forum.db?_busy_timeout=100", SQLite, "forum.db?_busy_timeout=100&" + sqliteOptions},
+		{"postgres://forum@localhost/forum?sslmode=disable", Postgres, "postgres://forum@localhost/forum?sslmode=disable"},
+	}
+	for _, tt := range tests {
+		dialect, dsn, err := ParseURL(tt.url)
+		if err != nil || dialect != tt.dialect || dsn != tt.dsn {
+			t.Errorf("ParseURL(%q) = %q, %q, %v; want %q, %q", tt.url, dialect, dsn, err, tt.dialect, tt.dsn)
+		}
+	}
+	if _, _, err := ParseURL("mysql://localhost/forum"); err == nil {
+		t.Error("ParseURL accepted a MySQL URL")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"forum/helpers"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// lcsLength is the longest common subsequence of a and b, the slow way.
+func lcsLength(a, b []string) int {
+	table := make([][]int, len(a)+1)
+	for i := range table {
+		table[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				table[i][j] = table[i+1][j+1] + 1
+			case table[i+1][j] >= table[i][j+1]:
+				table[i][j] = table[i+1][j]
+			default:
+				table[i][j] = table[i][j+1]
+			}
+		}
+	}
+	return table[0][0]
+}
+
+// sides puts the texts of a diff back together.
+func sides(parts []helpers.DiffPart) (old, new []string, unchanged int) {
+	for _, part := range parts {
+		words := strings.Fields(part.Text)
+		if !part.Added {
+			old = append(old, words...)
+		}
+		if !part.Removed {
+			new = append(new, words...)
+		}
+		if !part.Added && !part.Removed {
+			unchanged += len(words)
+		}
+	}
+	return old, new, unchanged
+}
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     []helpers.DiffPart
+	}{
+		{"", "", nil},
+		{"a b c", "a b c", []helpers.DiffPart{{Text: "a b c"}}},
+		{"a b c", "a x c", []helpers.DiffPart{{Text: "a"}, {Text: "b", Removed: true}, {Text: "x", Added: true}, {Text: "c"}}},
+		{"the quick fox", "the quick brown fox", []helpers.DiffPart{{Text: "the quick"}, {Text: "brown", Added: true}, {Text: "fox"}}},
+		{"a b", "", []helpers.DiffPart{{Text: "a b", Removed: true}}},
+	}
+	for _, tt := range tests {
+		got := helpers.DiffWords(tt.old, tt.new)
+		if len(got) != len(tt.want) {
+			t.Errorf("DiffWords(%q, %q) = %+v, want %+v", tt.old, tt.new, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("DiffWords(%q, %q) = %+v, want %+v", tt.old, tt.new, got, tt.want)
+				break
+			}
+		}
+	}
+
+	// Random texts of few distinct words have long common subsequences
+	rng := rand.New(rand.NewSource(1))
+	text := func() []string {
+		words := make([]string, rng.Intn(40))
+		for i := range words {
+			words[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return words
+	}
+	for i := 0; i < 500; i++ {
+		a, b := text(), text()
+		old, new, unchanged := sides(helpers.DiffWords(strings.Join(a, " "), strings.Join(b, " ")))
+		if strings.Join(old, " ") != strings.Join(a, " ") || strings.Join(new, " ") != strings.Join(b, " ") {
+			t.Fatalf("the diff of %q and %q does not give them back", a, b)
+		}
+		if want := lcsLength(a, b); unchanged != want {
+			t.Fatalf("the diff of %q and %q keeps %d words, want %d", a, b, unchanged, want)
+		}
+	}
+}
+
+func TestDiffWordsGivesUpOnHugeChanges(t *testing.T) {
+	a := strings.Repeat("a ", 5000)
+	b := strings.Repeat("b ", 5000)
+	parts := helpers.DiffWords("same "+a+"end", "same "+b+"end")
+	if len(parts) != 4 || !parts[1].Removed || !parts[2].Added || parts[0].Text != "same" || parts[3].Text != "end" {
+		t.Errorf("got %d parts, want the middle shown as replaced", len(parts))
+	}
+}
+
+func TestPostLengthIsCapped(t *testing.T) {
+	f := newTestForum(t)
+	f.addUser(t, "alice", "member")
+	c := f.login(t, "alice")
+	form := url.Values{
+		"title":           {"Long"},
+		"content":         {strings.Repeat("x", helpers.MaxPostLength+1)},
+		"categories[]":    {"General"},
+		helpers.CSRFField: {c.csrfToken()},
+	}
+	if res := c.post("/add-post", form); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("too long a post: got %d, want 400", res.StatusCode)
+	}
+	form.Set("content", "Short")
+	form.Set("title", strings.Repeat("x", helpers.MaxTitleLength+1))
+	if res := c.post("/add-post", form); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("too long a title: got %d, want 400", res.StatusCode)
+	}
+}
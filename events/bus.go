@@ -0,0 +1,91 @@
+// Package events passes what happens on a post to everybody watching it,
+// within the server process.
+package events
+
+import (
+	"forum/store"
+	"sync"
+)
+
+// Kinds of events.
+const (
+	// KindComment is a new comment or reply.
+	KindComment = "comment"
+	// KindReactions is a change in the reaction counts of a post or one of
+	// its comments.
+	KindReactions = "reactions"
+)
+
+// SubscriberBuffer is how many events a subscriber may fall behind before
+// further events are dropped for it.
+const SubscriberBuffer = 16
+
+// Event is something that happened on a post.
+type Event struct {
+	Kind   string
+	PostID int
+
+	CommentID int // KindComment: the new comment
+
+	TargetType string // KindReactions: what the counts are of
+	TargetID   int
+	Reactions  []store.ReactionCount
+}
+
+// Bus hands the events published about a post to its subscribers. Publish
+// never waits for a subscriber.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan Event]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: map[int]map[chan Event]struct{}{}}
+}
+
+// Subscribe returns a channel receiving the events of a post, and the
+// function that stops them and closes the channel.
+func (b *Bus) Subscribe(postID int) (<-chan Event, func()) {
+	ch := make(chan Event, SubscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[postID] == nil {
+		b.subscribers[postID] = map[chan Event]struct{}{}
+	}
+	b.subscribers[postID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers[postID], ch)
+			if len(b.subscribers[postID]) == 0 {
+				delete(b.subscribers, postID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Publish sends the event to the subscribers of its post. A subscriber
+// whose buffer is full misses it.
+func (b *Bus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[event.PostID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribers returns how many subscribers a post has.
+func (b *Bus) Subscribers(postID int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers[postID])
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"forum/events"
+	"forum/helpers"
+	"forum/mail"
+	"forum/ranking"
+	"forum/routes"
+	"forum/sessions"
+	"forum/store"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testPassword is the password of every user addUser makes.
+const testPassword = "password1"
+
+// testForum is the whole forum, routes and middleware, served from a memory
+// store.
+type testForum struct {
+	*httptest.Server
+	st       *store.Memory
+	mailer   *testMailer
+	reg      *routes.Registry
+	settings *helpers.Settings
+}
+
+func newTestForum(t *testing.T) *testForum {
+	t.Helper()
+	return newTestForumWith(t, helpers.VerifyReadOnly)
+}
+
+// newTestForumWith is newTestForum with another email verification policy.
+func newTestForumWith(t *testing.T, verification helpers.VerificationPolicy) *testForum {
+	t.Helper()
+	st := store.NewMemory("General", "Help")
+	f := &testForum{st: st, mailer: &testMailer{}}
+	sm := sessions.NewManager(st)
+	settings, err := helpers.LoadSettings(st, verification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.settings = settings
+	f.reg = routes.NewRegistry()
+	err = registerRoutes(f.reg, st, ranking.NewCache(st, ranking.Hot), events.NewBus(), sm,
+		&helpers.Mail{Mailer: f.mailer, BaseURL: "http://forum.test", Secret: []byte("test secret")}, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Server = httptest.NewServer(middleware(st, sm, settings, f.reg))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// addUser stores a user with a verified email and the role.
+func (f *testForum) addUser(t *testing.T, username, role string) store.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := f.st.AddUser(username+"@example.com", username, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.st.VerifyEmail(userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.st.SetUserRole(username, role); err != nil {
+		t.Fatal(err)
+	}
+	user, err := f.st.GetUserByUsername(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// testClient is a browser: it keeps cookies and does not follow redirects.
+type testClient struct {
+	t *testing.T
+	f *testForum
+	*http.Client
+}
+
+func (f *testForum) client(t *testing.T) *testClient {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testClient{t: t, f: f, Client: &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// login returns a client logged in as the user.
+func (f *testForum) login(t *testing.T, username string) *testClient {
+	t.Helper()
+	c := f.client(t)
+	res := c.post("/login", url.Values{"username": {username}, "password": {testPassword}, helpers.CSRFField: {c.csrfToken()}})
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("logging in as %s: got %d, want 303", username, res.StatusCode)
+	}
+	return c
+}
+
+func (c *testClient) do(req *http.Request) (*http.Response, string) {
+	c.t.Helper()
+	res, err := c.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return res, string(body)
+}
+
+func (c *testClient) get(path string) (*http.Response, string) {
+	c.t.Helper()
+	req, err := http.NewRequest(http.MethodGet, c.f.URL+path, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return c.do(req)
+}
+
+// submit posts a form with the CSRF token, as the forms of the pages do,
+// and returns the page it answers with.
+func (c *testClient) submit(path string, form url.Values) (*http.Response, string) {
+	c.t.Helper()
+	form.Set(helpers.CSRFField, c.csrfToken())
+	req, err := http.NewRequest(http.MethodPost, c.f.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req)
+}
+
+// postWith posts a form with extra headers.
+func (c *testClient) postWith(path string, form url.Values, header http.Header) *http.Response {
+	c.t.Helper()
+	req, err := http.NewRequest(http.MethodPost, c.f.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	res, _ := c.do(req)
+	return res
+}
+
+func (c *testClient) post(path string, form url.Values) *http.Response {
+	c.t.Helper()
+	return c.postWith(path, form, nil)
+}
+
+var csrfFieldPattern = regexp.MustCompile(`name="` + helpers.CSRFField + `" value="([^"]+)"`)
+
+// csrfToken returns the token in the forms of the home page.
+func (c *testClient) csrfToken() string {
+	c.t.Helper()
+	_, body := c.get("/")
+	match := csrfFieldPattern.FindStringSubmatch(body)
+	if match == nil {
+		c.t.Fatal("the home page has no CSRF field")
+	}
+	return match[1]
+}
+
+// testMailer keeps the messages it is asked to send.
+type testMailer struct {
+	// hold, when set, keeps Send from returning until it is closed
+	hold chan struct{}
+
+	mu     sync.Mutex
+	sent   []mail.Message
+	down   bool // Send fails, as when the SMTP server is unreachable
+	failed int  // how many messages Send failed to send
+}
+
+var errMailerDown = errors.New("the mail server is down")
+
+func (m *testMailer) Send(msg mail.Message) error {
+	if m.hold != nil {
+		<-m.hold
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.down {
+		m.failed++
+		return errMailerDown
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// setDown makes Send fail, or work again.
+func (m *testMailer) setDown(down bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.down = down
+}
+
+// messages returns what was sent so far.
+func (m *testMailer) messages() []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mail.Message(nil), m.sent...)
+}
+
+// wait returns what was sent once at least n messages were, for mail sent
+// after the answer.
+func (m *testMailer) wait(t *testing.T, n int) []mail.Message {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if sent := m.messages(); len(sent) >= n {
+			return sent
+		}
+	}
+	t.Fatalf("%d messages were sent, want %d", len(m.messages()), n)
+	return nil
+}
+
+// waitFailed returns once Send failed at least n times.
+func (m *testMailer) waitFailed(t *testing.T, n int) {
+	t.Helper()
+	failed := func() int {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.failed
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if failed() >= n {
+			return
+		}
+	}
+	t.Fatalf("Send failed %d times, want %d", failed(), n)
+}
+
+// addToken gives the user an API token with the scopes and returns it.
+func (f *testForum) addToken(t *testing.T, user store.User, scopes ...string) string {
+	t.Helper()
+	token, err := helpers.GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.st.AddAPIToken(user.UserID, "test", helpers.HashAPIToken(token), scopes); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// addPost stores a post by the user, hidden by a moderator if hide is set.
+func (f *testForum) addPost(t *testing.T, user store.User, hide bool) int {
+	t.Helper()
+	postID, err := f.st.AddPost(user.UserID, "A post", "Its text", []string{"General"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hide {
+		if err := f.st.AddReport(user.UserID, store.TargetPost, postID, "test"); err != nil {
+			t.Fatal(err)
+		}
+		reports, err := f.st.GetOpenReports()
+		if err != nil || len(reports) == 0 {
+			t.Fatal("the report was not stored:", err)
+		}
+		if err := f.st.ResolveReport(reports[len(reports)-1].ReportID, user.UserID, store.DecisionHide, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return postID
+}
+
+// withToken returns a header authenticating with the token.
+func withToken(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
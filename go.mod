@@ -3,6 +3,7 @@ module forum
 go 1.19
 
 require (
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.17
 	golang.org/x/crypto v0.11.0
 )
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"forum/helpers"
+	"forum/store"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRegisterLoginLogout(t *testing.T) {
+	f := newTestForum(t)
+	c := f.client(t)
+	res := c.post("/register", url.Values{
+		"email":           {"carol@example.com"},
+		"username":        {"carol"},
+		"password":        {testPassword},
+		helpers.CSRFField: {c.csrfToken()},
+	})
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("registering: got %d, want 303", res.StatusCode)
+	}
+	if _, body := c.get("/"); !strings.Contains(body, "carol") {
+		t.Error("the home page does not show the new user as logged in")
+	}
+	if len(f.mailer.sent) != 1 || f.mailer.sent[0].To != "carol@example.com" {
+		t.Errorf("sent %+v, want one verification email to carol", f.mailer.sent)
+	}
+
+	res = c.post("/logout", url.Values{helpers.CSRFField: {c.csrfToken()}})
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("logging out: got %d, want 303", res.StatusCode)
+	}
+	if _, body := c.get("/"); strings.Contains(body, "carol") {
+		t.Error("still logged in after logging out")
+	}
+
+	c = f.client(t)
+	res = c.post("/login", url.Values{"username": {"carol"}, "password": {"wrong password"}, helpers.CSRFField: {c.csrfToken()}})
+	if res.StatusCode == http.StatusSeeOther {
+		t.Error("logged in with a wrong password")
+	}
+	f.login(t, "carol")
+}
+
+func TestRegisterRejectsDuplicates(t *testing.T) {
+	f := newTestForum(t)
+	f.addUser(t, "alice", "member")
+	c := f.client(t)
+	for _, form := range []url.Values{
+		{"email": {"other@example.com"}, "username": {"alice"}},
+		{"email": {"alice@example.com"}, "username": {"other"}},
+		{"email": {"not an email"}, "username": {"other"}},
+	} {
+		form.Set("password", testPassword)
+		form.Set(helpers.CSRFField, c.csrfToken())
+		if res := c.post("/register", form); res.StatusCode == http.StatusSeeOther {
+			t.Errorf("registered %s <%s>", form.Get("username"), form.Get("email"))
+		}
+	}
+}
+
+func TestPostCommentAndReact(t *testing.T) {
+	f := newTestForum(t)
+	f.addUser(t, "alice", "member")
+	f.addUser(t, "bob", "member")
+	alice := f.login(t, "alice")
+	bob := f.login(t, "bob")
+
+	res := alice.post("/add-post", url.Values{
+		"title":           {"Gardening"},
+		"content":         {"Tomatoes need sun"},
+		"categories[]":    {"General"},
+		helpers.CSRFField: {alice.csrfToken()},
+	})
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("posting: got %d, want 303", res.StatusCode)
+	}
+	postPath := res.Header.Get("Location")
+	var postID int
+	if _, err := fmt.Sscanf(postPath, "/post/%d", &postID); err != nil {
+		t.Fatalf("posting redirected to %q", postPath)
+	}
+
+	res = bob.postWith("/submit-comment", url.Values{
+		"postID":          {fmt.Sprint(postID)},
+		"comment":         {"And water"},
+		helpers.CSRFField: {bob.csrfToken()},
+	}, http.Header{"Referer": {f.URL + postPath}})
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("commenting: got %d, want 303", res.StatusCode)
+	}
+	res = bob.postWith("/update-reaction", url.Values{
+		"targetType":      {store.TargetPost},
+		"targetID":        {fmt.Sprint(postID)},
+		"action":          {fmt.Sprint(store.Like)},
+		helpers.CSRFField: {bob.csrfToken()},
+	}, http.Header{"Referer": {f.URL + postPath}})
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("reacting: got %d, want 303", res.StatusCode)
+	}
+
+	_, body := alice.get(postPath)
+	for _, want := range []string{"Gardening", "Tomatoes need sun", "And water"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the post page does not show %q", want)
+		}
+	}
+	post, err := f.st.GetPost(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Likes != 1 || post.CommentCount != 1 {
+		t.Errorf("the post has %d likes and %d comments, want 1 and 1", post.Likes, post.CommentCount)
+	}
+	if _, body := bob.get("/"); !strings.Contains(body, "Gardening") {
+		t.Error("the home page does not list the post")
+	}
+}
+
+func TestClosedPostsTakeNoCommentsOrReactions(t *testing.T) {
+	f := newTestForum(t)
+	alice := f.addUser(t, "alice", "member")
+	mod := f.addUser(t, "mod", "moderator")
+	hidden := f.addPost(t, alice, true)
+	c := f.login(t, "mod")
+
+	for _, postID := range []int{9999, hidden} {
+		res := c.post("/submit-comment", url.Values{
+			"postID":          {fmt.Sprint(postID)},
+			"comment":         {"Hello?"},
+			helpers.CSRFField: {c.csrfToken()},
+		})
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("commenting on post %d: got %d, want 404", postID, res.StatusCode)
+		}
+		res = c.post("/update-reaction", url.Values{
+			"targetType":      {store.TargetPost},
+			"targetID":        {fmt.Sprint(postID)},
+			"action":          {fmt.Sprint(store.Like)},
+			helpers.CSRFField: {c.csrfToken()},
+		})
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("reacting to post %d: got %d, want 404", postID, res.StatusCode)
+		}
+		if comments, _ := f.st.GetCommentsForPost(postID, 0, 5); len(comments) != 0 {
+			t.Errorf("post %d has %d comments", postID, len(comments))
+		}
+	}
+
+	// Moderators see the hidden post through the API, but cannot add to it.
+	header := withToken(f.addToken(t, mod, "read", "write", "moderate"))
+	header.Set("Content-Type", "application/json")
+	for _, tc := range []struct{ path, body string }{
+		{fmt.Sprintf("/api/v1/posts/%d/comments", hidden), `{"content": "Hello?"}`},
+		{"/api/v1/reactions", fmt.Sprintf(`{"target_type": "post", "target_id": %d, "reaction": "like"}`, hidden)},
+	} {
+		req, err := http.NewRequest(http.MethodPost, f.URL+tc.path, strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = header
+		if res, body := f.client(t).do(req); res.StatusCode != http.StatusConflict {
+			t.Errorf("POST %s: got %d %s, want 409", tc.path, res.StatusCode, body)
+		}
+	}
+	if post, _ := f.st.GetPost(hidden); post.CommentCount != 0 || post.Likes != 0 {
+		t.Errorf("the hidden post has %d comments and %d likes", post.CommentCount, post.Likes)
+	}
+}
+
+func TestEditPostKeepsRevisions(t *testing.T) {
+	f := newTestForum(t)
+	alice := f.addUser(t, "alice", "member")
+	f.addUser(t, "bob", "member")
+	postID := f.addPost(t, alice, false)
+	edit := func(c *testClient) *http.Response {
+		return c.post(fmt.Sprintf("/post/%d/edit", postID), url.Values{
+			"title":           {"A post"},
+			"content":         {"Its better text"},
+			"categories[]":    {"Help"},
+			helpers.CSRFField: {c.csrfToken()},
+		})
+	}
+
+	if res := edit(f.login(t, "bob")); res.StatusCode != http.StatusForbidden {
+		t.Errorf("editing another's post: got %d, want 403", res.StatusCode)
+	}
+	c := f.login(t, "alice")
+	if res := edit(c); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("editing: got %d, want 303", res.StatusCode)
+	}
+	_, body := c.get(fmt.Sprintf("/post/%d/revisions", postID))
+	if !strings.Contains(body, "better") {
+		t.Error("the revisions page does not show the added word")
+	}
+	post, err := f.st.GetPost(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Content != "Its better text" || len(post.Categories) != 1 || post.Categories[0].Category != "Help" {
+		t.Errorf("got %q in %v after the edit", post.Content, post.Categories)
+	}
+}
+
+func TestReportAndHide(t *testing.T) {
+	f := newTestForum(t)
+	alice := f.addUser(t, "alice", "member")
+	f.addUser(t, "bob", "member")
+	f.addUser(t, "mod", "moderator")
+	postID := f.addPost(t, alice, false)
+
+	bob := f.login(t, "bob")
+	res := bob.post("/report", url.Values{
+		"targetType":      {store.TargetPost},
+		"targetID":        {fmt.Sprint(postID)},
+		"reason":          {"Spam"},
+		helpers.CSRFField: {bob.csrfToken()},
+	})
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("reporting: got %d, want 303", res.StatusCode)
+	}
+	if res, _ := bob.get("/moderation"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("a member opening the queue: got %d, want 403", res.StatusCode)
+	}
+
+	reports, err := f.st.GetOpenReports()
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("got reports %+v (%v), want one", reports, err)
+	}
+	mod := f.login(t, "mod")
+	res = mod.post("/moderation/resolve", url.Values{
+		"reportID":        {fmt.Sprint(reports[0].ReportID)},
+		"decision":        {store.DecisionHide},
+		helpers.CSRFField: {mod.csrfToken()},
+	})
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("resolving: got %d, want 303", res.StatusCode)
+	}
+	path := fmt.Sprintf("/post/%d", postID)
+	if res, _ := bob.get(path); res.StatusCode != http.StatusNotFound {
+		t.Errorf("a member opening the hidden post: got %d, want 404", res.StatusCode)
+	}
+	if res, _ := mod.get(path); res.StatusCode != http.StatusOK {
+		t.Errorf("a moderator opening the hidden post: got %d, want 200", res.StatusCode)
+	}
+}
+
+func TestSubmitCommentChecksTheForm(t *testing.T) {
+	f := newTestForum(t)
+	alice := f.addUser(t, "alice", "member")
+	postID := f.addPost(t, alice, false)
+	c := f.login(t, "alice")
+
+	if res, _ := c.get(fmt.Sprintf("/submit-comment?postID=%d&comment=Hello", postID)); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %d, want 405", res.StatusCode)
+	}
+	for name, comment := range map[string]string{
+		"empty":    "",
+		"blank":    " \n\t ",
+		"too long": strings.Repeat("x", helpers.MaxCommentLength+1),
+	} {
+		res := c.post("/submit-comment", url.Values{
+			"postID":          {fmt.Sprint(postID)},
+			"comment":         {comment},
+			helpers.CSRFField: {c.csrfToken()},
+		})
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", name, res.StatusCode)
+		}
+	}
+	if comments, _ := f.st.GetCommentsForPost(postID, 0, 5); len(comments) != 0 {
+		t.Errorf("the post has comments %+v", comments)
+	}
+
+	c.post("/submit-comment", url.Values{
+		"postID":          {fmt.Sprint(postID)},
+		"comment":         {"  Hello  "},
+		helpers.CSRFField: {c.csrfToken()},
+	})
+	if comments, _ := f.st.GetCommentsForPost(postID, 0, 5); len(comments) != 1 || comments[0].Content != "Hello" {
+		t.Errorf("the post has comments %+v, want one saying Hello", comments)
+	}
+}
@@ -0,0 +1,677 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/auth"
+	"forum/events"
+	"forum/ranking"
+	"forum/store"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIPrefix is where the JSON API is served.
+const APIPrefix = "/api/v1/"
+
+const (
+	// MaxAPIPageSize is the largest page of posts the API hands out.
+	MaxAPIPageSize = 100
+	// MaxAPIBody is the largest request body the API reads.
+	MaxAPIBody = 1 << 20
+)
+
+// The JSON shapes of the API. They are kept apart from the store types so
+// the store can change without breaking clients.
+type (
+	apiError struct {
+		Error apiErrorBody `json:"error"`
+	}
+	apiErrorBody struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	apiCategory struct {
+		Slug        string `json:"slug"`
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Color       string `json:"color,omitempty"`
+	}
+	apiReaction struct {
+		Name  string `json:"name"`
+		Emoji string `json:"emoji"`
+		Count int    `json:"count"`
+	}
+	apiPost struct {
+		ID           int           `json:"id"`
+		Title        string        `json:"title"`
+		Content      string        `json:"content"`
+		Author       string        `json:"author"`
+		Categories   []apiCategory `json:"categories"`
+		CreatedAt    string        `json:"created_at"`
+		UpdatedAt    string        `json:"updated_at,omitempty"`
+		Hidden       bool          `json:"hidden,omitempty"`
+		Likes        int           `json:"likes"`
+		Dislikes     int           `json:"dislikes"`
+		CommentCount int           `json:"comment_count"`
+		Reactions    []apiReaction `json:"reactions"`
+		MyReaction   *string       `json:"my_reaction"` // null when the user has not reacted
+	}
+	apiComment struct {
+		ID         int           `json:"id"`
+		PostID     int           `json:"post_id"`
+		ParentID   int           `json:"parent_id,omitempty"`
+		Author     string        `json:"author"`
+		Content    string        `json:"content"`
+		CreatedAt  string        `json:"created_at"`
+		UpdatedAt  string        `json:"updated_at,omitempty"`
+		Deleted    bool          `json:"deleted,omitempty"`
+		Hidden     bool          `json:"hidden,omitempty"`
+		Reactions  []apiReaction `json:"reactions"`
+		MyReaction *string       `json:"my_reaction"`
+		ReplyCount int           `json:"reply_count"`
+		Replies    []apiComment  `json:"replies"`
+	}
+	apiCategoryList struct {
+		Categories []apiCategory `json:"categories"`
+	}
+	apiPostPage struct {
+		Posts      []apiPost `json:"posts"`
+		NextCursor string    `json:"next_cursor,omitempty"` // absent on the last page
+	}
+	apiPostWithComments struct {
+		apiPost
+		Comments []apiComment `json:"comments"`
+	}
+	apiUser struct {
+		ID        int    `json:"id"`
+		Username  string `json:"username"`
+		Email     string `json:"email"`
+		Role      string `json:"role"`
+		CreatedAt string `json:"created_at"`
+	}
+	apiReactionState struct {
+		TargetType string  `json:"target_type"`
+		TargetID   int     `json:"target_id"`
+		MyReaction *string `json:"my_reaction"`
+	}
+)
+
+// Request bodies.
+type (
+	apiNewPost struct {
+		Title      string   `json:"title"`
+		Content    string   `json:"content"`
+		Categories []string `json:"categories"` // slugs
+	}
+	apiNewComment struct {
+		Content  string `json:"content"`
+		ParentID int    `json:"parent_id,omitempty"` // 0 or absent for a top-level comment
+	}
+	apiNewReaction struct {
+		TargetType string `json:"target_type"`
+		TargetID   int    `json:"target_id"`
+		Reaction   string `json:"reaction"` // a reaction type's name
+	}
+)
+
+// APIHandler serves the JSON API:
+//
+//	GET  /api/v1/posts                  list posts
+//	POST /api/v1/posts                  create a post
+//	GET  /api/v1/posts/{id}             a post with its comments
+//	POST /api/v1/posts/{id}/comments    comment on a post
+//	POST /api/v1/reactions              react to a post or comment
+//	GET  /api/v1/categories             the categories posts can be filed under
+//	GET  /api/v1/me                     the logged-in user
+//
+// Every endpoint also accepts an API token in an "Authorization: Bearer"
+// header. GET and HEAD requests need the token's read scope; the others
+// need a scope covering the permission they check.
+func APIHandler(w http.ResponseWriter, r *http.Request, st store.Store, hot *ranking.Cache, bus *events.Bus) {
+	if user, scopes, ok := bearer(r); ok {
+		if reads(r) && !scopes.Has(auth.ScopeRead) {
+			writeAPIError(w, http.StatusForbidden, "insufficient_scope", "The API token lacks the read scope")
+			return
+		}
+		r = withTokenUser(r, user, scopes)
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, APIPrefix), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "posts":
+		switch r.Method {
+		case http.MethodGet:
+			apiListPosts(w, r, st, hot)
+		case http.MethodPost:
+			apiCreatePost(w, r, st)
+		default:
+			apiMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	case len(parts) == 2 && parts[0] == "posts":
+		if r.Method != http.MethodGet {
+			apiMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		apiGetPost(w, r, st, parts[1])
+	case len(parts) == 3 && parts[0] == "posts" && parts[2] == "comments":
+		if r.Method != http.MethodPost {
+			apiMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		apiCreateComment(w, r, st, bus, parts[1])
+	case len(parts) == 1 && parts[0] == "reactions":
+		if r.Method != http.MethodPost {
+			apiMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		apiReact(w, r, st, bus)
+	case len(parts) == 1 && parts[0] == "categories":
+		if r.Method != http.MethodGet {
+			apiMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		apiListCategories(w, st)
+	case len(parts) == 1 && parts[0] == "me":
+		if r.Method != http.MethodGet {
+			apiMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		apiMe(w, r, st)
+	default:
+		writeAPIError(w, http.StatusNotFound, "not_found", "No such API endpoint")
+	}
+}
+
+func apiListPosts(w http.ResponseWriter, r *http.Request, st store.Store, hot *ranking.Cache) {
+	query := r.URL.Query()
+	sort, filter, category := query.Get("sort"), query.Get("filter"), query.Get("category")
+	if sort == "" {
+		sort = store.SortNewest
+	}
+	if !store.ValidSort(sort) && sort != ranking.SortHot {
+		writeAPIError(w, http.StatusBadRequest, "invalid_sort", "Unknown sort order")
+		return
+	}
+	if filter != "" && filter != "my-likes" && filter != "my-posts" {
+		writeAPIError(w, http.StatusBadRequest, "invalid_filter", "filter must be my-likes or my-posts")
+		return
+	}
+	if sort == ranking.SortHot && (filter != "" || category != "") {
+		writeAPIError(w, http.StatusBadRequest, "invalid_filter", "The hot ranking cannot be filtered")
+		return
+	}
+	limit := PostsPerPage
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxAPIPageSize {
+			writeAPIError(w, http.StatusBadRequest, "invalid_limit", fmt.Sprintf("limit must be between 1 and %d", MaxAPIPageSize))
+			return
+		}
+	}
+
+	user, _ := GetLoggedInUser(r, st)
+	if filter != "" && user.Username == "" {
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", "Log in to filter by your own posts or likes")
+		return
+	}
+	page, err := loadPosts(st, hot, user, filter, category, store.ListOptions{Sort: sort, After: query.Get("after"), Limit: limit})
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_cursor", "The after cursor is not valid for this sort order")
+		return
+	} else if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	posts, err := newAPIPosts(st, user, page.Posts)
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiPostPage{Posts: posts, NextCursor: page.NextCursor})
+}
+
+func apiGetPost(w http.ResponseWriter, r *http.Request, st store.Store, postIDStr string) {
+	user, _ := GetLoggedInUser(r, st)
+	post, ok := apiVisiblePost(w, r, st, user, postIDStr)
+	if !ok {
+		return
+	}
+	posts, err := newAPIPosts(st, user, []store.Post{post})
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	comments, err := st.GetCommentsForPost(post.PostID, 0, MaxCommentDepth)
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	reactions, err := st.GetUserReactions(user.UserID, store.TargetComment, commentIDs(comments))
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiPostWithComments{
+		apiPost:  posts[0],
+		Comments: newAPIComments(r, comments, user, reactions),
+	})
+}
+
+func apiCreatePost(w http.ResponseWriter, r *http.Request, st store.Store) {
+	user, ok := apiRequire(w, r, st, auth.CreatePost)
+	if !ok {
+		return
+	}
+	var body apiNewPost
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	body.Title, body.Content = strings.TrimSpace(body.Title), strings.TrimSpace(body.Content)
+	if problem := checkPost(body.Title, body.Content); problem != "" {
+		writeAPIError(w, http.StatusBadRequest, "invalid_post", problem)
+		return
+	}
+	if len(body.Categories) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "invalid_post", "At least one category is required")
+		return
+	}
+	categories, err := st.GetCategories()
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	names := make([]string, 0, len(body.Categories))
+	for _, slug := range body.Categories {
+		name := ""
+		for _, category := range categories {
+			if category.Slug == slug {
+				name = category.Category
+			}
+		}
+		if name == "" {
+			writeAPIError(w, http.StatusBadRequest, "unknown_category", fmt.Sprintf("There is no category %q", slug))
+			return
+		}
+		names = append(names, name)
+	}
+
+	postID, err := st.AddPost(user.UserID, body.Title, body.Content, names)
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	post, err := st.GetPost(postID)
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	posts, err := newAPIPosts(st, user, []store.Post{post})
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%sposts/%d", APIPrefix, postID))
+	writeJSON(w, http.StatusCreated, posts[0])
+}
+
+func apiCreateComment(w http.ResponseWriter, r *http.Request, st store.Store, bus *events.Bus, postIDStr string) {
+	user, ok := apiRequire(w, r, st, auth.CreateComment)
+	if !ok {
+		return
+	}
+	post, ok := apiVisiblePost(w, r, st, user, postIDStr)
+	if !ok {
+		return
+	}
+	var body apiNewComment
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	body.Content = strings.TrimSpace(body.Content)
+	if body.Content == "" {
+		writeAPIError(w, http.StatusBadRequest, "invalid_comment", "content is required")
+		return
+	}
+	if problem := checkComment(body.Content); problem != "" {
+		writeAPIError(w, http.StatusBadRequest, "invalid_comment", problem)
+		return
+	}
+	if post.Hidden {
+		writeAPIError(w, http.StatusConflict, "hidden", "A hidden post takes no comments")
+		return
+	}
+
+	commentID, err := st.AddComment(post.PostID, user.UserID, body.ParentID, body.Content)
+	if errors.Is(err, store.ErrNotFound) && body.ParentID == 0 {
+		// Hidden or deleted since it was read
+		writeAPIError(w, http.StatusNotFound, "not_found", "There is no such post")
+		return
+	} else if errors.Is(err, store.ErrNotFound) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_comment", "parent_id is not a comment on this post")
+		return
+	} else if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	publishComment(bus, post.PostID, commentID)
+	comment, err := st.GetComment(commentID)
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	// Nobody has reacted to a new comment yet
+	types, err := st.GetReactionTypes()
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	for _, t := range types {
+		if t.Enabled {
+			comment.Reactions = append(comment.Reactions, store.ReactionCount{ReactionType: t})
+		}
+	}
+	w.Header().Set("Location", fmt.Sprintf("%sposts/%d", APIPrefix, post.PostID))
+	writeJSON(w, http.StatusCreated, newAPIComment(r, comment, user, nil))
+}
+
+func apiReact(w http.ResponseWriter, r *http.Request, st store.Store, bus *events.Bus) {
+	user, ok := apiRequire(w, r, st, auth.React)
+	if !ok {
+		return
+	}
+	var body apiNewReaction
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+
+	// The target has to be something the user can see, and not hidden
+	postID := body.TargetID
+	hidden := false
+	switch body.TargetType {
+	case store.TargetPost:
+	case store.TargetComment:
+		comment, err := st.GetComment(body.TargetID)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && comment.Deleted) {
+			writeAPIError(w, http.StatusNotFound, "not_found", "There is no such comment")
+			return
+		} else if err != nil {
+			apiDatabaseError(w, err)
+			return
+		}
+		postID = comment.PostID
+		hidden = comment.Hidden
+	default:
+		writeAPIError(w, http.StatusBadRequest, "invalid_reaction", "target_type must be post or comment")
+		return
+	}
+	post, ok := apiVisiblePost(w, r, st, user, strconv.Itoa(postID))
+	if !ok {
+		return
+	}
+	if hidden || post.Hidden {
+		writeAPIError(w, http.StatusConflict, "hidden", "A hidden post or comment takes no reactions")
+		return
+	}
+
+	types, err := st.GetReactionTypes()
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	reactionType := -1
+	for _, t := range types {
+		if t.Name == body.Reaction && t.Enabled {
+			reactionType = t.Type
+		}
+	}
+	if reactionType < 0 {
+		writeAPIError(w, http.StatusBadRequest, "invalid_reaction", fmt.Sprintf("There is no reaction %q", body.Reaction))
+		return
+	}
+
+	err = st.SetReaction(user.UserID, body.TargetType, body.TargetID, reactionType)
+	if errors.Is(err, store.ErrNotFound) {
+		// Hidden or deleted since it was read
+		writeAPIError(w, http.StatusNotFound, "not_found", "There is no such "+body.TargetType)
+		return
+	} else if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	publishReactions(bus, st, body.TargetType, body.TargetID)
+	reactions, err := st.GetUserReactions(user.UserID, body.TargetType, []int{body.TargetID})
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiReactionState{
+		TargetType: body.TargetType,
+		TargetID:   body.TargetID,
+		MyReaction: myReaction(types, reactions, body.TargetID),
+	})
+}
+
+func apiListCategories(w http.ResponseWriter, st store.Store) {
+	categories, err := st.GetCategories()
+	if err != nil {
+		apiDatabaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiCategoryList{Categories: newAPICategories(categories)})
+}
+
+func apiMe(w http.ResponseWriter, r *http.Request, st store.Store) {
+	user, err := GetLoggedInUser(r, st)
+	if err != nil {
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", "Not logged in")
+		return
+	}
+	writeJSON(w, http.StatusOK, apiUser{
+		ID:        user.UserID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      string(roleOf(r, user)),
+		CreatedAt: apiTime(user.CreatedAt),
+	})
+}
+
+// apiRequire returns the logged-in user when their role, and their token's
+// scopes if they came with one, hold the permission. Otherwise it answers
+// 401 or 403 like Require does.
+func apiRequire(w http.ResponseWriter, r *http.Request, st store.Store, permission auth.Permission) (store.User, bool) {
+	user, _ := GetLoggedInUser(r, st)
+	role := roleOf(r, user)
+	scopes, byToken := tokenScopes(r)
+	if role.Can(permission) && (!byToken || scopes.Allow(permission)) {
+		return user, true
+	}
+	if role.Can(permission) {
+		writeAPIError(w, http.StatusForbidden, "insufficient_scope", "The API token does not allow that")
+	} else if role == auth.Guest {
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", "Please log in first")
+	} else if role == auth.Unverified {
+		writeAPIError(w, http.StatusForbidden, "unverified_email", "Verify your email address first")
+	} else {
+		writeAPIError(w, http.StatusForbidden, "forbidden", "You do not have permission to do that")
+	}
+	return store.User{}, false
+}
+
+// apiVisiblePost loads a post the user may see, or answers 404.
+func apiVisiblePost(w http.ResponseWriter, r *http.Request, st store.Store, user store.User, postIDStr string) (store.Post, bool) {
+	postID, err := strconv.Atoi(postIDStr)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "not_found", "There is no such post")
+		return store.Post{}, false
+	}
+	post, err := st.GetPost(postID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !canSeePost(r, user, post)) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "There is no such post")
+		return store.Post{}, false
+	} else if err != nil {
+		apiDatabaseError(w, err)
+		return store.Post{}, false
+	}
+	return post, true
+}
+
+func newAPIPosts(st store.ReactionStore, user store.User, posts []store.Post) ([]apiPost, error) {
+	postIDs := make([]int, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.PostID
+	}
+	reactions, err := st.GetUserReactions(user.UserID, store.TargetPost, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	types, err := st.GetReactionTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	apiPosts := make([]apiPost, len(posts))
+	for i, post := range posts {
+		apiPosts[i] = apiPost{
+			ID:           post.PostID,
+			Title:        post.Title,
+			Content:      post.Content,
+			Author:       post.Username,
+			Categories:   newAPICategories(post.Categories),
+			CreatedAt:    apiTime(post.CreatedAt),
+			UpdatedAt:    apiTime(post.UpdatedAt),
+			Hidden:       post.Hidden,
+			Likes:        post.Likes,
+			Dislikes:     post.Dislikes,
+			CommentCount: post.CommentCount,
+			Reactions:    newAPIReactions(post.Reactions),
+			MyReaction:   myReaction(types, reactions, post.PostID),
+		}
+	}
+	return apiPosts, nil
+}
+
+func newAPIComments(r *http.Request, comments []store.Comment, user store.User, reactions map[int]int) []apiComment {
+	apiComments := make([]apiComment, len(comments))
+	for i, comment := range comments {
+		apiComments[i] = newAPIComment(r, comment, user, reactions)
+	}
+	return apiComments
+}
+
+func newAPIComment(r *http.Request, comment store.Comment, user store.User, reactions map[int]int) apiComment {
+	// Same rules as the comment template
+	content := comment.Content
+	if comment.Deleted || (comment.Hidden && !can(r, user, auth.ModerateContent)) {
+		content = ""
+	}
+	apiComment := apiComment{
+		ID:         comment.CommentID,
+		PostID:     comment.PostID,
+		ParentID:   comment.ParentID,
+		Author:     comment.Username,
+		Content:    content,
+		CreatedAt:  apiTime(comment.CreatedAt),
+		UpdatedAt:  apiTime(comment.UpdatedAt),
+		Deleted:    comment.Deleted,
+		Hidden:     comment.Hidden,
+		Reactions:  newAPIReactions(comment.Reactions),
+		ReplyCount: comment.ReplyCount,
+		Replies:    newAPIComments(r, comment.Replies, user, reactions),
+	}
+	if comment.Deleted {
+		apiComment.Author = ""
+	}
+	if reactionType, ok := reactions[comment.CommentID]; ok {
+		for _, reaction := range comment.Reactions {
+			if reaction.Type == reactionType {
+				name := reaction.Name
+				apiComment.MyReaction = &name
+			}
+		}
+	}
+	return apiComment
+}
+
+func newAPICategories(categories []store.Category) []apiCategory {
+	apiCategories := make([]apiCategory, len(categories))
+	for i, category := range categories {
+		apiCategories[i] = apiCategory{
+			Slug:        category.Slug,
+			Name:        category.Category,
+			Description: category.Description,
+			Color:       category.Color,
+		}
+	}
+	return apiCategories
+}
+
+func newAPIReactions(counts []store.ReactionCount) []apiReaction {
+	reactions := make([]apiReaction, len(counts))
+	for i, count := range counts {
+		reactions[i] = apiReaction{Name: count.Name, Emoji: count.Emoji, Count: count.Count}
+	}
+	return reactions
+}
+
+// myReaction names the user's reaction to a target, or is nil.
+func myReaction(types []store.ReactionType, reactions map[int]int, targetID int) *string {
+	reactionType, ok := reactions[targetID]
+	if !ok {
+		return nil
+	}
+	for _, t := range types {
+		if t.Type == reactionType {
+			name := t.Name
+			return &name
+		}
+	}
+	return nil
+}
+
+// apiTime turns a timestamp as the database drivers return it into
+// RFC 3339. Empty stays empty.
+func apiTime(value string) string {
+	if t, ok := parseDate(value); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return value
+}
+
+// decodeJSON reads the request body into dst, or answers 400.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxAPIBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_json", "The request body is not valid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Error writing JSON response:", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiError{Error: apiErrorBody{Code: code, Message: message}})
+}
+
+func apiDatabaseError(w http.ResponseWriter, err error) {
+	log.Println("Database error:", err)
+	writeAPIError(w, http.StatusInternalServerError, "internal", "Internal Server Error")
+}
+
+func apiMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+}
@@ -0,0 +1,111 @@
+package helpers
+
+import (
+	"fmt"
+	"forum/auth"
+	"forum/ranking"
+	"forum/routes"
+	"forum/store"
+	"net/http"
+)
+
+func apiErrorResponse(status int, description string) routes.Response {
+	return routes.JSON(status, description, apiError{})
+}
+
+var (
+	apiUnauthorized = apiErrorResponse(http.StatusUnauthorized, "Not logged in, or the API token is unknown or revoked")
+	apiForbidden    = apiErrorResponse(http.StatusForbidden, "The role or the API token's scopes lack the permission")
+	apiBadJSON      = apiErrorResponse(http.StatusBadRequest, "The body is not valid JSON, has unknown fields or fails validation")
+	apiNotFound     = apiErrorResponse(http.StatusNotFound, "There is no such post, or it is hidden")
+)
+
+// APIRoutes describes the endpoints served by APIHandler.
+var APIRoutes = []routes.Route{
+	{
+		Method:  http.MethodGet,
+		Path:    APIPrefix + "posts",
+		Summary: "List posts",
+		Description: "A page of posts in the chosen order. Pass the next_cursor of a page as after to get the next one; " +
+			"it is left out on the last page. The hot order cannot be filtered.",
+		Auth: routes.SessionOrToken,
+		Params: []routes.Param{
+			routes.QueryParam("sort", "The order of the posts").OneOf(store.SortNewest, store.SortOldest,
+				store.SortMostLiked, store.SortMostCommented, store.SortActive, ranking.SortHot),
+			routes.QueryParam("after", "The next_cursor of the previous page"),
+			routes.QueryParam("category", "Only posts filed under the category with this slug"),
+			routes.QueryParam("filter", "Only the logged-in user's liked or created posts").OneOf("my-likes", "my-posts"),
+			routes.QueryParam("limit", fmt.Sprintf("Posts per page, at most %d; %d by default", MaxAPIPageSize, PostsPerPage)).Int(),
+		},
+		Responses: []routes.Response{
+			routes.JSON(http.StatusOK, "A page of posts", apiPostPage{}),
+			apiErrorResponse(http.StatusBadRequest, "An unknown sort, filter or limit, or a cursor made for another sort"),
+			apiErrorResponse(http.StatusUnauthorized, "A my-* filter without being logged in"),
+		},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       APIPrefix + "posts",
+		Summary:    "Create a post",
+		Auth:       routes.SessionOrToken,
+		Permission: auth.CreatePost,
+		JSONBody:   apiNewPost{},
+		Responses: []routes.Response{
+			routes.JSON(http.StatusCreated, "The new post; Location names it", apiPost{}),
+			apiBadJSON, apiUnauthorized, apiForbidden,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    APIPrefix + "posts/{id}",
+		Summary: "Get a post with its comments",
+		Description: fmt.Sprintf("Comments come as trees of replies at most %d levels deep. "+
+			"Deleted comments and, for everybody but moderators, hidden ones have no content.", MaxCommentDepth),
+		Auth:      routes.SessionOrToken,
+		Params:    []routes.Param{routes.PathParam("id", "The post's ID").Int()},
+		Responses: []routes.Response{routes.JSON(http.StatusOK, "The post", apiPostWithComments{}), apiNotFound},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       APIPrefix + "posts/{id}/comments",
+		Summary:    "Comment on a post",
+		Auth:       routes.SessionOrToken,
+		Permission: auth.CreateComment,
+		Params:     []routes.Param{routes.PathParam("id", "The post's ID").Int()},
+		JSONBody:   apiNewComment{},
+		Responses: []routes.Response{
+			routes.JSON(http.StatusCreated, "The new comment; Location names its post", apiComment{}),
+			apiBadJSON, apiUnauthorized, apiForbidden, apiNotFound,
+			apiErrorResponse(http.StatusConflict, "The post is hidden"),
+		},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        APIPrefix + "reactions",
+		Summary:     "React to a post or comment",
+		Description: "Replaces the user's earlier reaction to the same target; sending the current reaction again takes it back.",
+		Auth:        routes.SessionOrToken,
+		Permission:  auth.React,
+		JSONBody:    apiNewReaction{},
+		Responses: []routes.Response{
+			routes.JSON(http.StatusOK, "The user's reaction now", apiReactionState{}),
+			apiBadJSON, apiUnauthorized, apiForbidden,
+			apiErrorResponse(http.StatusNotFound, "There is no such post or comment"),
+			apiErrorResponse(http.StatusConflict, "The post or comment is hidden"),
+		},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      APIPrefix + "categories",
+		Summary:   "List the categories posts can be filed under",
+		Auth:      routes.SessionOrToken,
+		Responses: []routes.Response{routes.JSON(http.StatusOK, "The categories in their sort order", apiCategoryList{})},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      APIPrefix + "me",
+		Summary:   "Get the logged-in user",
+		Auth:      routes.SessionOrToken,
+		Responses: []routes.Response{routes.JSON(http.StatusOK, "The user", apiUser{}), apiUnauthorized},
+	},
+}
@@ -0,0 +1,180 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"forum/store"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxCategoryName is the longest category name, in characters.
+const MaxCategoryName = 50
+
+var (
+	slugPattern  = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// checkCategories reports whether every name is a category new posts can be
+// filed under.
+func checkCategories(st store.CategoryStore, names []string) (bool, error) {
+	categories, err := st.GetCategories()
+	if err != nil {
+		return false, err
+	}
+	active := map[string]bool{}
+	for _, category := range categories {
+		active[category.Category] = true
+	}
+	for _, name := range names {
+		if !active[name] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// AdminCategoriesHandler serves the category admin pages:
+// /admin/categories lists the categories and adds new ones, and
+// /admin/categories/{id}/edit, /retire, /restore and /merge change one.
+func AdminCategoriesHandler(w http.ResponseWriter, r *http.Request, st store.Store) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/categories"), "/")
+	if rest == "" {
+		if r.Method == http.MethodPost {
+			addCategory(w, r, st)
+		} else {
+			adminCategoriesPage(w, r, st)
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	categoryIDStr, action, _ := strings.Cut(rest, "/")
+	categoryID, err := strconv.Atoi(categoryIDStr)
+	if err != nil {
+		errorHandler(w, "Invalid category ID", 400)
+		return
+	}
+
+	switch action {
+	case "edit":
+		category, ok := categoryFromForm(w, r)
+		if !ok {
+			return
+		}
+		category.CategoryID = categoryID
+		err = st.UpdateCategory(category)
+	case "retire":
+		err = st.SetCategoryRetired(categoryID, true)
+	case "restore":
+		err = st.SetCategoryRetired(categoryID, false)
+	case "merge":
+		targetID, convErr := strconv.Atoi(r.FormValue("into"))
+		if convErr != nil || targetID == categoryID {
+			http.Error(w, "Choose another category to merge into", http.StatusBadRequest)
+			return
+		}
+		err = st.MergeCategory(categoryID, targetID)
+	default:
+		errorHandler(w, "Page not found", 404)
+		return
+	}
+	if !saveCategoryResult(w, err) {
+		return
+	}
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+func adminCategoriesPage(w http.ResponseWriter, r *http.Request, st store.Store) {
+	categories, err := st.GetAllCategories()
+	if err != nil {
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+
+	user, _ := GetLoggedInUser(r, st)
+	data := struct {
+		Categories []store.Category
+		Header     HeaderData
+	}{
+		Categories: categories,
+		Header:     newHeaderData(r, user),
+	}
+	if err := render(w, r, "admin-categories", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
+
+func addCategory(w http.ResponseWriter, r *http.Request, st store.Store) {
+	category, ok := categoryFromForm(w, r)
+	if !ok {
+		return
+	}
+	_, err := st.AddCategory(category)
+	if !saveCategoryResult(w, err) {
+		return
+	}
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// categoryFromForm reads and checks the fields of a category form, writing
+// the error response when they are invalid. An empty slug is made from the
+// name.
+func categoryFromForm(w http.ResponseWriter, r *http.Request) (store.Category, bool) {
+	category := store.Category{
+		Category:    strings.TrimSpace(r.FormValue("name")),
+		Slug:        strings.TrimSpace(r.FormValue("slug")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Color:       strings.TrimSpace(r.FormValue("color")),
+	}
+	if category.Category == "" || utf8.RuneCountInString(category.Category) > MaxCategoryName {
+		http.Error(w, fmt.Sprintf("The name is required and can be at most %d characters long", MaxCategoryName), http.StatusBadRequest)
+		return store.Category{}, false
+	}
+	if category.Slug == "" {
+		category.Slug = store.Slugify(category.Category)
+	}
+	// "all" already means every category in the post filter
+	if !slugPattern.MatchString(category.Slug) || category.Slug == "all" {
+		http.Error(w, "The slug can only hold lower case letters, digits and single dashes", http.StatusBadRequest)
+		return store.Category{}, false
+	}
+	if category.Color != "" && !colorPattern.MatchString(category.Color) {
+		http.Error(w, "The color must look like #256d5a", http.StatusBadRequest)
+		return store.Category{}, false
+	}
+	if sortOrder := strings.TrimSpace(r.FormValue("sortOrder")); sortOrder != "" {
+		var err error
+		category.SortOrder, err = strconv.Atoi(sortOrder)
+		if err != nil {
+			http.Error(w, "The sort order must be a whole number", http.StatusBadRequest)
+			return store.Category{}, false
+		}
+	}
+	return category, true
+}
+
+// saveCategoryResult writes the error response for a failed change to a
+// category and reports whether it succeeded.
+func saveCategoryResult(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, store.ErrNotFound):
+		errorHandler(w, "We cannot find this category", 404)
+	case errors.Is(err, store.ErrDuplicate):
+		http.Error(w, "Another category already has this name or slug", http.StatusConflict)
+	default:
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println("Database error:", err)
+	}
+	return false
+}
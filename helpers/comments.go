@@ -0,0 +1,196 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"forum/auth"
+	"forum/store"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxCommentDepth is how many levels of replies the post page shows before
+// linking to the rest of the thread.
+const MaxCommentDepth = 5
+
+// MaxCommentLength is the longest text a comment may have, in characters:
+// the same as a post.
+const MaxCommentLength = MaxPostLength
+
+// checkComment returns what is wrong with the text of a comment, or "" when
+// nothing is.
+func checkComment(content string) string {
+	switch {
+	case content == "":
+		return "Comment cannot be empty"
+	case utf8.RuneCountInString(content) > MaxCommentLength:
+		return fmt.Sprintf("The comment can be at most %d characters long", MaxCommentLength)
+	}
+	return ""
+}
+
+// CollapseRepliesOver is the number of direct replies above which a thread
+// starts out collapsed.
+const CollapseRepliesOver = 3
+
+// CommentView is a comment together with what the recursive "comment"
+// template needs to render its reply and report forms.
+type CommentView struct {
+	store.Comment
+	Replies     []CommentView
+	PostID      int
+	LoggedIn    bool
+	CanEdit     bool
+	Moderator   bool // moderators still see what hidden comments say
+	ReactionBar ReactionBar
+}
+
+// Collapsed reports whether the replies start out hidden.
+func (c CommentView) Collapsed() bool {
+	return len(c.Replies) > CollapseRepliesOver
+}
+
+// newCommentViews wraps comments for the template; reactions holds the
+// logged-in user's reactions to them by comment ID.
+func newCommentViews(r *http.Request, comments []store.Comment, postID int, user store.User, reactions map[int]int) []CommentView {
+	views := make([]CommentView, 0, len(comments))
+	moderator := can(r, user, auth.ModerateContent)
+	for _, comment := range comments {
+		if comment.Hidden && !moderator {
+			comment.Content = ""
+		}
+		views = append(views, CommentView{
+			Comment:     comment,
+			Replies:     newCommentViews(r, comment.Replies, postID, user, reactions),
+			PostID:      postID,
+			LoggedIn:    user.Username != "",
+			CanEdit:     canEditComment(r, user, comment),
+			Moderator:   moderator,
+			ReactionBar: newReactionBar(store.TargetComment, comment.CommentID, comment.Reactions, reactions),
+		})
+	}
+	return views
+}
+
+// canEditComment reports whether the logged-in user may edit or delete a
+// comment: its author, moderators and admins may, until it is deleted.
+func canEditComment(r *http.Request, user store.User, comment store.Comment) bool {
+	if comment.Deleted {
+		return false
+	}
+	if can(r, user, auth.EditAnyContent) {
+		return true
+	}
+	return can(r, user, auth.EditOwnContent) && user.Username == comment.Username
+}
+
+// CommentHandler serves /comment/{id}/edit and /comment/{id}/delete.
+func CommentHandler(w http.ResponseWriter, r *http.Request, st store.Store) {
+	commentIDStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/comment/"), "/")
+	commentID, err := strconv.Atoi(commentIDStr)
+	if err != nil {
+		errorHandler(w, "Invalid comment ID", 400)
+		return
+	}
+
+	switch action {
+	case "edit":
+		EditCommentHandler(w, r, st, commentID)
+	case "delete":
+		DeleteCommentHandler(w, r, st, commentID)
+	default:
+		errorHandler(w, "Page not found", 404)
+	}
+}
+
+// EditCommentHandler shows the edit form on GET and saves the edit on POST.
+func EditCommentHandler(w http.ResponseWriter, r *http.Request, st store.Store, commentID int) {
+	user, comment, ok := commentForEditing(w, r, st, commentID)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		data := struct {
+			Comment store.Comment
+			Header  HeaderData
+		}{
+			Comment: comment,
+			Header:  newHeaderData(r, user),
+		}
+		if err := render(w, r, "edit-comment", data); err != nil {
+			errorHandler(w, "Internal server error", 500)
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	content := strings.TrimSpace(r.FormValue("comment"))
+	if problem := checkComment(content); problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	err := st.UpdateComment(commentID, content)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println("Database error:", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/%d#comment-%d", comment.PostID, commentID), http.StatusSeeOther)
+}
+
+func DeleteCommentHandler(w http.ResponseWriter, r *http.Request, st store.Store, commentID int) {
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, comment, ok := commentForEditing(w, r, st, commentID)
+	if !ok {
+		return
+	}
+
+	err := st.DeleteComment(commentID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println("Database error:", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/%d#comment-%d", comment.PostID, commentID), http.StatusSeeOther)
+}
+
+// commentForEditing loads a comment and checks that the logged-in user may
+// change it, writing the error response when they may not.
+func commentForEditing(w http.ResponseWriter, r *http.Request, st store.Store, commentID int) (store.User, store.Comment, bool) {
+	user, err := GetLoggedInUser(r, st)
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return store.User{}, store.Comment{}, false
+	}
+
+	comment, err := st.GetComment(commentID)
+	if errors.Is(err, store.ErrNotFound) {
+		errorHandler(w, "We cannot find this comment", 404)
+		return store.User{}, store.Comment{}, false
+	} else if err != nil {
+		log.Println("Error retrieving comment:", err)
+		errorHandler(w, "Error retrieving comment", 500)
+		return store.User{}, store.Comment{}, false
+	}
+
+	if !canEditComment(r, user, comment) {
+		errorHandler(w, "You cannot change this comment", http.StatusForbidden)
+		return store.User{}, store.Comment{}, false
+	}
+	return user, comment, true
+}
@@ -0,0 +1,187 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"forum/sessions"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sync"
+)
+
+// CSRFField is the form field, and CSRFHeader the header for scripts, that
+// carry the CSRF token of a state-changing request.
+const (
+	CSRFField  = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// csrfCookie holds a random secret for visitors without a session, so the
+// login and registration forms are protected too.
+const csrfCookie = "csrf_secret"
+
+// CSRF refuses state-changing requests that do not carry the CSRF token of
+// the session they are made in, so other sites cannot post forms on a
+// logged-in user's behalf. Requests the Tokens middleware authenticated with
+// an API token, which have no session, and requests with a JSON body are
+// let through: browsers only send JSON cross-site after a CORS preflight,
+// which the forum never allows. Any other Authorization header does not
+// exempt a request.
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, _, ok := bearer(r); ok || isJSON(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := r.Header.Get(CSRFHeader)
+		if token == "" {
+			token = r.PostFormValue(CSRFField)
+		}
+		if !validCSRFToken(r, token) {
+			errorHandler(w, "This form has expired. Go back, reload the page and try again.", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// csrfSecrets returns the secrets a request's token may be derived from:
+// the session token, and the visitor's secret from before they logged in.
+func csrfSecrets(r *http.Request) []string {
+	var secrets []string
+	for _, name := range []string{sessions.CookieName, csrfCookie} {
+		if cookie, err := r.Cookie(name); err == nil && cookie.Value != "" {
+			secrets = append(secrets, cookie.Value)
+		}
+	}
+	return secrets
+}
+
+func validCSRFToken(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, secret := range csrfSecrets(r) {
+		if hmac.Equal([]byte(token), []byte(deriveCSRFToken(secret))) {
+			return true
+		}
+	}
+	return false
+}
+
+// deriveCSRFToken makes the token from a secret. Pages show the token, and
+// the secret cannot be recovered from it.
+func deriveCSRFToken(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("csrf"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// csrfToken returns the token for the forms of a page: the session's when
+// the visitor has one, and otherwise that of a secret given to the visitor
+// in a cookie. It has to be called before the response is written.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if secrets := csrfSecrets(r); len(secrets) > 0 {
+		return deriveCSRFToken(secrets[0])
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Println("Error generating a CSRF secret:", err)
+		return ""
+	}
+	cookie := &http.Cookie{
+		Name:     csrfCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(secret),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, cookie)
+	// Later calls for the same request find it
+	r.AddCookie(cookie)
+	return deriveCSRFToken(cookie.Value)
+}
+
+// clearCSRFSecret drops the visitor's secret once they have a session, so
+// tokens from before the login stop working.
+func clearCSRFSecret(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+}
+
+// pageTemplate is a copy of the templates whose csrfField function gives
+// the token of the request executing it. A copy serves one request at a
+// time and is kept for the next one, so its templates are escaped once.
+type pageTemplate struct {
+	*template.Template
+	token string
+}
+
+var pageTemplates = sync.Pool{
+	New: func() interface{} {
+		page := &pageTemplate{}
+		page.Template = template.Must(tmpl.Clone()).Funcs(template.FuncMap{
+			"csrfField": page.csrfField,
+		})
+		return page
+	},
+}
+
+// csrfField is the hidden field every form that posts starts with. The token
+// is base64url, so it needs no escaping.
+func (p *pageTemplate) csrfField() template.HTML {
+	return template.HTML(`<input type="hidden" name="` + CSRFField + `" value="` + p.token + `">`)
+}
+
+// noCSRFField stands in for csrfField in tmpl, which is only cloned and
+// never executed itself.
+func noCSRFField() (template.HTML, error) {
+	return "", errors.New("templates must be executed with executeTemplate")
+}
+
+// executeTemplate executes a template with token in the csrfField of its
+// forms.
+func executeTemplate(w io.Writer, name string, data interface{}, token string) error {
+	page := pageTemplates.Get().(*pageTemplate)
+	defer pageTemplates.Put(page)
+	page.token = token
+	return page.ExecuteTemplate(w, name, data)
+}
+
+// render executes a page template for the request, with the CSRF token in
+// every form of the page. Nothing is written when the template fails, so the
+// caller can still answer with an error page.
+func render(w http.ResponseWriter, r *http.Request, name string, data interface{}) error {
+	var page bytes.Buffer
+	if err := executeTemplate(&page, name, data, csrfToken(w, r)); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(page.Bytes()); err != nil {
+		log.Println("Error writing page:", err)
+	}
+	return nil
+}
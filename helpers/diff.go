@@ -0,0 +1,126 @@
+package helpers
+
+import "strings"
+
+// DiffPart is a run of words that is unchanged, added or removed between
+// two versions of a text.
+type DiffPart struct {
+	Text    string
+	Added   bool
+	Removed bool
+}
+
+// maxDiffWork bounds the work of a diff: when the changed middles of two
+// texts, between the words they start and end with, make more word pairs
+// than this, the old middle is shown as replaced by the new one.
+const maxDiffWork = 4000000
+
+// DiffWords compares two texts word by word using their longest common
+// subsequence and returns the parts in reading order. The subsequence is
+// found with Hirschberg's algorithm, in memory linear in the texts' length.
+func DiffWords(oldText, newText string) []DiffPart {
+	a := strings.Fields(oldText)
+	b := strings.Fields(newText)
+
+	var d differ
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	d.add(a[:prefix], false, false)
+	oldMiddle, newMiddle := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(oldMiddle)*len(newMiddle) > maxDiffWork {
+		d.add(oldMiddle, false, true)
+		d.add(newMiddle, true, false)
+	} else {
+		d.diff(oldMiddle, newMiddle)
+	}
+	d.add(a[len(a)-suffix:], false, false)
+	return d.parts
+}
+
+// differ collects the parts of a diff, joining runs of the same kind.
+type differ struct {
+	parts []DiffPart
+}
+
+func (d *differ) add(words []string, added, removed bool) {
+	if len(words) == 0 {
+		return
+	}
+	text := strings.Join(words, " ")
+	if n := len(d.parts); n > 0 && d.parts[n-1].Added == added && d.parts[n-1].Removed == removed {
+		d.parts[n-1].Text += " " + text
+		return
+	}
+	d.parts = append(d.parts, DiffPart{Text: text, Added: added, Removed: removed})
+}
+
+// diff adds the parts that turn a into b. It splits a in half and b where
+// the longest common subsequences of the halves add up to the longest, and
+// diffs the two halves on their own.
+func (d *differ) diff(a, b []string) {
+	switch {
+	case len(a) == 0:
+		d.add(b, true, false)
+		return
+	case len(b) == 0:
+		d.add(a, false, true)
+		return
+	case len(a) == 1:
+		for j, word := range b {
+			if word == a[0] {
+				d.add(b[:j], true, false)
+				d.add(a, false, false)
+				d.add(b[j+1:], true, false)
+				return
+			}
+		}
+		d.add(a, false, true)
+		d.add(b, true, false)
+		return
+	}
+
+	mid := len(a) / 2
+	forward := lcsLengths(a[:mid], b, false)
+	backward := lcsLengths(a[mid:], b, true)
+	split, best := 0, -1
+	for j := 0; j <= len(b); j++ {
+		if n := forward[j] + backward[len(b)-j]; n > best {
+			split, best = j, n
+		}
+	}
+	d.diff(a[:mid], b[:split])
+	d.diff(a[mid:], b[split:])
+}
+
+// lcsLengths returns, for every j, the length of the longest common
+// subsequence of a and the first j words of b, or of the last j words of
+// both when reverse is set. It keeps two rows of the table.
+func lcsLengths(a, b []string, reverse bool) []int {
+	word := func(s []string, i int) string {
+		if reverse {
+			return s[len(s)-1-i]
+		}
+		return s[i]
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if word(a, i) == word(b, j) {
+				cur[j+1] = prev[j] + 1
+			} else if prev[j+1] >= cur[j] {
+				cur[j+1] = prev[j+1]
+			} else {
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
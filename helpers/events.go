@@ -0,0 +1,163 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/events"
+	"forum/store"
+	"log"
+	"net/http"
+	"time"
+)
+
+// EventsKeepAlive is how often an idle event stream sends a comment line,
+// so proxies keep it open and closed connections are noticed.
+const EventsKeepAlive = 30 * time.Second
+
+// The data of the events sent to post pages.
+type (
+	commentEvent struct {
+		ID       int    `json:"id"`
+		ParentID int    `json:"parent_id"`
+		HTML     string `json:"html"` // the comment rendered for the watching user
+	}
+	reactionsEvent struct {
+		TargetType string          `json:"target_type"`
+		TargetID   int             `json:"target_id"`
+		Counts     []reactionCount `json:"counts"`
+	}
+	reactionCount struct {
+		Type  int `json:"type"`
+		Count int `json:"count"`
+	}
+)
+
+// PostEventsHandler streams the new comments and reaction counts of a post
+// as server-sent events, at /post/{id}/events, for as long as the client
+// stays connected.
+func PostEventsHandler(w http.ResponseWriter, r *http.Request, st store.Store, bus *events.Bus, postID int) {
+	post, err := st.GetPost(postID)
+	if errors.Is(err, store.ErrNotFound) {
+		errorHandler(w, "We cannot find this post", 404)
+		return
+	} else if err != nil {
+		log.Println("Error retrieving post:", err)
+		errorHandler(w, "Error retrieving post", 500)
+		return
+	}
+	user, _ := GetLoggedInUser(r, st)
+	if !canSeePost(r, user, post) {
+		errorHandler(w, "We cannot find this post", 404)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errorHandler(w, "Streaming is not supported", 500)
+		return
+	}
+
+	subscription, unsubscribe := bus.Subscribe(postID)
+	defer unsubscribe()
+
+	// Comments come with forms, which need the token of the watcher's pages
+	token := csrfToken(w, r)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(EventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-subscription:
+			data, err := eventData(r, st, user, token, event)
+			if err != nil {
+				log.Println("Error preparing event:", err)
+				continue
+			}
+			payload, err := json.Marshal(data)
+			if err != nil {
+				log.Println("Error preparing event:", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, payload)
+		}
+		flusher.Flush()
+	}
+}
+
+// eventData is what a post page watched by the user needs to show the
+// event.
+func eventData(r *http.Request, st store.Store, user store.User, csrfToken string, event events.Event) (interface{}, error) {
+	if event.Kind == events.KindReactions {
+		data := reactionsEvent{TargetType: event.TargetType, TargetID: event.TargetID}
+		for _, reaction := range event.Reactions {
+			data.Counts = append(data.Counts, reactionCount{Type: reaction.Type, Count: reaction.Count})
+		}
+		return data, nil
+	}
+
+	// The comment is rendered for each watcher, since their role decides
+	// which links it shows
+	comments, err := st.GetCommentsForPost(event.PostID, event.CommentID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return nil, store.ErrNotFound
+	}
+	var html bytes.Buffer
+	views := newCommentViews(r, comments, event.PostID, user, nil)
+	if err := executeTemplate(&html, "comment", views[0], csrfToken); err != nil {
+		return nil, err
+	}
+	return commentEvent{
+		ID:       event.CommentID,
+		ParentID: comments[0].ParentID,
+		HTML:     html.String(),
+	}, nil
+}
+
+// publishComment tells the watchers of a post about a new comment.
+func publishComment(bus *events.Bus, postID, commentID int) {
+	bus.Publish(events.Event{Kind: events.KindComment, PostID: postID, CommentID: commentID})
+}
+
+// publishReactions sends the reaction counts of a post or comment to the
+// watchers of the post. The reaction itself is saved by then, so errors are
+// only logged.
+func publishReactions(bus *events.Bus, st store.Store, targetType string, targetID int) {
+	postID := targetID
+	if targetType == store.TargetComment {
+		comment, err := st.GetComment(targetID)
+		if err != nil {
+			log.Println("Database error:", err)
+			return
+		}
+		postID = comment.PostID
+	}
+	if bus.Subscribers(postID) == 0 {
+		return
+	}
+	counts, err := st.GetReactionCounts(targetType, []int{targetID})
+	if err != nil {
+		log.Println("Database error:", err)
+		return
+	}
+	bus.Publish(events.Event{
+		Kind:       events.KindReactions,
+		PostID:     postID,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Reactions:  counts[targetID],
+	})
+}
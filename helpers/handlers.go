@@ -1,86 +1,209 @@
 package helpers
 
 import (
-	"crypto/rand"
-	"database/sql"
-	"encoding/base64"
+	"errors"
 	"fmt"
+	"forum/auth"
+	"forum/events"
+	"forum/ranking"
+	"forum/sessions"
+	"forum/store"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var tmpl *template.Template
 
 func init() {
-	tmpl = template.Must(template.ParseGlob("frontend/*.html"))
+	tmpl = template.Must(template.New("").Funcs(template.FuncMap{
+		"date":      formatDate,
+		"csrfField": noCSRFField,
+	}).ParseGlob("frontend/*.html"))
+}
+
+// formatDate turns a timestamp as the database drivers return it into a
+// short human-readable form.
+func formatDate(value string) string {
+	if t, ok := parseDate(value); ok {
+		return t.Format("2 Jan 2006 15:04")
+	}
+	return value
+}
+
+// parseDate reads a timestamp in any of the forms the stores return.
+func parseDate(value string) (time.Time, bool) {
+	layouts := []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05 MST", "2006-01-02 15:04:05"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
 }
 
 type HeaderData struct {
 	LoggedInUser string
+	Moderator    bool // links to the moderation queue
+	Admin        bool // links to the category admin
+	Unverified   bool // asks the user to verify their email
+	TwoFactor    bool // asks the user to turn on two-factor authentication
+}
+
+func newHeaderData(r *http.Request, user store.User) HeaderData {
+	return HeaderData{
+		LoggedInUser: user.Username,
+		Moderator:    roleOf(r, user).Can(auth.ModerateContent),
+		Admin:        roleOf(r, user).Can(auth.ManageCategories),
+		Unverified:   user.Username != "" && !user.EmailVerified,
+		TwoFactor:    needsTwoFactor(r, user),
+	}
 }
 
-func IndexHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+// PostsPerPage is how many posts a page of the index shows.
+const PostsPerPage = 20
+
+// SortLink is one entry of the sort selector on the index page.
+type SortLink struct {
+	Name    string
+	URL     string
+	Current bool
+}
+
+func IndexHandler(w http.ResponseWriter, r *http.Request, st store.Store, hot *ranking.Cache) {
 	// Retrieve the filter parameters from the query string
 	filter := r.URL.Query().Get("filter")
 	category := r.URL.Query().Get("category")
+	sort := r.URL.Query().Get("sort")
+	after := r.URL.Query().Get("after")
 
 	if r.URL.Path != "/" {
 		errorHandler(w, "Page not found", 404)
 		return
 	}
+	if !store.ValidSort(sort) && sort != ranking.SortHot {
+		errorHandler(w, "Bad Request: unknown sort order", 400)
+		return
+	}
+	if sort == "" {
+		sort = store.SortNewest
+	}
 
-	categories, err := GetCategories(db)
+	categories, err := st.GetCategories()
 	if err != nil {
 		errorHandler(w, "Internal Server Error", 500)
 		return
 	}
 
-	var posts []Post
-	loggedInUsername, _ := GetLoggedInUsername(r, db)
+	user, _ := GetLoggedInUser(r, st)
+	if sort == ranking.SortHot {
+		// The hot ranking covers every post; filters do not apply to it
+		filter, category = "", ""
+	}
+	page, err := loadPosts(st, hot, user, filter, category, store.ListOptions{Sort: sort, After: after, Limit: PostsPerPage})
 
-	if filter == "my-likes" {
-		posts, err = GetUserLikedPosts(db, loggedInUsername)
-	} else if filter == "my-posts" {
-		posts, err = GetUserCreatedPosts(db, loggedInUsername)
-	} else if category != "" {
-		posts, err = GetPostsByCategory(db, category)
-	} else {
-		posts, err = GetPosts(db)
+	if errors.Is(err, store.ErrInvalidCursor) || errors.Is(err, store.ErrInvalidSort) {
+		errorHandler(w, "Bad Request: "+err.Error(), 400)
+		return
+	}
+	if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
 	}
 
+	posts, err := newPostViews(st, user, page.Posts)
 	if err != nil {
+		log.Println("Database error:", err)
 		errorHandler(w, "Internal Server Error", 500)
 		return
 	}
 
-	headerData := HeaderData{
-		LoggedInUser: loggedInUsername,
+	sortLinks := []SortLink{{Name: ranking.SortHot, URL: indexURL("", "", ranking.SortHot, ""), Current: sort == ranking.SortHot}}
+	for _, s := range store.Sorts {
+		sortLinks = append(sortLinks, SortLink{Name: s, URL: indexURL(filter, category, s, ""), Current: s == sort})
 	}
+	var nextPage string
+	if page.NextCursor != "" {
+		nextPage = indexURL(filter, category, sort, page.NextCursor)
+	}
+
+	headerData := newHeaderData(r, user)
 
 	data := struct {
-		Categories []Category
-		Posts      []Post
+		Categories []store.Category
+		Posts      []PostView
+		Sorts      []SortLink
+		NextPage   string
 		Header     HeaderData
 	}{
 		Categories: categories,
 		Posts:      posts,
+		Sorts:      sortLinks,
+		NextPage:   nextPage,
 		Header:     headerData,
 	}
 
-	err = tmpl.ExecuteTemplate(w, "index", data)
+	err = render(w, r, "index", data)
 	if err != nil {
 		errorHandler(w, err.Error(), 500)
 		return
 	}
 }
 
+// loadPosts loads a page of the posts listed on the index page: the hot
+// ranking, the user's liked or own posts, one category or all of them.
+func loadPosts(st store.Store, hot *ranking.Cache, user store.User, filter, category string, opts store.ListOptions) (store.PostPage, error) {
+	switch {
+	case opts.Sort == ranking.SortHot:
+		return hotPage(st, hot, opts.After, opts.Limit)
+	case filter == "my-likes":
+		return st.GetUserLikedPosts(user.Username, opts)
+	case filter == "my-posts":
+		return st.GetUserCreatedPosts(user.Username, opts)
+	case category != "":
+		return st.GetPostsByCategory(category, opts)
+	}
+	return st.GetPosts(opts)
+}
+
+// hotPage loads a page of the posts as the hot ranking orders them.
+func hotPage(st store.PostStore, hot *ranking.Cache, after string, limit int) (store.PostPage, error) {
+	postIDs, next, err := hot.Page(after, limit)
+	if err != nil {
+		return store.PostPage{}, err
+	}
+	posts, err := st.GetPostsByID(postIDs)
+	return store.PostPage{Posts: posts, NextCursor: next}, err
+}
+
+// indexURL links to a listing of the index page, keeping its filter.
+func indexURL(filter, category, sort, after string) string {
+	query := url.Values{}
+	if filter != "" {
+		query.Set("filter", filter)
+	}
+	if category != "" {
+		query.Set("category", category)
+	}
+	if sort != store.SortNewest {
+		query.Set("sort", sort)
+	}
+	if after != "" {
+		query.Set("after", after)
+	}
+	if len(query) == 0 {
+		return "/"
+	}
+	return "/?" + query.Encode()
+}
+
 func errorHandler(w http.ResponseWriter, msg string, code int) error {
 	tmpl, err := template.ParseFiles("frontend/error.html")
 	if err != nil {
@@ -93,35 +216,35 @@ func errorHandler(w http.ResponseWriter, msg string, code int) error {
 		Message: msg,
 		Code:    code,
 	}
+	w.WriteHeader(code)
 	return tmpl.Execute(w, errorMessage)
 }
-func CreatePostPageHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	categories, err := GetCategories(db)
+func CreatePostPageHandler(w http.ResponseWriter, r *http.Request, st store.Store) {
+	categories, err := st.GetCategories()
 	if err != nil {
+		errorHandler(w, "Internal Server Error", 500)
 		return
 	}
-	loggedInUsername, _ := GetLoggedInUsername(r, db) // Retrieve the logged-in username
-	headerData := HeaderData{
-		LoggedInUser: loggedInUsername,
-	}
+	user, _ := GetLoggedInUser(r, st) // Retrieve the logged-in user
+	headerData := newHeaderData(r, user)
 	data := struct {
-		Categories []Category
+		Categories []store.Category
 		Header     HeaderData
 	}{
 		Categories: categories,
 		Header:     headerData,
 	}
 
-	tmpl.ExecuteTemplate(w, "create-post", data)
+	render(w, r, "create-post", data)
 }
 
-func AddPostHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func AddPostHandler(w http.ResponseWriter, r *http.Request, st store.Store) {
 	if r.Method != http.MethodPost {
 		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	username, err := GetLoggedInUsername(r, db)
+	username, err := GetLoggedInUsername(r)
 	if err != nil {
 		http.Error(w, "Session error", http.StatusUnauthorized)
 		return
@@ -133,49 +256,45 @@ func AddPostHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	title := r.FormValue("title")
-	content := r.FormValue("content")
+	title := strings.TrimSpace(r.FormValue("title"))
+	content := strings.TrimSpace(r.FormValue("content"))
 	categories := r.Form["categories[]"]
 
+	if problem := checkPost(title, content); problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
 	if len(categories) == 0 {
 		http.Error(w, "At least one category must be selected", http.StatusBadRequest)
 		return
 	}
-
-	var userID int
-	err = db.QueryRow("SELECT user_ID FROM users WHERE username = ?", username).Scan(&userID)
-	if err != nil {
+	if ok, err := checkCategories(st, categories); err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		log.Println("Database error:", err)
 		return
+	} else if !ok {
+		http.Error(w, "Unknown category", http.StatusBadRequest)
+		return
 	}
 
-	insertQuery := "INSERT INTO posts (user_ID, title, content, created_at) VALUES (?, ?, ?, ?)"
-	createdAt := time.Now()
-
-	result, err := db.Exec(insertQuery, userID, title, content, createdAt)
+	user, err := st.GetUserByUsername(username)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		log.Println("Database error:", err)
 		return
 	}
 
-	postID, _ := result.LastInsertId()
-
-	for _, selectedCategory := range categories {
-		insertCategoryQuery := "INSERT INTO post_categories (post_ID, category_ID) VALUES (?, (SELECT category_ID FROM categories WHERE category = ?))"
-		_, err = db.Exec(insertCategoryQuery, postID, selectedCategory)
-		if err != nil {
-			http.Error(w, "Database error", http.StatusInternalServerError)
-			log.Println("Database error:", err)
-			return
-		}
+	postID, err := st.AddPost(user.UserID, title, content, categories)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println("Database error:", err)
+		return
 	}
 
 	http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
 }
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func RegisterHandler(w http.ResponseWriter, r *http.Request, st store.Store, sm *sessions.Manager, m *Mail) {
 	if r.Method != http.MethodPost {
 		errorHandler(w, "Method not allowed", 405)
 		return
@@ -189,20 +308,23 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	lowercaseEmail := strings.ToLower(email)
 	lowercaseUsername := strings.ToLower(username)
 
+	if !validEmail(lowercaseEmail) {
+		errorHandler(w, "Enter a valid email address", http.StatusBadRequest)
+		return
+	}
+
 	// Check if the user already exists in the database
-	var existingUser int
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE LOWER(email) = ? OR LOWER(username) = ?", lowercaseEmail, lowercaseUsername).Scan(&existingUser)
+	exists, err := st.UserExists(lowercaseEmail, lowercaseUsername)
 	if err != nil {
 		errorHandler(w, "Database error", 500)
 		log.Println("Database error:", err)
 		return
 	}
 
-	if existingUser > 0 {
+	if exists {
 		errorHandler(w, "User already exists", 409)
 		return
 	}
-	createdAt := time.Now()
 	// Hash the password before storing it
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -212,85 +334,43 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	}
 
 	// Continue with user registration
-	query := "INSERT INTO users (email, username, password, created_at) VALUES (?, ?, ?, ?)"
-	_, err = db.Exec(query, lowercaseEmail, lowercaseUsername, hashedPassword, createdAt)
+	userID, err := st.AddUser(lowercaseEmail, lowercaseUsername, hashedPassword)
 	if err != nil {
 		errorHandler(w, "Database error", 500)
 		log.Println("Database error:", err)
 		return
 	}
-	// Get the user's ID based on the username from the database
-	var userID int
-	err = db.QueryRow("SELECT user_ID FROM users WHERE username = ?", lowercaseUsername).Scan(&userID)
-	if err != nil {
-		errorHandler(w, "Database error", 500)
-		log.Println("Database error:", err)
+
+	// A failed email only delays verifying: the user can ask for another
+	user := store.User{UserID: userID, Email: lowercaseEmail, Username: lowercaseUsername}
+	if _, err := sendVerification(st, m, user); err != nil {
+		log.Println("Error sending a verification email:", err)
+	}
+	if settingsOf(r).Verification() == VerifyRequired {
+		data := verifyPage{
+			Message: fmt.Sprintf("We have sent a link to %s. Open it to verify your email, then log in.", lowercaseEmail),
+			Resend:  true,
+			Header:  newHeaderData(r, store.User{}),
+		}
+		if err := render(w, r, "verify-email", data); err != nil {
+			errorHandler(w, "Internal server error", 500)
+		}
 		return
 	}
 
-	// Generate a session token
-	token := GenerateSessionToken()
-
-	// Calculate session duration (same as in the LoginHandler)
-	sessionHours := 1
-	sessionMinutes := 30
-	sessionSeconds := 0
-	sessionDuration := time.Duration(sessionHours)*time.Hour + time.Duration(sessionMinutes)*time.Minute + time.Duration(sessionSeconds)*time.Second
-
-	// Calculate expiration time
-	expirationTime := time.Now().Add(sessionDuration)
-
-	// Create a new session record in the database
-	err = createSession(userID, token, expirationTime, db)
-	if err != nil {
+	// Log the new user in
+	if err := sm.Start(w, r, userID); err != nil {
 		errorHandler(w, "Database error", http.StatusInternalServerError)
 		log.Println("Database error:", err)
 		return
 	}
-
-	// Set the session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   token,
-		Expires: expirationTime,
-	})
+	// From now on the forms carry the session's CSRF token
+	clearCSRFSecret(w)
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func GenerateSessionToken() string {
-	b := make([]byte, 16)
-	rand.Read(b)
-	return base64.URLEncoding.EncodeToString(b)
-}
-
-func createSession(userID int, token string, expirationTime time.Time, db *sql.DB) error {
-	// Delete expired sessions before creating a new one
-	err := DeleteExpiredSessions(db)
-	if err != nil {
-		return err
-	}
-
-	// Check if an active session already exists for the user
-	var existingSessionID int
-	query := "SELECT session_ID FROM sessions WHERE user_ID = ? AND expires_at > ?"
-	err = db.QueryRow(query, userID, time.Now()).Scan(&existingSessionID)
-
-	if err == sql.ErrNoRows { // No active session found, create a new one
-		insertQuery := "INSERT INTO sessions (token, user_ID, created_at, expires_at) VALUES (?, ?, ?, ?)"
-		_, err = db.Exec(insertQuery, token, userID, time.Now(), expirationTime)
-		return err
-	} else if err != nil {
-		return err
-	}
-
-	// Update the existing session with new token and expiration time
-	updateQuery := "UPDATE sessions SET token = ?, expires_at = ? WHERE session_ID = ?"
-	_, err = db.Exec(updateQuery, token, expirationTime, existingSessionID)
-	return nil
-}
-
-func LoginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func LoginHandler(w http.ResponseWriter, r *http.Request, st store.Store, sm *sessions.Manager) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -299,148 +379,169 @@ func LoginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 
-	var userID int
-	var hashedPassword []byte // To store the hashed password from the database
-	query := "SELECT user_ID, password FROM users WHERE username = ?"
-	err := db.QueryRow(query, username).Scan(&userID, &hashedPassword)
+	user, err := st.GetUserByUsername(username)
 	if err != nil {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
 	// Compare the hashed password with the provided password
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	err = bcrypt.CompareHashAndPassword(user.Password, []byte(password))
 	if err != nil {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate a session token
-	token := GenerateSessionToken()
-
-	// Calculate session duration
-	sessionHours := 1
-	sessionMinutes := 30
-	sessionSeconds := 0
-	sessionDuration := time.Duration(sessionHours)*time.Hour + time.Duration(sessionMinutes)*time.Minute + time.Duration(sessionSeconds)*time.Second
+	if settingsOf(r).Verification() == VerifyRequired && !user.EmailVerified {
+		data := verifyPage{
+			Message: "Verify your email address before you log in. Open the link we emailed you, or ask for a new one.",
+			Resend:  true,
+			Header:  newHeaderData(r, store.User{}),
+		}
+		if err := render(w, r, "verify-email", data); err != nil {
+			errorHandler(w, "Internal server error", 500)
+		}
+		return
+	}
 
-	// Calculate expiration time
-	expirationTime := time.Now().Add(sessionDuration)
+	// Users with two-factor authentication enter a code first
+	if user.TwoFactor {
+		startLoginChallenge(w, r, st, sm, user)
+		return
+	}
 
-	// Create a new session record in the database
-	err = createSession(userID, token, expirationTime, db)
-	if err != nil {
+	// Start a session on this device; those on other devices go on
+	if err := sm.Start(w, r, user.UserID); err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		log.Println("Database error:", err)
 		return
 	}
-
-	// Set the session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   token,
-		Expires: expirationTime,
-	})
+	// From now on the forms carry the session's CSRF token
+	clearCSRFSecret(w)
 
 	// Redirect to the main page
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	// Get the session token from the cookie
-	cookie, err := r.Cookie("session_token")
-	if err == http.ErrNoCookie {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	} else if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+func LogoutHandler(w http.ResponseWriter, r *http.Request, sm *sessions.Manager) {
+	// Logging out over GET would let any page log the user out with an image
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
-	// Delete the session from the sessions table
-	deleteQuery := "DELETE FROM sessions WHERE token = ?"
-	_, err = db.Exec(deleteQuery, cookie.Value)
-	if err != nil {
+	// Delete the session and expire its cookie
+	if err := sm.End(w, r); err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		log.Println("Database error:", err)
 		return
 	}
 
-	// Expire the session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Expires:  time.Unix(0, 0),
-	})
-
 	// Redirect to the main page
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func PostHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	// Get the postID from the request URL or form data
-	postIDStr := strings.TrimPrefix(r.URL.Path, "/post/")
+func PostHandler(w http.ResponseWriter, r *http.Request, st store.Store, bus *events.Bus) {
+	// Get the postID and the optional action from the request URL: /post/{id},
+	// /post/{id}/edit, /post/{id}/delete, /post/{id}/revisions or /post/{id}/events
+	postIDStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/post/"), "/")
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
 		errorHandler(w, "Invalid post ID", 400)
 		return
 	}
 
-	// Assuming you have a database connection variable db
-	posts, err := GetPosts(db, postID)
-	if err != nil {
-		fmt.Print("1", err)
-		errorHandler(w, "Error retrieving post", 500)
+	switch action {
+	case "":
+	case "edit":
+		EditPostHandler(w, r, st, postID)
+		return
+	case "delete":
+		DeletePostHandler(w, r, st, postID)
+		return
+	case "revisions":
+		PostRevisionsHandler(w, r, st, postID)
+		return
+	case "events":
+		PostEventsHandler(w, r, st, bus, postID)
+		return
+	default:
+		errorHandler(w, "Page not found", 404)
 		return
 	}
 
-	if len(posts) == 0 {
+	post, err := st.GetPost(postID)
+	if errors.Is(err, store.ErrNotFound) {
+		errorHandler(w, "We cannot find this post", 404)
+		return
+	} else if err != nil {
+		log.Println("Error retrieving post:", err)
+		errorHandler(w, "Error retrieving post", 500)
+		return
+	}
+	user, _ := GetLoggedInUser(r, st) // Retrieve the logged-in user and their role
+	if !canSeePost(r, user, post) {
 		errorHandler(w, "We cannot find this post", 404)
 		return
 	}
 
-	post := posts[0]
-
-	// Get comments for the selected post
-	comments, err := GetCommentsForPost(db, post.PostID)
+	// Get comments for the selected post, or only one thread of them when
+	// following a "continue this thread" link
+	thread, _ := strconv.Atoi(r.URL.Query().Get("thread"))
+	comments, err := st.GetCommentsForPost(post.PostID, thread, MaxCommentDepth)
 	if err != nil {
+		log.Println("Error retrieving comments:", err)
 		errorHandler(w, "Error retrieving comments", 500)
 		return
 	}
-	loggedInUsername, _ := GetLoggedInUsername(r, db) // Retrieve the logged-in username
-	headerData := HeaderData{
-		LoggedInUser: loggedInUsername,
+	postViews, err := newPostViews(st, user, []store.Post{post})
+	if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal server error", 500)
+		return
+	}
+	commentReactions, err := st.GetUserReactions(user.UserID, store.TargetComment, commentIDs(comments))
+	if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal server error", 500)
+		return
 	}
+	headerData := newHeaderData(r, user)
 
 	// Create a data structure to pass to the template
 	data := struct {
-		Post     Post
-		Comments []Comment
+		Post     PostView
+		Comments []CommentView
+		Thread   int
 		Header   HeaderData
+		CanEdit  bool
 	}{
-		Post:     post,
-		Comments: comments,
+		Post:     postViews[0],
+		Comments: newCommentViews(r, comments, post.PostID, user, commentReactions),
+		Thread:   thread,
 		Header:   headerData,
+		CanEdit:  canEditPost(r, user, post),
 	}
 
-	err = tmpl.ExecuteTemplate(w, "post", data) // Use the "post" template
+	err = render(w, r, "post", data) // Use the "post" template
 	if err != nil {
 		errorHandler(w, "Internal server error", 500)
 		return
 	}
 }
-func SubmitCommentHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	username, err := GetLoggedInUsername(r, db)
+func SubmitCommentHandler(w http.ResponseWriter, r *http.Request, st store.Store, bus *events.Bus) {
+	username, err := GetLoggedInUsername(r)
 	if err != nil {
 		// Handle unauthenticated user.
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
 	// Get the user's ID based on the username.
-	userID, err := GetUserIDByUsername(username, db)
+	user, err := st.GetUserByUsername(username)
 	if err != nil {
 		// Handle error.
 		http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
@@ -448,7 +549,11 @@ func SubmitCommentHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	}
 
 	// Extract the comment and postID from the form data.
-	comment := r.FormValue("comment")
+	comment := strings.TrimSpace(r.FormValue("comment"))
+	if problem := checkComment(comment); problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
 	postIDStr := r.FormValue("postID")
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
@@ -458,20 +563,34 @@ func SubmitCommentHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	}
 
 	// Insert the comment into the database using the user's ID.
-	_, err = db.Exec("INSERT INTO comments (post_ID, user_ID, content, created_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)", postID, userID, comment)
-	if err != nil {
+	// A reply names the comment it answers; top-level comments leave it out.
+	parentID := 0
+	if parentIDStr := r.FormValue("parentID"); parentIDStr != "" {
+		parentID, err = strconv.Atoi(parentIDStr)
+		if err != nil {
+			http.Error(w, "Invalid parentID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	commentID, err := st.AddComment(postID, user.UserID, parentID, comment)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "The post or the comment you reply to does not exist, is hidden or is deleted", http.StatusNotFound)
+		return
+	} else if err != nil {
 		// Handle the error.
-		fmt.Print(err)
+		log.Println("Database error:", err)
 		http.Error(w, "Failed to submit comment", http.StatusInternalServerError)
 		return
 	}
+	publishComment(bus, postID, commentID)
 
 	// Redirect back to the post page or update the comments section via AJAX.
 	http.Redirect(w, r, r.Referer(), http.StatusSeeOther)
 }
 
-func UpdateReactionHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	username, err := GetLoggedInUsername(r, db)
+func UpdateReactionHandler(w http.ResponseWriter, r *http.Request, st store.Store, bus *events.Bus) {
+	username, err := GetLoggedInUsername(r)
 	if err != nil {
 		// Handle unauthenticated user.
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
@@ -482,7 +601,7 @@ func UpdateReactionHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 	// Get the user's ID based on the username.
-	loggedInUserID, err := GetUserIDByUsername(username, db)
+	user, err := st.GetUserByUsername(username)
 	if err != nil {
 		// Handle error.
 		http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
@@ -494,13 +613,12 @@ func UpdateReactionHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 	reactionType, err := strconv.Atoi(reactionTypeStr)
-	if err != nil || (reactionType != 0 && reactionType != 1) {
-		fmt.Print(err)
+	if err != nil {
 		http.Error(w, "Invalid reaction type", http.StatusBadRequest)
 		return
 	}
 	targetType := r.FormValue("targetType") // "post" or "comment"
-	if targetType != "post" && targetType != "comment" {
+	if targetType != store.TargetPost && targetType != store.TargetComment {
 		http.Error(w, "Invalid target type", http.StatusBadRequest)
 		return
 	}
@@ -510,44 +628,16 @@ func UpdateReactionHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		http.Error(w, "Invalid target ID", http.StatusBadRequest)
 		return
 	}
-	var tableName string
-	var targetColumn string
-	if targetType == "post" {
-		tableName = "likes"
-		targetColumn = "post_ID"
-	} else {
-		tableName = "likes"
-		targetColumn = "comment_ID"
-	}
-	// Check if the user has already liked or disliked this target (post or comment)
-	var existingReactionType int
-	err = db.QueryRow("SELECT type FROM "+tableName+" WHERE "+targetColumn+" = ? AND user_ID = ?", targetID, loggedInUserID).Scan(&existingReactionType)
-	if err != nil && err != sql.ErrNoRows {
-		fmt.Print(err)
+	err = st.SetReaction(user.UserID, targetType, targetID, reactionType)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "The reaction type is not enabled, or what you react to does not exist or is hidden", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Database error:", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-	if err == nil {
-		// User has already reacted, update the reaction type
-		_, err = db.Exec("UPDATE likes SET type = ? WHERE ("+targetType+"_ID = ?) AND user_ID = ?", reactionType, targetID, loggedInUserID)
-		if err == nil {
-			// Update the likes count in the corresponding target entry (post or comment)
-			_, err = db.Exec("UPDATE "+targetType+"s SET "+targetType+"s = (SELECT COUNT(*) FROM likes WHERE "+targetType+"_ID = ? AND type = 0) WHERE "+targetType+"_ID = ?", targetID, targetID)
-		}
-	} else {
-		// User hasn't reacted yet, insert a new reaction
-		_, err = db.Exec("INSERT INTO likes ("+targetType+"_ID, user_ID, type) VALUES (?, ?, ?)", targetID, loggedInUserID, reactionType)
-		if err == nil {
-			// Update the likes count in the corresponding target entry (post or comment)
-			_, err = db.Exec("UPDATE "+targetType+"s SET "+targetType+"s = (SELECT COUNT(*) FROM likes WHERE "+targetType+"_ID = ? AND type = 0) WHERE "+targetType+"_ID = ?", targetID, targetID)
-		}
-	}
+	publishReactions(bus, st, targetType, targetID)
 	// Redirect back to the same page to refresh the content
 	http.Redirect(w, r, r.Header.Get("Referer"), http.StatusSeeOther)
 }
-
-func DeleteExpiredSessions(db *sql.DB) error {
-	deleteQuery := "DELETE FROM sessions WHERE expires_at <= ?"
-	_, err := db.Exec(deleteQuery, time.Now())
-	return err
-}
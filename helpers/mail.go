@@ -0,0 +1,99 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"forum/mail"
+	"forum/store"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Emails sent after the answer, such as password resets, wait in a queue
+// of MailQueueSize for one of MailSenders to send them. Requests that find
+// the queue full are dropped and logged, so a burst of them cannot start
+// any number of goroutines and SMTP connections.
+const (
+	MailQueueSize = 100
+	MailSenders   = 2
+)
+
+// Mail sends the emails of the account flows.
+type Mail struct {
+	Mailer mail.Mailer
+	// BaseURL is where links in emails point, e.g. https://forum.example.com.
+	// It is configured rather than taken from the request's Host header,
+	// which whoever asks for the email controls.
+	BaseURL string
+	// Secret signs the links that are checked without the store, such as
+	// those that verify email addresses.
+	Secret []byte
+
+	startQueue sync.Once
+	queue      chan func()
+}
+
+// later queues send to run after the answer, and logs its error as an
+// error sending what. When the queue is full it drops send and logs that.
+func (m *Mail) later(what string, send func() error) {
+	m.startQueue.Do(func() {
+		m.queue = make(chan func(), MailQueueSize)
+		for i := 0; i < MailSenders; i++ {
+			go func() {
+				for job := range m.queue {
+					job()
+				}
+			}()
+		}
+	})
+	job := func() {
+		if err := send(); err != nil {
+			log.Printf("Error sending %s: %v", what, err)
+		}
+	}
+	select {
+	case m.queue <- job:
+	default:
+		log.Printf("Not sending %s: %d emails are already waiting", what, MailQueueSize)
+	}
+}
+
+// link returns the absolute URL of a path of the forum with a query.
+func (m *Mail) link(path string, query url.Values) string {
+	return strings.TrimSuffix(m.BaseURL, "/") + path + "?" + query.Encode()
+}
+
+// sign returns the signature of a link's fields, under the Mail's secret.
+func (m *Mail) sign(fields ...string) string {
+	mac := hmac.New(sha256.New, m.Secret)
+	mac.Write([]byte(strings.Join(fields, "\x00")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newMailToken returns a random token for a link in an email.
+func newMailToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashMailToken is what the store keeps instead of a token from an email.
+func hashMailToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// releaseEmail gives back the slot ClaimEmail took for an email that could
+// not be sent, so the user does not wait out the interval for nothing.
+func releaseEmail(st store.Store, userID int, kind string) {
+	if err := st.ReleaseEmail(userID, kind); err != nil {
+		log.Println("Database error:", err)
+	}
+}
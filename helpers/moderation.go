@@ -0,0 +1,184 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"forum/store"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxReportReason is the longest reason a report may give, in characters.
+const MaxReportReason = 500
+
+// ModerationLogSize is how many past decisions the moderation queue lists.
+const ModerationLogSize = 50
+
+// ReportHandler records a report of a post or comment and sends the user
+// back to it.
+func ReportHandler(w http.ResponseWriter, r *http.Request, st store.Store) {
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := GetLoggedInUser(r, st)
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	targetType := r.FormValue("targetType") // "post" or "comment"
+	targetID, err := strconv.Atoi(r.FormValue("targetID"))
+	if err != nil {
+		http.Error(w, "Invalid target ID", http.StatusBadRequest)
+		return
+	}
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(reason) > MaxReportReason {
+		http.Error(w, fmt.Sprintf("The reason can be at most %d characters long", MaxReportReason), http.StatusBadRequest)
+		return
+	}
+
+	redirect := fmt.Sprintf("/post/%d", targetID)
+	switch targetType {
+	case store.TargetPost:
+	case store.TargetComment:
+		comment, err := st.GetComment(targetID)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Comment not found", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println("Database error:", err)
+			return
+		}
+		redirect = fmt.Sprintf("/post/%d#comment-%d", comment.PostID, targetID)
+	default:
+		http.Error(w, "Invalid target type", http.StatusBadRequest)
+		return
+	}
+
+	err = st.AddReport(user.UserID, targetType, targetID, reason)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Post not found", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println("Database error:", err)
+		return
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// ModerationHandler shows moderators the open reports and the latest
+// decisions.
+func ModerationHandler(w http.ResponseWriter, r *http.Request, st store.Store) {
+	if r.URL.Path != "/moderation" {
+		errorHandler(w, "Page not found", 404)
+		return
+	}
+
+	reports, err := st.GetOpenReports()
+	if err != nil {
+		log.Println("Error retrieving reports:", err)
+		errorHandler(w, "Error retrieving reports", 500)
+		return
+	}
+	actions, err := st.GetModerationLog(ModerationLogSize)
+	if err != nil {
+		log.Println("Error retrieving moderation log:", err)
+		errorHandler(w, "Error retrieving moderation log", 500)
+		return
+	}
+
+	user, _ := GetLoggedInUser(r, st)
+	data := struct {
+		Reports []store.Report
+		Actions []store.ModerationAction
+		Header  HeaderData
+	}{
+		Reports: reports,
+		Actions: actions,
+		Header:  newHeaderData(r, user),
+	}
+	if err := render(w, r, "moderation", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
+
+// ResolveReportHandler applies a moderator's decision to a report.
+func ResolveReportHandler(w http.ResponseWriter, r *http.Request, st store.Store) {
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := GetLoggedInUser(r, st)
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	reportID, err := strconv.Atoi(r.FormValue("reportID"))
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+	decision := r.FormValue("decision")
+	switch decision {
+	case store.DecisionHide, store.DecisionWarn, store.DecisionDismiss:
+	default:
+		http.Error(w, "Invalid decision", http.StatusBadRequest)
+		return
+	}
+	note := strings.TrimSpace(r.FormValue("note"))
+
+	err = st.ResolveReport(reportID, user.UserID, decision, note)
+	if errors.Is(err, store.ErrNotFound) {
+		errorHandler(w, "This report has already been resolved", 404)
+		return
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println("Database error:", err)
+		return
+	}
+
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
+
+// WarningsHandler lists the warnings moderators have given the logged-in
+// user.
+func WarningsHandler(w http.ResponseWriter, r *http.Request, st store.Store) {
+	user, err := GetLoggedInUser(r, st)
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	warnings, err := st.GetWarnings(user.UserID)
+	if err != nil {
+		log.Println("Error retrieving warnings:", err)
+		errorHandler(w, "Error retrieving warnings", 500)
+		return
+	}
+
+	data := struct {
+		Warnings []store.Warning
+		Header   HeaderData
+	}{
+		Warnings: warnings,
+		Header:   newHeaderData(r, user),
+	}
+	if err := render(w, r, "warnings", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
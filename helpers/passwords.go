@@ -0,0 +1,165 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"forum/mail"
+	"forum/store"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// PasswordResetTTL is how long a password reset link works.
+	PasswordResetTTL = time.Hour
+	// PasswordResetInterval is how long a user waits before they can be
+	// sent another password reset link.
+	PasswordResetInterval = 5 * time.Minute
+)
+
+// passwordPage is the data of the forgot-password and reset-password
+// pages.
+type passwordPage struct {
+	Token   string // of the reset link the page was opened with
+	Message string // what went wrong with the form
+	Done    bool   // the email was sent, or the password changed
+	Header  HeaderData
+}
+
+// ForgotPasswordHandler serves /forgot-password, where users ask for a link
+// to reset their password. The answer is the same whether or not the email
+// belongs to a user, and comes before the email is looked up and sent, so
+// neither the page nor how long it takes tells who has an account.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request, st store.Store, m *Mail) {
+	user, _ := GetLoggedInUser(r, st)
+	data := passwordPage{Header: newHeaderData(r, user)}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		email := strings.TrimSpace(r.FormValue("email"))
+		if email == "" {
+			data.Message = "Enter the email of your account."
+			break
+		}
+		m.later("a password reset", func() error { return sendPasswordReset(st, m, email) })
+		data.Done = true
+	default:
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := render(w, r, "forgot-password", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
+
+// sendPasswordReset mails a reset link to the user with the email, if there
+// is one and they were not sent one less than PasswordResetInterval ago.
+func sendPasswordReset(st store.Store, m *Mail, email string) error {
+	user, err := st.GetUserByEmail(email)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	ok, err := st.ClaimEmail(user.UserID, store.EmailPasswordReset, time.Now().Add(-PasswordResetInterval))
+	if err != nil || !ok {
+		return err
+	}
+	if err := mailPasswordReset(st, m, user); err != nil {
+		releaseEmail(st, user.UserID, store.EmailPasswordReset)
+		return err
+	}
+	return nil
+}
+
+// mailPasswordReset stores a reset token for the user and mails them the
+// link with it.
+func mailPasswordReset(st store.Store, m *Mail, user store.User) error {
+	token, err := newMailToken()
+	if err != nil {
+		return err
+	}
+	if err := st.AddPasswordReset(user.UserID, hashMailToken(token), time.Now().Add(PasswordResetTTL)); err != nil {
+		return err
+	}
+	link := m.link("/reset-password", url.Values{"token": {token}})
+	return m.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your forum password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Somebody asked to reset the password of your forum account. To choose a new password, "+
+			"open this link within an hour:\n\n%s\n\n"+
+			"The link works once. If you did not ask for it, ignore this email and your password stays as it is.\n",
+			user.Username, link),
+	})
+}
+
+// ResetPasswordHandler serves /reset-password, the page the emailed link
+// opens, where the user chooses a new password. Changing it logs the user
+// out everywhere.
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request, st store.Store) {
+	user, _ := GetLoggedInUser(r, st)
+	data := passwordPage{Token: r.FormValue("token"), Header: newHeaderData(r, user)}
+	switch r.Method {
+	case http.MethodGet:
+		_, err := st.GetPasswordReset(hashMailToken(data.Token))
+		if errors.Is(err, store.ErrNotFound) {
+			data.Message = "This link has expired or has already been used. Ask for a new one."
+			data.Token = ""
+		} else if err != nil {
+			log.Println("Database error:", err)
+			errorHandler(w, "Internal Server Error", 500)
+			return
+		}
+	case http.MethodPost:
+		if !resetPassword(w, r, st, &data, r.FormValue("password"), r.FormValue("confirm")) {
+			return
+		}
+	default:
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := render(w, r, "reset-password", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
+
+// resetPassword changes the password for the reset of the page, or sets the
+// page's message to why it cannot. It returns false when it answered with an
+// error page instead.
+func resetPassword(w http.ResponseWriter, r *http.Request, st store.Store, data *passwordPage, password, confirm string) bool {
+	if password == "" {
+		data.Message = "Choose a new password."
+		return true
+	}
+	if password != confirm {
+		data.Message = "The passwords do not match."
+		return true
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("Password hashing error:", err)
+		errorHandler(w, "Password hashing error", 500)
+		return false
+	}
+	err = st.ResetPassword(hashMailToken(data.Token), hashedPassword)
+	if errors.Is(err, store.ErrNotFound) {
+		data.Message = "This link has expired or has already been used. Ask for a new one."
+		data.Token = ""
+		return true
+	} else if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return false
+	}
+	// The change ended every session, this one included
+	data.Done = true
+	data.Token = ""
+	data.Header = newHeaderData(r, store.User{})
+	return true
+}
@@ -0,0 +1,64 @@
+package helpers
+
+import (
+	"forum/auth"
+	"forum/store"
+	"net/http"
+)
+
+// roleOf returns the role of a user loaded by GetLoggedInUser; the zero User
+// is a guest, users the verification policy restricts are unverified, and
+// moderators and admins who need two-factor authentication to use their
+// rights are members until they turn it on.
+func roleOf(r *http.Request, user store.User) auth.Role {
+	if user.Username == "" {
+		return auth.Guest
+	}
+	if restricted(r, user) {
+		return auth.Unverified
+	}
+	if needsTwoFactor(r, user) {
+		return auth.Member
+	}
+	return auth.Role(user.Role)
+}
+
+// can reports whether the request's user may do something: their role must
+// hold the permission and, when they came with an API token, one of the
+// token's scopes must cover it too.
+func can(r *http.Request, user store.User, permission auth.Permission) bool {
+	if !roleOf(r, user).Can(permission) {
+		return false
+	}
+	scopes, byToken := tokenScopes(r)
+	return !byToken || scopes.Allow(permission)
+}
+
+// Require wraps a handler so it only runs for users whose role holds the
+// permission. Guests are told to log in; banned users and members without
+// the permission are refused, and unverified users are told to verify their
+// email. Requests made with an API token also need a scope covering the
+// permission.
+func Require(st store.Store, permission auth.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := GetLoggedInUser(r, st)
+		role := roleOf(r, user)
+		if can(r, user, permission) {
+			next(w, r)
+			return
+		}
+		if role.Can(permission) {
+			errorHandler(w, "The API token does not allow that", http.StatusForbidden)
+			return
+		}
+		if role == auth.Guest {
+			errorHandler(w, "Please log in first", http.StatusUnauthorized)
+			return
+		}
+		if role == auth.Unverified {
+			errorHandler(w, "Verify your email address first", http.StatusForbidden)
+			return
+		}
+		errorHandler(w, "You do not have permission to do that", http.StatusForbidden)
+	}
+}
@@ -0,0 +1,265 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"forum/auth"
+	"forum/store"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// The longest title and text a post may have, in characters. They also
+// bound the work of comparing its revisions.
+const (
+	MaxTitleLength = 200
+	MaxPostLength  = 20000
+)
+
+// checkPost returns what is wrong with the title and text of a post, or ""
+// when nothing is.
+func checkPost(title, content string) string {
+	switch {
+	case title == "" || content == "":
+		return "Title and content are required"
+	case utf8.RuneCountInString(title) > MaxTitleLength:
+		return fmt.Sprintf("The title can be at most %d characters long", MaxTitleLength)
+	case utf8.RuneCountInString(content) > MaxPostLength:
+		return fmt.Sprintf("The post can be at most %d characters long", MaxPostLength)
+	}
+	return ""
+}
+
+// canEditPost reports whether the logged-in user may edit or delete a post:
+// its author may, and so may moderators and admins.
+func canEditPost(r *http.Request, user store.User, post store.Post) bool {
+	if can(r, user, auth.EditAnyContent) {
+		return true
+	}
+	return can(r, user, auth.EditOwnContent) && user.Username == post.Username
+}
+
+// canSeePost reports whether the post page may be shown: posts hidden by a
+// moderator are only shown to moderators.
+func canSeePost(r *http.Request, user store.User, post store.Post) bool {
+	return !post.Hidden || can(r, user, auth.ModerateContent)
+}
+
+type CategoryChoice struct {
+	Category string
+	Selected bool
+}
+
+// EditPostHandler shows the edit form on GET and saves the edit on POST.
+func EditPostHandler(w http.ResponseWriter, r *http.Request, st store.Store, postID int) {
+	user, post, ok := postForEditing(w, r, st, postID)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		categories, err := st.GetCategories()
+		if err != nil {
+			errorHandler(w, "Internal Server Error", 500)
+			return
+		}
+		selected := map[string]bool{}
+		for _, category := range post.Categories {
+			selected[category.Category] = true
+		}
+		var choices []CategoryChoice
+		for _, category := range categories {
+			choices = append(choices, CategoryChoice{Category: category.Category, Selected: selected[category.Category]})
+		}
+
+		data := struct {
+			Post       store.Post
+			Categories []CategoryChoice
+			Header     HeaderData
+		}{
+			Post:       post,
+			Categories: choices,
+			Header:     newHeaderData(r, user),
+		}
+		if err := render(w, r, "edit-post", data); err != nil {
+			errorHandler(w, "Internal server error", 500)
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Form parsing error", http.StatusInternalServerError)
+		return
+	}
+	title := strings.TrimSpace(r.FormValue("title"))
+	content := strings.TrimSpace(r.FormValue("content"))
+	categories := r.Form["categories[]"]
+
+	if problem := checkPost(title, content); problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+	if len(categories) == 0 {
+		http.Error(w, "At least one category must be selected", http.StatusBadRequest)
+		return
+	}
+	if ok, err := checkCategories(st, categories); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println("Database error:", err)
+		return
+	} else if !ok {
+		http.Error(w, "Unknown category", http.StatusBadRequest)
+		return
+	}
+
+	err = st.UpdatePost(postID, user.UserID, title, content, categories)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println("Database error:", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+}
+
+func DeletePostHandler(w http.ResponseWriter, r *http.Request, st store.Store, postID int) {
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, _, ok := postForEditing(w, r, st, postID); !ok {
+		return
+	}
+
+	err := st.DeletePost(postID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println("Database error:", err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// postForEditing loads a post and checks that the logged-in user may change
+// it, writing the error response when they may not.
+func postForEditing(w http.ResponseWriter, r *http.Request, st store.Store, postID int) (store.User, store.Post, bool) {
+	user, err := GetLoggedInUser(r, st)
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return store.User{}, store.Post{}, false
+	}
+
+	post, err := st.GetPost(postID)
+	if errors.Is(err, store.ErrNotFound) {
+		errorHandler(w, "We cannot find this post", 404)
+		return store.User{}, store.Post{}, false
+	} else if err != nil {
+		log.Println("Error retrieving post:", err)
+		errorHandler(w, "Error retrieving post", 500)
+		return store.User{}, store.Post{}, false
+	}
+
+	if !canEditPost(r, user, post) {
+		errorHandler(w, "You cannot change this post", http.StatusForbidden)
+		return store.User{}, store.Post{}, false
+	}
+	return user, post, true
+}
+
+// RevisionChange describes one edit: the version it replaced and what it
+// changed.
+type RevisionChange struct {
+	Editor            string
+	EditedAt          string
+	Title             []DiffPart
+	Content           []DiffPart
+	AddedCategories   []string
+	RemovedCategories []string
+}
+
+func PostRevisionsHandler(w http.ResponseWriter, r *http.Request, st store.Store, postID int) {
+	post, err := st.GetPost(postID)
+	if errors.Is(err, store.ErrNotFound) {
+		errorHandler(w, "We cannot find this post", 404)
+		return
+	} else if err != nil {
+		log.Println("Error retrieving post:", err)
+		errorHandler(w, "Error retrieving post", 500)
+		return
+	}
+	user, _ := GetLoggedInUser(r, st)
+	if !canSeePost(r, user, post) {
+		errorHandler(w, "We cannot find this post", 404)
+		return
+	}
+
+	revisions, err := st.GetPostRevisions(postID)
+	if err != nil {
+		log.Println("Error retrieving revisions:", err)
+		errorHandler(w, "Error retrieving revisions", 500)
+		return
+	}
+
+	// Every revision was replaced by the next one, the last by the post as
+	// it is now. Newest edits are listed first.
+	var changes []RevisionChange
+	for i := len(revisions) - 1; i >= 0; i-- {
+		old := revisions[i]
+		next := store.PostRevision{Title: post.Title, Content: post.Content, Categories: post.Categories}
+		if i+1 < len(revisions) {
+			next = revisions[i+1]
+		}
+		added, removed := diffCategories(old.Categories, next.Categories)
+		changes = append(changes, RevisionChange{
+			Editor:            old.Editor,
+			EditedAt:          old.EditedAt,
+			Title:             DiffWords(old.Title, next.Title),
+			Content:           DiffWords(old.Content, next.Content),
+			AddedCategories:   added,
+			RemovedCategories: removed,
+		})
+	}
+
+	data := struct {
+		Post    store.Post
+		Changes []RevisionChange
+		Header  HeaderData
+	}{
+		Post:    post,
+		Changes: changes,
+		Header:  newHeaderData(r, user),
+	}
+	if err := render(w, r, "revisions", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
+
+func diffCategories(old, new []store.Category) (added, removed []string) {
+	had := map[string]bool{}
+	for _, category := range old {
+		had[category.Category] = true
+	}
+	has := map[string]bool{}
+	for _, category := range new {
+		has[category.Category] = true
+		if !had[category.Category] {
+			added = append(added, category.Category)
+		}
+	}
+	for _, category := range old {
+		if !has[category.Category] {
+			removed = append(removed, category.Category)
+		}
+	}
+	return added, removed
+}
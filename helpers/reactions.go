@@ -0,0 +1,150 @@
+package helpers
+
+import (
+	"errors"
+	"forum/store"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ReactionBar is what the "reactions" template needs to render the reaction
+// buttons of a post or comment.
+type ReactionBar struct {
+	TargetType string
+	TargetID   int
+	Buttons    []ReactionButton
+}
+
+// ReactionButton is one reaction type with its count, active when it is the
+// logged-in user's reaction.
+type ReactionButton struct {
+	store.ReactionCount
+	Active bool
+}
+
+func newReactionBar(targetType string, targetID int, counts []store.ReactionCount, reactions map[int]int) ReactionBar {
+	bar := ReactionBar{TargetType: targetType, TargetID: targetID}
+	reactionType, reacted := reactions[targetID]
+	for _, count := range counts {
+		bar.Buttons = append(bar.Buttons, ReactionButton{ReactionCount: count, Active: reacted && count.Type == reactionType})
+	}
+	return bar
+}
+
+// PostView is a post together with its reaction buttons for the logged-in
+// user.
+type PostView struct {
+	store.Post
+	ReactionBar ReactionBar
+}
+
+func newPostViews(st store.ReactionStore, user store.User, posts []store.Post) ([]PostView, error) {
+	postIDs := make([]int, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.PostID
+	}
+	reactions, err := st.GetUserReactions(user.UserID, store.TargetPost, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	views := make([]PostView, len(posts))
+	for i, post := range posts {
+		views[i] = PostView{Post: post, ReactionBar: newReactionBar(store.TargetPost, post.PostID, post.Reactions, reactions)}
+	}
+	return views, nil
+}
+
+// commentIDs collects the IDs of the comments and of all their loaded
+// replies.
+func commentIDs(comments []store.Comment) []int {
+	var ids []int
+	for _, comment := range comments {
+		ids = append(ids, comment.CommentID)
+		ids = append(ids, commentIDs(comment.Replies)...)
+	}
+	return ids
+}
+
+// ReactorGroup lists the users who gave one type of reaction.
+type ReactorGroup struct {
+	store.ReactionType
+	Reactors []store.Reactor
+}
+
+// ReactionsHandler shows who reacted to a post or comment, at
+// /reactions/post/{id} and /reactions/comment/{id}.
+func ReactionsHandler(w http.ResponseWriter, r *http.Request, st store.Store) {
+	targetType, targetIDStr, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/reactions/"), "/")
+	targetID, err := strconv.Atoi(targetIDStr)
+	if err != nil || (targetType != store.TargetPost && targetType != store.TargetComment) {
+		errorHandler(w, "Page not found", 404)
+		return
+	}
+
+	user, _ := GetLoggedInUser(r, st)
+	postID := targetID
+	if targetType == store.TargetComment {
+		comment, err := st.GetComment(targetID)
+		if errors.Is(err, store.ErrNotFound) {
+			errorHandler(w, "We cannot find this comment", 404)
+			return
+		} else if err != nil {
+			log.Println("Database error:", err)
+			errorHandler(w, "Internal Server Error", 500)
+			return
+		}
+		postID = comment.PostID
+	}
+	post, err := st.GetPost(postID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !canSeePost(r, user, post)) {
+		errorHandler(w, "We cannot find this post", 404)
+		return
+	} else if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+
+	types, err := st.GetReactionTypes()
+	if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+	reactors, err := st.GetReactors(targetType, targetID)
+	if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+	var groups []ReactorGroup
+	for _, reactionType := range types {
+		group := ReactorGroup{ReactionType: reactionType}
+		for _, reactor := range reactors {
+			if reactor.Type == reactionType.Type {
+				group.Reactors = append(group.Reactors, reactor)
+			}
+		}
+		if len(group.Reactors) > 0 {
+			groups = append(groups, group)
+		}
+	}
+
+	data := struct {
+		Post       store.Post
+		TargetType string
+		Groups     []ReactorGroup
+		Header     HeaderData
+	}{
+		Post:       post,
+		TargetType: targetType,
+		Groups:     groups,
+		Header:     newHeaderData(r, user),
+	}
+	if err := render(w, r, "reactors", data); err != nil {
+		errorHandler(w, err.Error(), 500)
+		return
+	}
+}
@@ -0,0 +1,85 @@
+package helpers
+
+import (
+	"forum/store"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// MaxSearchResults is how many posts and comments a search lists.
+const MaxSearchResults = 50
+
+// HighlightPart is a run of a search snippet, matching the query or not.
+type HighlightPart struct {
+	Text  string
+	Match bool
+}
+
+type SearchResultView struct {
+	store.SearchResult
+	Snippet []HighlightPart
+}
+
+// highlightParts splits a snippet at the highlight markers the store put
+// around the matches.
+func highlightParts(snippet string) []HighlightPart {
+	var parts []HighlightPart
+	for {
+		before, rest, found := strings.Cut(snippet, store.HighlightStart)
+		if before != "" {
+			parts = append(parts, HighlightPart{Text: before})
+		}
+		if !found {
+			return parts
+		}
+		match, after, _ := strings.Cut(rest, store.HighlightEnd)
+		parts = append(parts, HighlightPart{Text: match, Match: true})
+		snippet = after
+	}
+}
+
+// SearchHandler serves /search?q=, optionally narrowed with category= (a
+// slug) and author= (a username).
+func SearchHandler(w http.ResponseWriter, r *http.Request, st store.Store) {
+	query := store.SearchQuery{
+		Text:     strings.TrimSpace(r.URL.Query().Get("q")),
+		Category: r.URL.Query().Get("category"),
+		Author:   strings.TrimSpace(r.URL.Query().Get("author")),
+	}
+
+	categories, err := st.GetCategories()
+	if err != nil {
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+
+	var results []SearchResultView
+	if query.Text != "" {
+		found, err := st.Search(query, MaxSearchResults)
+		if err != nil {
+			log.Println("Error searching:", err)
+			errorHandler(w, "Error searching", 500)
+			return
+		}
+		for _, result := range found {
+			results = append(results, SearchResultView{SearchResult: result, Snippet: highlightParts(result.Snippet)})
+		}
+	}
+
+	user, _ := GetLoggedInUser(r, st)
+	data := struct {
+		Query      store.SearchQuery
+		Categories []store.Category
+		Results    []SearchResultView
+		Header     HeaderData
+	}{
+		Query:      query,
+		Categories: categories,
+		Results:    results,
+		Header:     newHeaderData(r, user),
+	}
+	if err := render(w, r, "search", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
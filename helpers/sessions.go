@@ -0,0 +1,85 @@
+package helpers
+
+import (
+	"errors"
+	"forum/sessions"
+	"forum/store"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SessionView is a session as the sessions page shows it.
+type SessionView struct {
+	store.Session
+	Current bool // the session the page is viewed in
+}
+
+// accountSessions serves /account/sessions, which lists where the user is
+// logged in, and /account/sessions/{id}/revoke, which logs one of those
+// out. rest is the path after /account/sessions.
+func accountSessions(w http.ResponseWriter, r *http.Request, st store.Store, sm *sessions.Manager, user store.User, rest string) {
+	current, _ := sessions.Current(r)
+	if rest == "" || rest == "/" {
+		sessionsPage(w, r, st, user, current)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	if len(parts) != 2 || parts[1] != "revoke" {
+		errorHandler(w, "Page not found", 404)
+		return
+	}
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sessionID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		errorHandler(w, "Page not found", 404)
+		return
+	}
+	err = sm.Revoke(user.UserID, sessionID)
+	if errors.Is(err, store.ErrNotFound) {
+		errorHandler(w, "We cannot find this session", 404)
+		return
+	} else if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+	if sessionID == current.SessionID {
+		// Revoking the session in use is logging out
+		if err := sm.End(w, r); err != nil {
+			log.Println("Database error:", err)
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+func sessionsPage(w http.ResponseWriter, r *http.Request, st store.Store, user store.User, current store.Session) {
+	list, err := st.GetUserSessions(user.UserID)
+	if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+	views := make([]SessionView, len(list))
+	for i, session := range list {
+		views[i] = SessionView{Session: session, Current: session.SessionID == current.SessionID}
+	}
+
+	data := struct {
+		Sessions []SessionView
+		Header   HeaderData
+	}{
+		Sessions: views,
+		Header:   newHeaderData(r, user),
+	}
+	if err := render(w, r, "sessions", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
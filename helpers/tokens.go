@@ -0,0 +1,287 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"forum/auth"
+	"forum/sessions"
+	"forum/store"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// APITokenPrefix starts every API token, so leaked tokens are easy to spot.
+const APITokenPrefix = "forum_"
+
+// MaxTokenNameLength is the longest name a token can be given.
+const MaxTokenNameLength = 100
+
+var errNoToken = errors.New("no API token")
+
+// GenerateAPIToken returns a new random token value.
+func GenerateAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return APITokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashAPIToken is what the store keeps instead of the token. Tokens are
+// random, so a plain SHA-256 is enough and lets them be looked up directly.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+type (
+	tokenUserKey struct{}
+	bearerKey    struct{}
+)
+
+// tokenUser is the user a request authenticated as with an API token.
+type tokenUser struct {
+	user   store.User
+	scopes auth.Scopes
+}
+
+// authenticateToken looks up the request's bearer token. It returns
+// errNoToken when the request has none and store.ErrNotFound when the token
+// is unknown or revoked.
+func authenticateToken(r *http.Request, st store.TokenStore) (store.User, auth.Scopes, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return store.User{}, nil, errNoToken
+	}
+	user, apiToken, err := st.UseAPIToken(HashAPIToken(token))
+	if err != nil {
+		return store.User{}, nil, err
+	}
+	scopes, err := auth.ParseScopes(apiToken.Scopes)
+	if err != nil {
+		return store.User{}, nil, err
+	}
+	return user, scopes, nil
+}
+
+// Tokens authenticates requests with an "Authorization: Bearer" header
+// before the session and CSRF middleware see them. Such a request is made
+// with its token or not at all: an unknown or revoked token is refused, and
+// the request's cookies are dropped so no session is looked up for it. The
+// routes that accept tokens take the owner from bearer; the others treat the
+// request as a guest's.
+func Tokens(st store.TokenStore, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, scopes, err := authenticateToken(r, st)
+		if errors.Is(err, errNoToken) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		api := strings.HasPrefix(r.URL.Path, APIPrefix)
+		if errors.Is(err, store.ErrNotFound) {
+			if api {
+				writeAPIError(w, http.StatusUnauthorized, "invalid_token", "The API token is unknown or revoked")
+			} else {
+				http.Error(w, "Invalid API token", http.StatusUnauthorized)
+			}
+			return
+		} else if err != nil {
+			if api {
+				apiDatabaseError(w, err)
+			} else {
+				log.Println("Database error:", err)
+				errorHandler(w, "Internal Server Error", 500)
+			}
+			return
+		}
+		r = r.Clone(context.WithValue(r.Context(), bearerKey{}, tokenUser{user: user, scopes: scopes}))
+		r.Header.Del("Cookie")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bearer returns the owner and scopes of the token the Tokens middleware
+// authenticated the request with.
+func bearer(r *http.Request) (store.User, auth.Scopes, bool) {
+	t, ok := r.Context().Value(bearerKey{}).(tokenUser)
+	return t.user, t.scopes, ok
+}
+
+// withTokenUser makes GetLoggedInUser return the token's owner for the rest
+// of the request.
+func withTokenUser(r *http.Request, user store.User, scopes auth.Scopes) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), tokenUserKey{}, tokenUser{user: user, scopes: scopes}))
+}
+
+// tokenScopes returns the scopes of the token the request authenticated
+// with, or false for requests made with a session.
+func tokenScopes(r *http.Request) (auth.Scopes, bool) {
+	t, ok := r.Context().Value(tokenUserKey{}).(tokenUser)
+	return t.scopes, ok
+}
+
+// AcceptTokens lets scripts call a route with an API token: a request the
+// Tokens middleware authenticated is made as the token's owner, and may do
+// what both the owner's role and the token's scopes allow. Reading, with GET
+// or HEAD, needs the read scope, as in the API. On other routes such a
+// request is a guest's.
+func AcceptTokens(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user, scopes, ok := bearer(r); ok {
+			if reads(r) && !scopes.Has(auth.ScopeRead) {
+				http.Error(w, "The API token lacks the read scope", http.StatusForbidden)
+				return
+			}
+			r = withTokenUser(r, user, scopes)
+		}
+		next(w, r)
+	}
+}
+
+// reads reports whether the request only reads, which tokens need the read
+// scope for.
+func reads(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead
+}
+
+// RequireWithTokens is Require for routes that accept API tokens.
+func RequireWithTokens(st store.Store, permission auth.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return AcceptTokens(Require(st, permission, next))
+}
+
+// AccountHandler serves the account pages, where users manage their API
+// tokens, sessions and two-factor authentication:
+//
+//	GET  /account                         the API tokens page
+//	POST /account/tokens                  create a token
+//	POST /account/tokens/{id}/revoke      revoke a token
+//	GET  /account/sessions                the sessions page
+//	POST /account/sessions/{id}/revoke    log out a session
+//	GET  /account/2fa                     the two-factor page, see
+//	                                      accountTwoFactor for the rest
+func AccountHandler(w http.ResponseWriter, r *http.Request, st store.Store, sm *sessions.Manager) {
+	user, err := GetLoggedInUser(r, st)
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/account"), "/")
+	if rest == "" {
+		accountPage(w, r, st, user, "")
+		return
+	}
+	if rest == "sessions" || strings.HasPrefix(rest, "sessions/") {
+		accountSessions(w, r, st, sm, user, strings.TrimPrefix(rest, "sessions"))
+		return
+	}
+	if rest == "2fa" || strings.HasPrefix(rest, "2fa/") {
+		accountTwoFactor(w, r, st, user, strings.TrimPrefix(rest, "2fa"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if rest == "tokens" {
+		createAPIToken(w, r, st, user)
+		return
+	}
+
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 || parts[0] != "tokens" || parts[2] != "revoke" {
+		errorHandler(w, "Page not found", 404)
+		return
+	}
+	tokenID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		errorHandler(w, "Page not found", 404)
+		return
+	}
+	err = st.RevokeAPIToken(user.UserID, tokenID)
+	if errors.Is(err, store.ErrNotFound) {
+		errorHandler(w, "We cannot find this token", 404)
+		return
+	} else if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func createAPIToken(w http.ResponseWriter, r *http.Request, st store.Store, user store.User) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Form parsing error", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > MaxTokenNameLength {
+		http.Error(w, "Give the token a name of at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	scopes, err := auth.ParseScopes(r.Form["scopes"])
+	if err != nil {
+		http.Error(w, "Choose the token's scopes: read, write or moderate", http.StatusBadRequest)
+		return
+	}
+
+	token, err := GenerateAPIToken()
+	if err != nil {
+		log.Println("Error generating an API token:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	if _, err := st.AddAPIToken(user.UserID, name, HashAPIToken(token), names); err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+	// The token is shown this once, so the page is rendered rather than
+	// redirected to
+	accountPage(w, r, st, user, token)
+}
+
+func accountPage(w http.ResponseWriter, r *http.Request, st store.Store, user store.User, newToken string) {
+	tokens, err := st.GetAPITokens(user.UserID)
+	if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+
+	data := struct {
+		Tokens   []store.APIToken
+		NewToken string
+		Scopes   []auth.Scope
+		Header   HeaderData
+	}{
+		Tokens:   tokens,
+		NewToken: newToken,
+		Scopes:   auth.AllScopes,
+		Header:   newHeaderData(r, user),
+	}
+	if err := render(w, r, "account", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
@@ -0,0 +1,509 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"forum/auth"
+	"forum/sessions"
+	"forum/store"
+	"forum/totp"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// LoginChallengeTTL is how long a user has to enter their code after
+	// their password.
+	LoginChallengeTTL = 5 * time.Minute
+	// MaxLoginAttempts is how many wrong codes end a login.
+	MaxLoginAttempts = 5
+	// MaxSecondFactorFailures is how many wrong codes in a row, over any
+	// number of logins, lock a user's second factor.
+	MaxSecondFactorFailures = 10
+	// SecondFactorLockout is how long it then stays locked.
+	SecondFactorLockout = 15 * time.Minute
+	// RecoveryCodeCount is how many recovery codes a user gets at a time.
+	RecoveryCodeCount = 10
+	// TwoFactorIssuer names the forum in authenticator apps.
+	TwoFactorIssuer = "Forum"
+)
+
+// loginChallengeCookie holds the token of a login waiting for its code.
+const loginChallengeCookie = "login_challenge"
+
+// SettingRequireTwoFactor is the setting that, when "true", keeps moderators
+// and admins from using their rights until they turn on two-factor
+// authentication.
+const SettingRequireTwoFactor = "require_2fa"
+
+// Settings caches the settings admins change from the forum, which roleOf
+// needs for every check, next to the email verification policy main reads
+// from the environment. LoadSettings reads them from the store, and the
+// pages that change them keep them in step with it. Settings.Handler hands
+// them to the requests.
+type Settings struct {
+	requireTwoFactor atomic.Bool
+	verification     VerificationPolicy
+}
+
+// LoadSettings reads the settings from the store, for a forum with the
+// verification policy. main calls it before serving.
+func LoadSettings(st store.SettingStore, verification VerificationPolicy) (*Settings, error) {
+	value, err := st.GetSetting(SettingRequireTwoFactor)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	settings := &Settings{verification: verification}
+	settings.requireTwoFactor.Store(value == "true")
+	return settings, nil
+}
+
+// RequireTwoFactor reports whether SettingRequireTwoFactor is on.
+func (s *Settings) RequireTwoFactor() bool {
+	return s.requireTwoFactor.Load()
+}
+
+// Verification returns the email verification policy; optional unless
+// LoadSettings was given another.
+func (s *Settings) Verification() VerificationPolicy {
+	if s.verification == "" {
+		return VerifyOptional
+	}
+	return s.verification
+}
+
+type settingsKey struct{}
+
+// Handler makes the settings those of the requests next serves.
+func (s *Settings) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), settingsKey{}, s)))
+	})
+}
+
+// settingsOf returns the settings Settings.Handler gave the request.
+// Without them the requirements they set are all off.
+func settingsOf(r *http.Request) *Settings {
+	if s, ok := r.Context().Value(settingsKey{}).(*Settings); ok {
+		return s
+	}
+	return &Settings{}
+}
+
+// needsTwoFactor reports whether the user holds a role they may only use
+// with two-factor authentication, and has not turned it on.
+func needsTwoFactor(r *http.Request, user store.User) bool {
+	role := auth.Role(user.Role)
+	return (role == auth.Moderator || role == auth.Admin) && !user.TwoFactor && settingsOf(r).RequireTwoFactor()
+}
+
+// twoFactorPage is the data of the two-factor page of the account.
+type twoFactorPage struct {
+	Enabled       bool
+	Required      bool         // the user's role needs it
+	Secret        string       // of an app being set up
+	URI           template.URL // the otpauth URI of Secret, trusted so templates link it
+	RecoveryCodes []string
+	CodesLeft     int
+	Message       string
+	Header        HeaderData
+}
+
+// accountTwoFactor serves the two-factor pages of the account. rest is the
+// path after /account/2fa:
+//
+//	GET  /account/2fa                   whether it is on, and the forms
+//	POST /account/2fa/setup             start setting up an app
+//	POST /account/2fa/enable            confirm the app with a code
+//	POST /account/2fa/disable           turn it off
+//	POST /account/2fa/recovery-codes    replace the recovery codes
+func accountTwoFactor(w http.ResponseWriter, r *http.Request, st store.Store, user store.User, rest string) {
+	data := twoFactorPage{
+		Enabled:  user.TwoFactor,
+		Required: needsTwoFactor(r, user),
+		Header:   newHeaderData(r, user),
+	}
+	action := strings.Trim(rest, "/")
+	if action == "" {
+		twoFactorPageFor(w, r, st, user, data)
+		return
+	}
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !user.TwoFactor && (action == "disable" || action == "recovery-codes") {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+
+	var err error
+	switch action {
+	case "setup":
+		err = setupTwoFactor(st, user, &data)
+	case "enable":
+		err = enableTwoFactor(r, st, user, r.FormValue("code"), &data)
+	case "disable":
+		var ok bool
+		if ok, err = checkSecondFactor(st, user.UserID, r.FormValue("code")); err == nil && ok {
+			err = st.DisableTOTP(user.UserID)
+			if err == nil {
+				http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+				return
+			}
+		} else if err == nil {
+			data.Message = "That code is not right."
+		}
+	case "recovery-codes":
+		var ok bool
+		if ok, err = checkSecondFactor(st, user.UserID, r.FormValue("code")); err == nil && ok {
+			var hashes []string
+			if data.RecoveryCodes, hashes, err = newRecoveryCodes(); err == nil {
+				err = st.ReplaceRecoveryCodes(user.UserID, hashes)
+			}
+		} else if err == nil {
+			data.Message = "That code is not right."
+		}
+	default:
+		errorHandler(w, "Page not found", 404)
+		return
+	}
+	if errors.Is(err, errSecondFactorLocked) {
+		data.Message = lockedMessage
+		err = nil
+	}
+	if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+	twoFactorPageFor(w, r, st, user, data)
+}
+
+func twoFactorPageFor(w http.ResponseWriter, r *http.Request, st store.Store, user store.User, data twoFactorPage) {
+	if data.Enabled {
+		count, err := st.CountRecoveryCodes(user.UserID)
+		if err != nil {
+			log.Println("Database error:", err)
+			errorHandler(w, "Internal Server Error", 500)
+			return
+		}
+		data.CodesLeft = count
+	}
+	if err := render(w, r, "two-factor", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
+
+// setupTwoFactor gives the user a new secret to add to their app. It only
+// counts once they confirm it with a code.
+func setupTwoFactor(st store.Store, user store.User, data *twoFactorPage) error {
+	if user.TwoFactor {
+		data.Message = "Two-factor authentication is already on."
+		return nil
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return err
+	}
+	if err := st.SetTOTPSecret(user.UserID, secret); err != nil {
+		return err
+	}
+	data.Secret = secret
+	data.URI = template.URL(totp.URI(secret, TwoFactorIssuer, user.Username))
+	return nil
+}
+
+// enableTwoFactor turns two-factor authentication on once the code shows
+// the user's app has the secret, and hands out the first recovery codes.
+func enableTwoFactor(r *http.Request, st store.Store, user store.User, code string, data *twoFactorPage) error {
+	secret, err := st.GetTOTPSecret(user.UserID)
+	if err != nil || user.TwoFactor || secret == "" {
+		return err
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		data.Message = "That code is not right. Check the time on your phone, and try the newest code."
+		data.Secret = secret
+		data.URI = template.URL(totp.URI(secret, TwoFactorIssuer, user.Username))
+		return nil
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	if err := st.EnableTOTP(user.UserID, step, hashes); err != nil {
+		return err
+	}
+	data.Enabled = true
+	data.Required = false
+	data.RecoveryCodes = codes
+	user.TwoFactor = true
+	data.Header = newHeaderData(r, user)
+	return nil
+}
+
+// errSecondFactorLocked is returned by checkSecondFactor while too many
+// wrong codes lock the user's second factor.
+var errSecondFactorLocked = errors.New("too many wrong two-factor codes")
+
+// lockedMessage tells users their second factor is locked.
+var lockedMessage = fmt.Sprintf("Too many wrong codes. Wait %d minutes and try again.", int(SecondFactorLockout.Minutes()))
+
+// checkSecondFactor reports whether code is the user's current code, or one
+// of their unused recovery codes, and uses it up. Wrong codes count against
+// the user on every login and page, so starting a new login does not earn
+// more guesses: MaxSecondFactorFailures of them in a row lock the second
+// factor for SecondFactorLockout, during which it returns
+// errSecondFactorLocked without looking at the code.
+func checkSecondFactor(st store.Store, userID int, code string) (bool, error) {
+	lockedUntil, err := st.GetSecondFactorLock(userID)
+	if err != nil {
+		return false, err
+	}
+	if !lockedUntil.IsZero() {
+		return false, errSecondFactorLocked
+	}
+	ok, err := matchSecondFactor(st, userID, code)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return true, st.ResetSecondFactorFailures(userID)
+	}
+	locked, err := st.FailSecondFactor(userID, MaxSecondFactorFailures, time.Now().Add(SecondFactorLockout))
+	if err == nil && locked {
+		err = errSecondFactorLocked
+	}
+	return false, err
+}
+
+// matchSecondFactor reports whether code is the user's current code, or one
+// of their unused recovery codes, and uses it up.
+func matchSecondFactor(st store.Store, userID int, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		secret, err := st.GetTOTPSecret(userID)
+		if err != nil || secret == "" {
+			return false, err
+		}
+		step, ok := totp.Validate(secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return st.UseTOTPStep(userID, step)
+	}
+	return st.UseRecoveryCode(userID, hashRecoveryCode(code))
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns RecoveryCodeCount codes to show the user once,
+// and the hashes of them to store.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		code = code[:4] + "-" + code[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode is what the store keeps of a recovery code. Case, spaces
+// and dashes do not count, so the code may be typed as it is read.
+func hashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// loginPage is the data of the page that asks for the code after the
+// password.
+type loginPage struct {
+	Message string
+	Expired bool // the login has to start over
+	Locked  bool // because too many wrong codes locked the second factor
+	Header  HeaderData
+}
+
+// startLoginChallenge holds a login whose password was right until the user
+// enters their code, and asks for it.
+func startLoginChallenge(w http.ResponseWriter, r *http.Request, st store.Store, sm *sessions.Manager, user store.User) {
+	token, err := newMailToken()
+	if err != nil {
+		log.Println("Error generating a login token:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+	if err := st.AddLoginChallenge(user.UserID, hashMailToken(token), time.Now().Add(LoginChallengeTTL)); err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginChallengeCookie,
+		Value:    token,
+		Path:     "/login",
+		MaxAge:   int(LoginChallengeTTL / time.Second),
+		HttpOnly: true,
+		Secure:   sm.SecureCookie(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	if err := render(w, r, "login-2fa", loginPage{Header: newHeaderData(r, store.User{})}); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
+
+func clearLoginChallenge(w http.ResponseWriter, r *http.Request, sm *sessions.Manager) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginChallengeCookie,
+		Value:    "",
+		Path:     "/login",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   sm.SecureCookie(r),
+	})
+}
+
+// LoginTwoFactorHandler serves POST /login/2fa, the second step of logging
+// in for users with two-factor authentication: the code from their app, or
+// a recovery code.
+func LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request, st store.Store, sm *sessions.Manager) {
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data := loginPage{Header: newHeaderData(r, store.User{})}
+
+	var tokenHash string
+	userID := 0
+	cookie, err := r.Cookie(loginChallengeCookie)
+	if err == nil {
+		tokenHash = hashMailToken(cookie.Value)
+		userID, err = st.GetLoginChallenge(tokenHash)
+	}
+	switch {
+	case errors.Is(err, http.ErrNoCookie), errors.Is(err, store.ErrNotFound):
+		data.Expired = true
+	case err != nil:
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	default:
+		if !secondLoginStep(w, r, st, sm, userID, tokenHash, &data) {
+			return
+		}
+	}
+	if data.Locked {
+		data.Message = lockedMessage
+		clearLoginChallenge(w, r, sm)
+	} else if data.Expired {
+		data.Message = "This login has expired. Log in again."
+		clearLoginChallenge(w, r, sm)
+	}
+	if err := render(w, r, "login-2fa", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
+
+// secondLoginStep logs the user in when the form's code is right, or sets
+// the page's message to why not. It returns false when it answered the
+// request itself.
+func secondLoginStep(w http.ResponseWriter, r *http.Request, st store.Store, sm *sessions.Manager, userID int, tokenHash string, data *loginPage) bool {
+	ok, err := checkSecondFactor(st, userID, r.FormValue("code"))
+	if errors.Is(err, errSecondFactorLocked) {
+		// The login has to start over once the lock ends
+		if err := st.DeleteLoginChallenge(tokenHash); err != nil {
+			log.Println("Database error:", err)
+		}
+		data.Expired = true
+		data.Locked = true
+		return true
+	} else if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return false
+	}
+	if !ok {
+		open, err := st.FailLoginChallenge(tokenHash, MaxLoginAttempts)
+		if err != nil {
+			log.Println("Database error:", err)
+			errorHandler(w, "Internal Server Error", 500)
+			return false
+		}
+		data.Message = "That code is not right."
+		data.Expired = !open
+		return true
+	}
+
+	if err := st.DeleteLoginChallenge(tokenHash); err != nil {
+		log.Println("Database error:", err)
+	}
+	clearLoginChallenge(w, r, sm)
+	if err := sm.Start(w, r, userID); err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	// From now on the forms carry the session's CSRF token
+	clearCSRFSecret(w)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+	return false
+}
+
+// AdminSecurityHandler serves /admin/security, where admins decide whether
+// moderators and admins need two-factor authentication to use their
+// rights.
+func AdminSecurityHandler(w http.ResponseWriter, r *http.Request, st store.Store, settings *Settings) {
+	user, _ := GetLoggedInUser(r, st)
+	data := struct {
+		Required bool
+		Message  string
+		Header   HeaderData
+	}{Header: newHeaderData(r, user)}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		require := r.FormValue("require_2fa") == "on"
+		if require && !user.TwoFactor {
+			// Or the admin would lose the rights to undo it on the spot
+			data.Message = "Turn on two-factor authentication for your own account first."
+			break
+		}
+		value := "false"
+		if require {
+			value = "true"
+		}
+		if err := st.SetSetting(SettingRequireTwoFactor, value); err != nil {
+			log.Println("Database error:", err)
+			errorHandler(w, "Internal Server Error", 500)
+			return
+		}
+		settings.requireTwoFactor.Store(require)
+		http.Redirect(w, r, "/admin/security", http.StatusSeeOther)
+		return
+	default:
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data.Required = settings.RequireTwoFactor()
+	if err := render(w, r, "admin-security", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
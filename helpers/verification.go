@@ -0,0 +1,252 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"forum/mail"
+	"forum/store"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VerificationPolicy decides what users may do before they verify their
+// email address.
+type VerificationPolicy string
+
+const (
+	// VerifyOptional lets unverified users do all their role allows; they
+	// are only reminded to verify.
+	VerifyOptional VerificationPolicy = "optional"
+	// VerifyReadOnly lets unverified users log in and read, but not post,
+	// comment, react or report.
+	VerifyReadOnly VerificationPolicy = "read-only"
+	// VerifyRequired does not let unverified users log in.
+	VerifyRequired VerificationPolicy = "required"
+)
+
+var ErrInvalidVerificationPolicy = errors.New("email verification must be optional, read-only or required")
+
+// ErrVerificationWithoutMail is returned for a policy that restricts
+// unverified users when emails only go to the log, which leaves out the
+// secrets of their links: nobody could verify.
+var ErrVerificationWithoutMail = errors.New("email verification can only be read-only or required when emails are " +
+	"sent: set MAIL_URL, or set EMAIL_VERIFICATION=optional")
+
+// ParseVerificationPolicy reads the policy EMAIL_VERIFICATION names for
+// emails sent through the mailer. The empty string is read-only, or
+// optional when emails only go to the log.
+func ParseVerificationPolicy(s string, mailer mail.Mailer) (VerificationPolicy, error) {
+	_, logOnly := mailer.(mail.Log)
+	switch policy := VerificationPolicy(s); policy {
+	case "":
+		if logOnly {
+			return VerifyOptional, nil
+		}
+		return VerifyReadOnly, nil
+	case VerifyOptional:
+		return policy, nil
+	case VerifyReadOnly, VerifyRequired:
+		if logOnly {
+			return "", ErrVerificationWithoutMail
+		}
+		return policy, nil
+	}
+	return "", ErrInvalidVerificationPolicy
+}
+
+// restricted reports whether the policy keeps the user from writing.
+func restricted(r *http.Request, user store.User) bool {
+	return user.Username != "" && !user.EmailVerified && settingsOf(r).Verification() != VerifyOptional
+}
+
+const (
+	// VerificationLinkTTL is how long a link to verify an email works.
+	VerificationLinkTTL = 48 * time.Hour
+	// VerificationResendInterval is how long a user waits before they can be
+	// sent another link.
+	VerificationResendInterval = 5 * time.Minute
+)
+
+// maxEmailLength is the longest address SMTP can deliver to.
+const maxEmailLength = 254
+
+// validEmail checks the syntax of an email address: a bare address, without
+// a display name, whose domain has a dot in it.
+func validEmail(email string) bool {
+	if len(email) > maxEmailLength {
+		return false
+	}
+	address, err := netmail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return false
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	return strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
+
+// verifyPage is the data of the verify-email page, which tells users how
+// verifying went and lets them ask for another link.
+type verifyPage struct {
+	Message string
+	Done    bool // the email is verified
+	Resend  bool // show the form asking for another link
+	Header  HeaderData
+}
+
+// verificationLink returns the signed link that verifies the user's email
+// until expires. It holds no secret of the store, so it is checked by its
+// signature alone.
+func (m *Mail) verificationLink(user store.User, expires time.Time) string {
+	expiresStr := strconv.FormatInt(expires.Unix(), 10)
+	return m.link("/verify-email", url.Values{
+		"email":   {user.Email},
+		"expires": {expiresStr},
+		"sig":     {m.sign("verify-email", strconv.Itoa(user.UserID), strings.ToLower(user.Email), expiresStr)},
+	})
+}
+
+// sendVerification mails the user a link to verify their email, unless one
+// was sent less than VerificationResendInterval ago. It reports whether it
+// sent one; one it failed to send does not count towards the interval.
+func sendVerification(st store.Store, m *Mail, user store.User) (bool, error) {
+	ok, err := st.ClaimEmail(user.UserID, store.EmailVerification, time.Now().Add(-VerificationResendInterval))
+	if err != nil || !ok {
+		return false, err
+	}
+	link := m.verificationLink(user, time.Now().Add(VerificationLinkTTL))
+	err = m.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your forum email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"To finish setting up your forum account, verify your email address by opening this link "+
+			"within two days:\n\n%s\n\n"+
+			"If you did not make an account, ignore this email.\n",
+			user.Username, link),
+	})
+	if err != nil {
+		releaseEmail(st, user.UserID, store.EmailVerification)
+		return false, err
+	}
+	return true, nil
+}
+
+// VerifyEmailHandler serves /verify-email, the page the emailed link opens.
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request, st store.Store, m *Mail) {
+	if r.Method != http.MethodGet {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, _ := GetLoggedInUser(r, st)
+	data := verifyPage{Header: newHeaderData(r, user)}
+
+	verified, err := verifyEmail(st, m, r.URL.Query())
+	if err != nil {
+		log.Println("Database error:", err)
+		errorHandler(w, "Internal Server Error", 500)
+		return
+	}
+	if verified {
+		data.Done = true
+		// The header stops asking the user to verify
+		if user, err = GetLoggedInUser(r, st); err == nil {
+			data.Header = newHeaderData(r, user)
+		}
+	} else {
+		data.Message = "This link has expired or is not valid. Ask for a new one."
+		data.Resend = true
+	}
+	if err := render(w, r, "verify-email", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
+
+// verifyEmail checks the signature and expiry of a verification link, and
+// marks the email it was sent to verified. It reports false for links that
+// do not verify anything.
+func verifyEmail(st store.Store, m *Mail, query url.Values) (bool, error) {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false, nil
+	}
+	user, err := st.GetUserByEmail(query.Get("email"))
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	// Signed for this user and their current address
+	want := m.sign("verify-email", strconv.Itoa(user.UserID), strings.ToLower(user.Email), query.Get("expires"))
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(want)) {
+		return false, nil
+	}
+	if user.EmailVerified {
+		return true, nil
+	}
+	return true, st.VerifyEmail(user.UserID)
+}
+
+// ResendVerificationHandler serves POST /verify-email/resend, which sends
+// another link: to the logged-in user, or to the email in the form for
+// visitors the required policy keeps from logging in. Visitors get the same
+// answer whether or not the email belongs to a user, before it is looked up
+// and sent, as on the forgot-password page.
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request, st store.Store, m *Mail) {
+	if r.Method != http.MethodPost {
+		errorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, err := GetLoggedInUser(r, st)
+	data := verifyPage{Header: newHeaderData(r, user)}
+	if err != nil {
+		email := strings.TrimSpace(r.FormValue("email"))
+		m.later("a verification email", func() error { return resendVerification(st, m, email) })
+		data.Message = "If an account with this email still needs verifying, we have sent it a new link."
+		if err := render(w, r, "verify-email", data); err != nil {
+			errorHandler(w, "Internal server error", 500)
+		}
+		return
+	}
+
+	sent := false
+	if !user.EmailVerified {
+		if sent, err = sendVerification(st, m, user); err != nil {
+			log.Println("Error sending a verification email:", err)
+			errorHandler(w, "We could not send the email, try again later", 500)
+			return
+		}
+	}
+	switch {
+	case user.EmailVerified:
+		data.Done = true
+	case sent:
+		data.Message = fmt.Sprintf("We have sent a new link to %s.", user.Email)
+	default:
+		data.Message = fmt.Sprintf("We sent you a link a moment ago. Check your inbox, or ask again in %d minutes.",
+			int(VerificationResendInterval.Minutes()))
+	}
+	if err := render(w, r, "verify-email", data); err != nil {
+		errorHandler(w, "Internal server error", 500)
+	}
+}
+
+// resendVerification mails a new link to the user with the email, if there
+// is one whose email still needs verifying.
+func resendVerification(st store.Store, m *Mail, email string) error {
+	user, err := st.GetUserByEmail(email)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	_, err = sendVerification(st, m, user)
+	return err
+}
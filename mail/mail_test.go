@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogLeavesOutLinkSecrets(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	err := Log{}.Send(Message{
+		To:      "alice@example.com",
+		Subject: "Links",
+		Body: "Reset: http://forum.test/reset-password?token=abc123\n" +
+			"Verify: http://forum.test/verify-email?email=alice%40example.com&expires=99&sig=s1g%3D\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged := out.String()
+	for _, secret := range []string{"abc123", "s1g"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("the log shows %q:\n%s", secret, logged)
+		}
+	}
+	for _, want := range []string{"reset-password?token=REDACTED\n", "email=alice%40example.com&expires=99&sig=REDACTED\n"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("the log does not show %q:\n%s", want, logged)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// SMTP sends messages through an SMTP server. It uses STARTTLS when the
+// server offers it, and only logs in when Username is set.
+type SMTP struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTP) Send(msg Message) error {
+	if err := msg.check(); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		// PlainAuth refuses to send the password unencrypted, except to
+		// localhost
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, msg.format(s.From, time.Now()))
+}
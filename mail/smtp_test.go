@@ -0,0 +1,184 @@
+package mail
+
+import (
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSMTP is an SMTP server that accepts every message and keeps it.
+type fakeSMTP struct {
+	net.Listener
+	auth bool // offer AUTH PLAIN
+
+	mu       sync.Mutex
+	received []received
+}
+
+// received is one message as the server got it.
+type received struct {
+	auth string // the AUTH command, if the client logged in
+	from string
+	to   []string
+	data string
+}
+
+func newFakeSMTP(t *testing.T, auth bool) *fakeSMTP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{Listener: listener, auth: auth}
+	t.Cleanup(func() { s.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(textproto.NewConn(conn))
+		}
+	}()
+	return s
+}
+
+// serve speaks just enough SMTP for net/smtp.SendMail.
+func (s *fakeSMTP) serve(conn *textproto.Conn) {
+	defer conn.Close()
+	var msg received
+	conn.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if s.auth {
+				conn.PrintfLine("250-fake")
+				conn.PrintfLine("250 AUTH PLAIN")
+			} else {
+				conn.PrintfLine("250 fake")
+			}
+		case "AUTH":
+			msg.auth = arg
+			conn.PrintfLine("235 Logged in")
+		case "MAIL":
+			msg.from = strings.TrimPrefix(arg, "FROM:")
+			conn.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, strings.TrimPrefix(arg, "TO:"))
+			conn.PrintfLine("250 OK")
+		case "DATA":
+			conn.PrintfLine("354 Go ahead")
+			data, err := conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.mu.Lock()
+			s.received = append(s.received, msg)
+			s.mu.Unlock()
+			msg = received{}
+			conn.PrintfLine("250 Queued")
+		case "QUIT":
+			conn.PrintfLine("221 Bye")
+			return
+		default:
+			conn.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTP) messages() []received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]received(nil), s.received...)
+}
+
+func TestSMTPSend(t *testing.T) {
+	server := newFakeSMTP(t, false)
+	mailer := &SMTP{Addr: server.Addr().String(), From: "forum@example.com"}
+	err := mailer.Send(Message{
+		To:      "alice@example.com",
+		Subject: "Hello, Ünïcode",
+		Body:    "First line\n.A line starting with a dot\nLast line",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := server.messages()
+	if len(messages) != 1 {
+		t.Fatalf("the server got %d messages, want 1", len(messages))
+	}
+	msg := messages[0]
+	if msg.auth != "" {
+		t.Errorf("logged in with %q without a username", msg.auth)
+	}
+	if msg.from != "<forum@example.com>" || len(msg.to) != 1 || msg.to[0] != "<alice@example.com>" {
+		t.Errorf("the envelope is from %s to %v", msg.from, msg.to)
+	}
+	// ReadDotBytes undoes the dot-stuffing and turns CRLF into LF
+	for _, want := range []string{
+		"From: forum@example.com\n",
+		"To: alice@example.com\n",
+		"Subject: =?utf-8?q?Hello,_=C3=9Cn=C3=AFcode?=\n",
+		"\n\nFirst line\n.A line starting with a dot\nLast line\n",
+	} {
+		if !strings.Contains(msg.data, want) {
+			t.Errorf("the message does not contain %q:\n%s", want, msg.data)
+		}
+	}
+}
+
+func TestSMTPLogsIn(t *testing.T) {
+	server := newFakeSMTP(t, true)
+	mailer := &SMTP{Addr: server.Addr().String(), From: "forum@example.com", Username: "forum", Password: "secret"}
+	if err := mailer.Send(Message{To: "alice@example.com", Subject: "Hi", Body: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	messages := server.messages()
+	want := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00forum\x00secret"))
+	if len(messages) != 1 || messages[0].auth != want {
+		t.Errorf("got %+v, want one message sent after AUTH %s", messages, want)
+	}
+}
+
+func TestSMTPFails(t *testing.T) {
+	withoutAuth := newFakeSMTP(t, false)
+	closed := newFakeSMTP(t, false)
+	closed.Close()
+
+	tests := []struct {
+		name   string
+		mailer *SMTP
+		msg    Message
+	}{
+		{"a header injection", &SMTP{Addr: withoutAuth.Addr().String(), From: "forum@example.com"},
+			Message{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Hi", Body: "Hi"}},
+		{"no AUTH to log in with", &SMTP{Addr: withoutAuth.Addr().String(), From: "forum@example.com", Username: "forum", Password: "secret"},
+			Message{To: "alice@example.com", Subject: "Hi", Body: "Hi"}},
+		{"no server", &SMTP{Addr: closed.Addr().String(), From: "forum@example.com"},
+			Message{To: "alice@example.com", Subject: "Hi", Body: "Hi"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.mailer.Send(tc.msg); err == nil {
+				t.Error("sending succeeded")
+			}
+		})
+	}
+	if n := len(withoutAuth.messages()); n != 0 {
+		t.Errorf("the server got %d messages", n)
+	}
+	if err := (&SMTP{}).Send(Message{To: "a\nb"}); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("got %v, want ErrInvalidMessage", err)
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
-	"database/sql"
+	"crypto/rand"
 	"fmt"
 	"forum/database"
+	"forum/events"
 	"forum/helpers"
+	"forum/mail"
+	"forum/ranking"
+	"forum/routes"
+	"forum/sessions"
+	"forum/store"
 	"log"
 	"net/http"
 	"os"
@@ -12,61 +18,95 @@ import (
 )
 
 func main() {
-	db, err := database.OpenDB()
+	db, dialect, err := database.OpenDB()
 	if err != nil {
 		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if len(os.Args) > 1 {
+		if err := runCommand(db, dialect, os.Args[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := database.Migrate(db, dialect); err != nil {
+		fmt.Println("Error migrating database:", err)
 		return
 	}
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	go StartSessionCleanupTask(db)
-	mux := http.NewServeMux()
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		helpers.IndexHandler(w, r, db)
-	})
-	// mux.HandleFunc("/logout", helpers.LogoutHandler)
-	mux.HandleFunc("/add-post", func(w http.ResponseWriter, r *http.Request) {
-		helpers.AddPostHandler(w, r, db)
-	})
-	mux.HandleFunc("/create-post", func(w http.ResponseWriter, r *http.Request) {
-		helpers.CreatePostPageHandler(w, r, db)
-	})
-	mux.HandleFunc("/submit-comment", func(w http.ResponseWriter, r *http.Request) {
-		helpers.SubmitCommentHandler(w, r, db)
-	})
-	mux.HandleFunc("/update-reaction", func(w http.ResponseWriter, r *http.Request) {
-		helpers.UpdateReactionHandler(w, r, db)
-	})
-
-	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
-		helpers.RegisterHandler(w, r, db)
-	})
-	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
-		helpers.LoginHandler(w, r, db)
-	})
-	mux.HandleFunc("/post/", func(w http.ResponseWriter, r *http.Request) {
-		helpers.PostHandler(w, r, db)
-	})
-	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
-		helpers.LogoutHandler(w, r, db)
-	})
+	st := store.NewSQL(db, dialect)
+	go StartSessionCleanupTask(st)
+	hot := ranking.NewCache(st, ranking.Hot)
+	if err := hot.Refresh(); err != nil {
+		log.Println("Error ranking posts:", err)
+	}
+	go hot.Run(ranking.RefreshInterval)
+	sm := sessions.NewManager(st)
+	// Cookies are only sent over HTTPS unless SECURE_COOKIES=false, for
+	// trying the forum out over plain HTTP
+	sm.InsecureCookies = os.Getenv("SECURE_COOKIES") == "false"
+	mailer, err := mail.FromURL(os.Getenv("MAIL_URL"))
+	if err != nil {
+		fmt.Println("Error configuring mail:", err)
+		return
+	}
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
+	reg := routes.NewRegistry()
+	verification, err := helpers.ParseVerificationPolicy(os.Getenv("EMAIL_VERIFICATION"), mailer)
+	if err != nil {
+		fmt.Println("Error configuring email verification:", err)
+		return
+	}
+	settings, err := helpers.LoadSettings(st, verification)
+	if err != nil {
+		fmt.Println("Error loading settings:", err)
+		return
+	}
+	// Links that verify emails are signed with SECRET_KEY; without it they
+	// stop working when the server restarts
+	secret := []byte(os.Getenv("SECRET_KEY"))
+	if len(secret) == 0 {
+		fmt.Println("SECRET_KEY is not set; email verification links will only work until the server restarts")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			fmt.Println("Error generating a secret key:", err)
+			return
+		}
+	}
+	if err := registerRoutes(reg, st, hot, events.NewBus(), sm, &helpers.Mail{Mailer: mailer, BaseURL: baseURL, Secret: secret}, settings); err != nil {
+		fmt.Println("Error registering routes:", err)
+		return
+	}
 	fmt.Printf("Listening on port %v\n", port)
 	fmt.Println("server started . . .")
 	fmt.Println("ctrl(cmd) + click: http://localhost:8080/")
-	http.ListenAndServe(":"+port, mux)
+	http.ListenAndServe(":"+port, middleware(st, sm, settings, reg))
+}
 
-	defer db.Close()
+// middleware wraps the routes in what every request goes through: API
+// tokens are checked first, so requests made with one never reach a session
+// or skip the CSRF check without it, and the settings reach the permission
+// checks.
+func middleware(st store.Store, sm *sessions.Manager, settings *helpers.Settings, h http.Handler) http.Handler {
+	return helpers.Tokens(st, sm.Handler(settings.Handler(helpers.CSRF(h))))
 }
 
-func StartSessionCleanupTask(db *sql.DB) {
+func StartSessionCleanupTask(st store.SessionStore) {
 	ticker := time.NewTicker(1 * time.Hour) // Run cleanup task every hour
 	defer ticker.Stop()
 
 	for range ticker.C {
-		err := helpers.DeleteExpiredSessions(db)
+		err := st.DeleteExpiredSessions()
 		if err != nil {
 			log.Println("Error cleaning up expired sessions:", err)
 		}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"forum/helpers"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestForgotPassword checks that asking for a reset link answers the same,
+// before any email goes out, whether or not the email has an account, and
+// that an account is not sent a link each time it is asked for.
+func TestForgotPassword(t *testing.T) {
+	f := newTestForum(t)
+	f.addUser(t, "alice", "member")
+	f.addUser(t, "bob", "member")
+	c := f.client(t)
+	ask := func(email string) (int, string) {
+		t.Helper()
+		res, body := c.submit("/forgot-password", url.Values{"email": {email}})
+		return res.StatusCode, body
+	}
+
+	// The mailer does not send until it is let go, so the answers come
+	// before anything is sent.
+	f.mailer.hold = make(chan struct{})
+	status, body := ask("alice@example.com")
+	unknownStatus, unknownBody := ask("nobody@example.com")
+	if status != http.StatusOK || unknownStatus != status || unknownBody != body {
+		t.Errorf("answered %d for an account and %d for no account, or with different pages", status, unknownStatus)
+	}
+	if !strings.Contains(body, "If an account has this email") {
+		t.Errorf("the page does not say the link is on its way:\n%s", body)
+	}
+	close(f.mailer.hold)
+
+	sent := f.mailer.wait(t, 1)
+	if sent[0].To != "alice@example.com" || !strings.Contains(sent[0].Body, "http://forum.test/reset-password?token=") {
+		t.Errorf("sent %+v, want a reset link to alice", sent[0])
+	}
+
+	// Asking again within the interval sends alice nothing more, while bob
+	// still gets a first link.
+	if status, _ := ask("alice@example.com"); status != http.StatusOK {
+		t.Errorf("asking again answered %d", status)
+	}
+	ask("bob@example.com")
+	to := map[string]int{}
+	for _, msg := range f.mailer.wait(t, 2) {
+		to[msg.To]++
+	}
+	if to["alice@example.com"] != 1 || to["bob@example.com"] != 1 || len(to) != 2 {
+		t.Errorf("sent to %v, want one link each to alice and bob", to)
+	}
+}
+
+// TestFailedResetLinkCanBeAskedAgain checks that a link the mailer failed to
+// send does not keep the user from asking for another.
+func TestFailedResetLinkCanBeAskedAgain(t *testing.T) {
+	f := newTestForum(t)
+	f.addUser(t, "alice", "member")
+	c := f.client(t)
+
+	f.mailer.setDown(true)
+	if res, _ := c.submit("/forgot-password", url.Values{"email": {"alice@example.com"}}); res.StatusCode != http.StatusOK {
+		t.Fatalf("asking with the mailer down answered %d", res.StatusCode)
+	}
+	f.mailer.waitFailed(t, 1)
+
+	f.mailer.setDown(false)
+	c.submit("/forgot-password", url.Values{"email": {"alice@example.com"}})
+	if sent := f.mailer.wait(t, 1); sent[0].To != "alice@example.com" {
+		t.Errorf("sent %+v, want a link to alice", sent[0])
+	}
+}
+
+// TestMailQueueIsBounded checks that a burst of reset requests for many
+// accounts queues at most MailQueueSize emails while the mailer is busy,
+// and drops the rest rather than sending them all at once.
+func TestMailQueueIsBounded(t *testing.T) {
+	f := newTestForum(t)
+	burst := helpers.MailSenders + helpers.MailQueueSize + 20
+	for i := 0; i < burst; i++ {
+		f.addUser(t, fmt.Sprintf("user%d", i), "member")
+	}
+	c := f.client(t)
+
+	f.mailer.hold = make(chan struct{})
+	for i := 0; i < burst; i++ {
+		if res, _ := c.submit("/forgot-password", url.Values{"email": {fmt.Sprintf("user%d@example.com", i)}}); res.StatusCode != http.StatusOK {
+			t.Fatalf("request %d answered %d", i, res.StatusCode)
+		}
+	}
+	close(f.mailer.hold)
+
+	f.mailer.wait(t, helpers.MailQueueSize)
+	time.Sleep(50 * time.Millisecond)
+	if sent := len(f.mailer.messages()); sent > helpers.MailQueueSize+helpers.MailSenders {
+		t.Errorf("sent %d of %d links, want at most %d", sent, burst, helpers.MailQueueSize+helpers.MailSenders)
+	}
+}
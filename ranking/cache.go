@@ -0,0 +1,137 @@
+package ranking
+
+import (
+	"encoding/base64"
+	"forum/store"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RefreshInterval is how often the server rescores the posts.
+const RefreshInterval = time.Minute
+
+// Entry is one ranked post.
+type Entry struct {
+	PostID int
+	Score  float64
+}
+
+// Cache holds every visible post ranked by a ScoreFunc, so that requests
+// page through the ranking without scoring posts themselves. Posts added or
+// changed since the last Refresh keep their old place until the next one.
+type Cache struct {
+	st    store.PostStore
+	score ScoreFunc
+
+	mu     sync.RWMutex
+	ranked []Entry
+}
+
+func NewCache(st store.PostStore, score ScoreFunc) *Cache {
+	return &Cache{st: st, score: score}
+}
+
+// Refresh rescores every visible post.
+func (c *Cache) Refresh() error {
+	now := time.Now()
+	activity, err := c.st.GetPostActivity(now.Add(-VelocityWindow))
+	if err != nil {
+		return err
+	}
+	ranked := make([]Entry, len(activity))
+	for i, a := range activity {
+		ranked[i] = Entry{PostID: a.PostID, Score: c.score(a, now)}
+	}
+	sort.Slice(ranked, func(i, j int) bool { return before(ranked[i], ranked[j]) })
+
+	c.mu.Lock()
+	c.ranked = ranked
+	c.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the cache every interval, forever.
+func (c *Cache) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := c.Refresh(); err != nil {
+			log.Println("Error refreshing the hot ranking:", err)
+		}
+	}
+}
+
+// Page returns the IDs of at most limit posts ranked after the cursor, and
+// the cursor of the next page, empty on the last one. It returns
+// store.ErrInvalidCursor for a cursor it did not hand out.
+func (c *Cache) Page(after string, limit int) ([]int, string, error) {
+	var from Entry
+	if after != "" {
+		var ok bool
+		if from, ok = parseCursor(after); !ok {
+			return nil, "", store.ErrInvalidCursor
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// Scores move between refreshes, so the cursor is a position in the
+	// ranking rather than an index into it
+	start := 0
+	if after != "" {
+		start = sort.Search(len(c.ranked), func(i int) bool { return before(from, c.ranked[i]) })
+	}
+	end := len(c.ranked)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	var postIDs []int
+	for _, entry := range c.ranked[start:end] {
+		postIDs = append(postIDs, entry.PostID)
+	}
+	var next string
+	if end < len(c.ranked) {
+		next = cursor(c.ranked[end-1])
+	}
+	return postIDs, next, nil
+}
+
+// before orders entries by score and then by post ID, both descending.
+func before(a, b Entry) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.PostID > b.PostID
+}
+
+func cursor(entry Entry) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(SortHot + "\x00" +
+		strconv.FormatFloat(entry.Score, 'g', -1, 64) + "\x00" + strconv.Itoa(entry.PostID)))
+}
+
+func parseCursor(value string) (Entry, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return Entry{}, false
+	}
+	parts := strings.Split(string(raw), "\x00")
+	if len(parts) != 3 || parts[0] != SortHot {
+		return Entry{}, false
+	}
+	score, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return Entry{}, false
+	}
+	postID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{PostID: postID, Score: score}, true
+}
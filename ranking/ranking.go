@@ -0,0 +1,42 @@
+// Package ranking orders posts by a score computed from their activity, for
+// the "hot" listing of the index page.
+package ranking
+
+import (
+	"forum/store"
+	"math"
+	"time"
+)
+
+// SortHot is the sort order of the index page served from a Cache.
+const SortHot = "hot"
+
+// ScoreFunc scores the activity of a post as it stands at now. Posts with
+// higher scores rank first.
+type ScoreFunc func(activity store.PostActivity, now time.Time) float64
+
+const (
+	// VelocityWindow is how far back comments count as recent.
+	VelocityWindow = 24 * time.Hour
+	// CommentWeight is how many likes a recent comment is worth.
+	CommentWeight = 2
+	// Decay is the age that costs a post as much as a tenfold of points.
+	Decay = 12 * time.Hour
+)
+
+// Hot is the default ScoreFunc. A post's points are its likes minus its
+// dislikes plus CommentWeight for every recent comment; the score grows with
+// the logarithm of the points and falls steadily as the post ages, so new
+// posts with a little activity overtake old ones with a lot.
+func Hot(activity store.PostActivity, now time.Time) float64 {
+	points := float64(activity.Likes-activity.Dislikes) + CommentWeight*float64(activity.RecentComments)
+	order := math.Log10(1 + math.Abs(points))
+	if points < 0 {
+		order = -order
+	}
+	age := now.Sub(activity.CreatedAt)
+	if age < 0 {
+		age = 0
+	}
+	return order - float64(age)/float64(Decay)
+}
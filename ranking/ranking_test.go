@@ -0,0 +1,172 @@
+package ranking
+
+import (
+	"errors"
+	"forum/store"
+	"math"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestHotDecay(t *testing.T) {
+	// Points of 9 are worth one tenfold, which is what Decay costs
+	tests := []struct {
+		name     string
+		activity store.PostActivity
+		age      time.Duration
+		want     float64
+	}{
+		{"new and quiet", store.PostActivity{}, 0, 0},
+		{"quiet for one decay", store.PostActivity{}, Decay, -1},
+		{"nine likes", store.PostActivity{Likes: 9}, 0, 1},
+		{"nine likes a decay ago", store.PostActivity{Likes: 9}, Decay, 0},
+		{"nine dislikes", store.PostActivity{Dislikes: 9}, 0, -1},
+		{"recent comments count double", store.PostActivity{Likes: 4, Dislikes: 1, RecentComments: 3, Comments: 10}, 0, 1},
+		{"ninety-nine likes two decays ago", store.PostActivity{Likes: 99}, 2 * Decay, 0},
+		{"from the future", store.PostActivity{Likes: 9}, -time.Hour, 1},
+	}
+	for _, tt := range tests {
+		tt.activity.CreatedAt = start.Add(-tt.age)
+		if got := Hot(tt.activity, start); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHotOrdersATimeline(t *testing.T) {
+	// An early post with much activity, and two later ones with a tenth of it
+	early := store.PostActivity{PostID: 1, CreatedAt: start, Likes: 99}
+	soon := store.PostActivity{PostID: 2, CreatedAt: start.Add(Decay / 2), Likes: 9}
+	late := store.PostActivity{PostID: 3, CreatedAt: start.Add(Decay * 3 / 2), Likes: 9}
+	tests := []struct {
+		at   time.Duration
+		want []int
+	}{
+		{0, []int{1}},
+		{Decay, []int{1, 2}},
+		// A tenfold of points is worth one Decay of age: a post half a
+		// Decay newer does not catch up, one and a half Decays newer does
+		{2 * Decay, []int{3, 1, 2}},
+		{10 * Decay, []int{3, 1, 2}}, // scores fall alike, the order stays
+	}
+	for _, tt := range tests {
+		now := start.Add(tt.at)
+		var posts []store.PostActivity
+		for _, a := range []store.PostActivity{early, soon, late} {
+			if !a.CreatedAt.After(now) {
+				posts = append(posts, a)
+			}
+		}
+		c := NewCache(&fakePosts{activity: posts}, func(a store.PostActivity, _ time.Time) float64 { return Hot(a, now) })
+		if err := c.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		if got, _, _ := c.Page("", 0); !equal(got, tt.want) {
+			t.Errorf("at %v: got %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestCacheTies(t *testing.T) {
+	posts := &fakePosts{activity: []store.PostActivity{
+		{PostID: 3}, {PostID: 7}, {PostID: 5}, {PostID: 1},
+	}}
+	c := NewCache(posts, func(store.PostActivity, time.Time) float64 { return 1 })
+	if err := c.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	// Equal scores rank the newer post, with the higher ID, first, and the
+	// cursor keeps paging through them
+	var got []int
+	after := ""
+	for {
+		page, next, err := c.Page(after, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, page...)
+		if next == "" {
+			break
+		}
+		after = next
+	}
+	if want := []int{7, 5, 3, 1}; !equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCacheRefresh(t *testing.T) {
+	now := time.Now()
+	posts := &fakePosts{activity: []store.PostActivity{
+		{PostID: 1, CreatedAt: now, Likes: 5},
+		{PostID: 2, CreatedAt: now, Likes: 1},
+	}}
+	c := NewCache(posts, Hot)
+	if got, _, _ := c.Page("", 10); len(got) != 0 {
+		t.Errorf("before the first refresh: got %v, want nothing", got)
+	}
+	if err := c.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	first, next, err := c.Page("", 1)
+	if err != nil || !equal(first, []int{1}) {
+		t.Fatalf("the first page: got %v, %v", first, err)
+	}
+
+	// Changes wait for the next refresh
+	posts.activity = []store.PostActivity{
+		{PostID: 2, CreatedAt: now, Likes: 50},
+		{PostID: 3, CreatedAt: now},
+	}
+	if got, _, _ := c.Page("", 10); !equal(got, []int{1, 2}) {
+		t.Errorf("before refreshing: got %v, want the old ranking", got)
+	}
+	if err := c.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := c.Page("", 10); !equal(got, []int{2, 3}) {
+		t.Errorf("after refreshing: got %v, want [2 3]", got)
+	}
+	// A cursor from before the refresh pages on from the score it was at,
+	// skipping the post that rose above it
+	if got, _, err := c.Page(next, 10); err != nil || !equal(got, []int{3}) {
+		t.Errorf("an old cursor: got %v, %v; want [3]", got, err)
+	}
+
+	// A failed refresh keeps the ranking it had
+	posts.err = errors.New("database down")
+	if err := c.Refresh(); err == nil {
+		t.Error("the refresh did not fail")
+	}
+	if got, _, _ := c.Page("", 10); !equal(got, []int{2, 3}) {
+		t.Errorf("after a failed refresh: got %v, want [2 3]", got)
+	}
+	if _, _, err := c.Page("not a cursor", 10); !errors.Is(err, store.ErrInvalidCursor) {
+		t.Errorf("a bad cursor: got %v, want ErrInvalidCursor", err)
+	}
+}
+
+// fakePosts serves a fixed activity to a Cache.
+type fakePosts struct {
+	store.PostStore
+	activity []store.PostActivity
+	err      error
+}
+
+func (f *fakePosts) GetPostActivity(since time.Time) ([]store.PostActivity, error) {
+	return f.activity, f.err
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"fmt"
+	"forum/auth"
+	"forum/events"
+	"forum/helpers"
+	"forum/ranking"
+	"forum/routes"
+	"forum/sessions"
+	"forum/store"
+	"net/http"
+)
+
+// apiInfo heads the document served at /openapi.json.
+var apiInfo = routes.Info{
+	Title:   "Forum",
+	Version: "1.0.0",
+	Description: "The forum's HTML pages and form posts, and its JSON API under " + helpers.APIPrefix + ". " +
+		"Form posts answer with a 303 redirect on success and with a short message on failure.",
+}
+
+var (
+	notLoggedIn  = routes.Error(http.StatusUnauthorized, "Not logged in")
+	forbidden    = routes.Error(http.StatusForbidden, "The user's role, or the API token's scopes, lack the permission")
+	badForm      = routes.Error(http.StatusBadRequest, "A field is missing or invalid")
+	notFound     = routes.Error(http.StatusNotFound, "There is no such page, or it is hidden")
+	wrongMethod  = routes.Error(http.StatusMethodNotAllowed, "Method not allowed")
+	postID       = routes.PathParam("id", "The post's ID").Int()
+	commentID    = routes.PathParam("id", "The comment's ID").Int()
+	categoryID   = routes.PathParam("id", "The category's ID").Int()
+	targetType   = routes.FormField("targetType", "What the reaction or report is about").Require().OneOf(store.TargetPost, store.TargetComment)
+	targetID     = routes.FormField("targetID", "The ID of the post or comment").Require().Int()
+	postCategory = routes.FormField("categories[]", "The name of a category to file the post under; at least one").Require().Repeated()
+	csrfToken    = routes.FormField(helpers.CSRFField, "The CSRF token in the forms of the pages; may be sent in the "+
+		helpers.CSRFHeader+" header instead. Requests without a valid one get a 403").Require()
+)
+
+// categoryFields are the fields of the category forms of /admin/categories.
+var categoryFields = []routes.Param{
+	routes.FormField("name", "The category's name").Require(),
+	routes.FormField("slug", "Used in filter links; made from the name when empty"),
+	routes.FormField("description", "Shown when hovering the category's filter button"),
+	routes.FormField("color", "A color like #256d5a, or empty for the default"),
+	routes.FormField("sortOrder", "Where the category is listed").Int(),
+}
+
+// registerRoutes registers every page, form and API endpoint of the forum
+// with its description. It fails when any of them is not described.
+func registerRoutes(reg *routes.Registry, st store.Store, hot *ranking.Cache, bus *events.Bus, sm *sessions.Manager, m *helpers.Mail, settings *helpers.Settings) error {
+	reg.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))), routes.Route{
+		Method:    http.MethodGet,
+		Path:      "/static/{file}",
+		Summary:   "Style sheets, scripts and images",
+		Params:    []routes.Param{routes.PathParam("file", "The file's path below ./static")},
+		Responses: []routes.Response{{Status: http.StatusOK, Description: "The file"}, notFound},
+	})
+	reg.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		helpers.IndexHandler(w, r, st, hot)
+	}, routes.Route{
+		Method:  http.MethodGet,
+		Path:    "/",
+		Summary: "The home page: a page of posts",
+		Description: fmt.Sprintf("Shows %d posts per page. The filters other than category need a login; "+
+			"the hot order ignores every filter.", helpers.PostsPerPage),
+		Params: []routes.Param{
+			routes.QueryParam("sort", "The order of the posts").OneOf(store.SortNewest, store.SortOldest,
+				store.SortMostLiked, store.SortMostCommented, store.SortActive, ranking.SortHot),
+			routes.QueryParam("after", "The cursor of the \"Next page\" link"),
+			routes.QueryParam("category", "A category's slug, or all"),
+			routes.QueryParam("filter", "The logged-in user's liked or created posts").OneOf("my-likes", "my-posts"),
+		},
+		Responses: []routes.Response{
+			routes.Page("The posts"),
+			routes.Error(http.StatusBadRequest, "An unknown sort, or a cursor made for another sort"),
+			notFound,
+		},
+	})
+
+	// Posts
+	reg.HandleFunc("/create-post", func(w http.ResponseWriter, r *http.Request) {
+		helpers.CreatePostPageHandler(w, r, st)
+	}, routes.Route{
+		Method:    http.MethodGet,
+		Path:      "/create-post",
+		Summary:   "The new post form, which posts to /add-post",
+		Responses: []routes.Response{routes.Page("The form")},
+	})
+	reg.HandleFunc("/add-post", helpers.RequireWithTokens(st, auth.CreatePost, func(w http.ResponseWriter, r *http.Request) {
+		helpers.AddPostHandler(w, r, st)
+	}), routes.Route{
+		Method:     http.MethodPost,
+		Path:       "/add-post",
+		Summary:    "Create a post",
+		Auth:       routes.SessionOrToken,
+		Permission: auth.CreatePost,
+		Params: []routes.Param{
+			routes.FormField("title", fmt.Sprintf("The post's title; at most %d characters", helpers.MaxTitleLength)).Require(),
+			routes.FormField("content", fmt.Sprintf("The post's text; at most %d characters", helpers.MaxPostLength)).Require(),
+			postCategory,
+			csrfToken,
+		},
+		Responses: []routes.Response{routes.Redirect("To the new post"), badForm, notLoggedIn, forbidden, wrongMethod},
+	})
+	reg.HandleFunc("/post/", helpers.AcceptTokens(func(w http.ResponseWriter, r *http.Request) {
+		helpers.PostHandler(w, r, st, bus)
+	}), routes.Route{
+		Method:  http.MethodGet,
+		Path:    "/post/{id}",
+		Summary: "A post with its comments",
+		Description: fmt.Sprintf("Shows %d levels of replies; thread shows the rest of a deeper thread. "+
+			"Hidden posts are only shown to moderators.", helpers.MaxCommentDepth),
+		Params: []routes.Param{
+			postID,
+			routes.QueryParam("thread", "The ID of a comment to show the thread below").Int(),
+		},
+		Responses: []routes.Response{
+			routes.Page("The post"), notFound,
+			routes.Error(http.StatusForbidden, "An API token without the read scope"),
+		},
+	}, routes.Route{
+		Method:      http.MethodGet,
+		Path:        "/post/{id}/edit",
+		Summary:     "The form to edit a post",
+		Description: "For the post's author, moderators and admins.",
+		Auth:        routes.Session,
+		Permission:  auth.EditOwnContent,
+		Params:      []routes.Param{postID},
+		Responses:   []routes.Response{routes.Page("The form"), routes.Redirect("Home, when not logged in"), forbidden, notFound},
+	}, routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/post/{id}/edit",
+		Summary:     "Edit a post",
+		Description: "Keeps the previous version as a revision.",
+		Auth:        routes.SessionOrToken,
+		Permission:  auth.EditOwnContent,
+		Params: []routes.Param{
+			postID,
+			routes.FormField("title", fmt.Sprintf("The new title; at most %d characters", helpers.MaxTitleLength)).Require(),
+			routes.FormField("content", fmt.Sprintf("The new text; at most %d characters", helpers.MaxPostLength)).Require(),
+			postCategory,
+			csrfToken,
+		},
+		Responses: []routes.Response{routes.Redirect("To the post"), badForm, forbidden, notFound},
+	}, routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/post/{id}/delete",
+		Summary:     "Delete a post",
+		Description: "Removes the post with its comments, reactions and revisions.",
+		Auth:        routes.SessionOrToken,
+		Permission:  auth.EditOwnContent,
+		Params:      []routes.Param{postID, csrfToken},
+		Responses:   []routes.Response{routes.Redirect("Home"), forbidden, notFound, wrongMethod},
+	}, routes.Route{
+		Method:    http.MethodGet,
+		Path:      "/post/{id}/revisions",
+		Summary:   "What each edit of a post changed",
+		Params:    []routes.Param{postID},
+		Responses: []routes.Response{routes.Page("The revisions"), notFound},
+	}, routes.Route{
+		Method:  http.MethodGet,
+		Path:    "/post/{id}/events",
+		Summary: "New comments and reaction counts of a post, as they happen",
+		Description: "A stream of server-sent events that stays open. A comment event carries the new comment's " +
+			"id, parent_id and html, rendered for the caller; a reactions event carries the target_type, target_id " +
+			"and counts of a post or comment whose reactions changed.",
+		Params:    []routes.Param{postID},
+		Responses: []routes.Response{{Status: http.StatusOK, Description: "The event stream", ContentType: "text/event-stream"}, notFound},
+	})
+
+	// Comments and reactions
+	reg.HandleFunc("/submit-comment", helpers.RequireWithTokens(st, auth.CreateComment, func(w http.ResponseWriter, r *http.Request) {
+		helpers.SubmitCommentHandler(w, r, st, bus)
+	}), routes.Route{
+		Method:     http.MethodPost,
+		Path:       "/submit-comment",
+		Summary:    "Comment on a post or reply to a comment",
+		Auth:       routes.SessionOrToken,
+		Permission: auth.CreateComment,
+		Params: []routes.Param{
+			routes.FormField("postID", "The post's ID").Require().Int(),
+			routes.FormField("comment", fmt.Sprintf("The comment's text; at most %d characters", helpers.MaxCommentLength)).Require(),
+			routes.FormField("parentID", "The comment replied to, on the same post; empty for a top-level comment").Int(),
+			csrfToken,
+		},
+		Responses: []routes.Response{
+			routes.Redirect("Back to the referring page"), badForm, notLoggedIn, forbidden,
+			routes.Error(http.StatusNotFound, "The post or the parent comment does not exist, is hidden or is deleted"),
+			wrongMethod,
+		},
+	})
+	reg.HandleFunc("/comment/", helpers.RequireWithTokens(st, auth.EditOwnContent, func(w http.ResponseWriter, r *http.Request) {
+		helpers.CommentHandler(w, r, st)
+	}), routes.Route{
+		Method:      http.MethodGet,
+		Path:        "/comment/{id}/edit",
+		Summary:     "The form to edit a comment",
+		Description: "For the comment's author, moderators and admins.",
+		Auth:        routes.Session,
+		Permission:  auth.EditOwnContent,
+		Params:      []routes.Param{commentID},
+		Responses:   []routes.Response{routes.Page("The form"), notLoggedIn, forbidden, notFound},
+	}, routes.Route{
+		Method:     http.MethodPost,
+		Path:       "/comment/{id}/edit",
+		Summary:    "Edit a comment",
+		Auth:       routes.SessionOrToken,
+		Permission: auth.EditOwnContent,
+		Params: []routes.Param{
+			commentID,
+			routes.FormField("comment", fmt.Sprintf("The new text; at most %d characters", helpers.MaxCommentLength)).Require(),
+			csrfToken,
+		},
+		Responses: []routes.Response{routes.Redirect("To the comment on its post"), badForm, notLoggedIn, forbidden, notFound},
+	}, routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/comment/{id}/delete",
+		Summary:     "Delete a comment",
+		Description: "Blanks the comment but keeps its place, replies and reactions.",
+		Auth:        routes.SessionOrToken,
+		Permission:  auth.EditOwnContent,
+		Params:      []routes.Param{commentID, csrfToken},
+		Responses:   []routes.Response{routes.Redirect("To the comment on its post"), notLoggedIn, forbidden, notFound, wrongMethod},
+	})
+	reg.HandleFunc("/update-reaction", helpers.RequireWithTokens(st, auth.React, func(w http.ResponseWriter, r *http.Request) {
+		helpers.UpdateReactionHandler(w, r, st, bus)
+	}), routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/update-reaction",
+		Summary:     "React to a post or comment",
+		Description: "Replaces the user's earlier reaction to the same target; the same reaction again takes it back.",
+		Auth:        routes.SessionOrToken,
+		Permission:  auth.React,
+		Params: []routes.Param{
+			targetType,
+			targetID,
+			routes.FormField("action", "The reaction type; 0 is like and 1 is dislike").Require().Int(),
+			csrfToken,
+		},
+		Responses: []routes.Response{
+			routes.Redirect("Back to the referring page"), badForm, notLoggedIn, forbidden,
+			routes.Error(http.StatusNotFound, "The reaction type is not enabled, or the target does not exist, is deleted or is hidden"),
+		},
+	})
+	reg.HandleFunc("/reactions/", func(w http.ResponseWriter, r *http.Request) {
+		helpers.ReactionsHandler(w, r, st)
+	}, routes.Route{
+		Method:  http.MethodGet,
+		Path:    "/reactions/{targetType}/{id}",
+		Summary: "Who reacted to a post or comment",
+		Params: []routes.Param{
+			routes.PathParam("targetType", "What the reactions are to").OneOf(store.TargetPost, store.TargetComment),
+			routes.PathParam("id", "The ID of the post or comment").Int(),
+		},
+		Responses: []routes.Response{routes.Page("The reactors grouped by reaction"), notFound},
+	})
+
+	reg.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		helpers.SearchHandler(w, r, st)
+	}, routes.Route{
+		Method:  http.MethodGet,
+		Path:    "/search",
+		Summary: "Search posts and comments",
+		Params: []routes.Param{
+			routes.QueryParam("q", "Words that must all match; the last one also matches longer words"),
+			routes.QueryParam("category", "Only posts filed under the category with this slug, and their comments"),
+			routes.QueryParam("author", "Only posts and comments by this username"),
+		},
+		Responses: []routes.Response{routes.Page("The best matches")},
+	})
+
+	// Accounts
+	reg.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+		helpers.RegisterHandler(w, r, st, sm, m)
+	}, routes.Route{
+		Method:  http.MethodPost,
+		Path:    "/register",
+		Summary: "Sign up and log in",
+		Description: "Emails the user a link to verify their email. Under the required verification policy, " +
+			"the user is not logged in until they have opened it.",
+		Params: []routes.Param{
+			routes.FormField("email", "The user's email").Require(),
+			routes.FormField("username", "The user's name").Require(),
+			routes.FormField("password", "The user's password").Require(),
+			csrfToken,
+		},
+		Responses: []routes.Response{
+			routes.Redirect("Home, with the session_token cookie set"),
+			routes.Page("Asks the user to verify their email, under the required policy"),
+			routes.Error(http.StatusBadRequest, "The email is not a valid address"),
+			routes.Error(http.StatusConflict, "The email or the username is taken"),
+			wrongMethod,
+		},
+	})
+	reg.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		helpers.LoginHandler(w, r, st, sm)
+	}, routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/login",
+		Summary:     "Log in",
+		Description: "Starts a session on the device; the user's sessions on other devices go on.",
+		Params: []routes.Param{
+			routes.FormField("username", "The user's name").Require(),
+			routes.FormField("password", "The user's password").Require(),
+			csrfToken,
+		},
+		Responses: []routes.Response{
+			routes.Redirect("Home, with the session_token cookie set"),
+			routes.Page("Asks for the code of users with two-factor authentication, or asks the user to verify their email, under the required policy"),
+			routes.Error(http.StatusUnauthorized, "Invalid credentials"),
+			wrongMethod,
+		},
+	})
+	reg.HandleFunc("/login/2fa", func(w http.ResponseWriter, r *http.Request) {
+		helpers.LoginTwoFactorHandler(w, r, st, sm)
+	}, routes.Route{
+		Method:  http.MethodPost,
+		Path:    "/login/2fa",
+		Summary: "Finish logging in with a code from the authenticator app",
+		Description: fmt.Sprintf("Takes the login_challenge cookie /login set, for %v. %d wrong codes end the login.",
+			helpers.LoginChallengeTTL, helpers.MaxLoginAttempts),
+		Params: []routes.Param{
+			routes.FormField("code", "The code the app shows, or a recovery code").Require(),
+			csrfToken,
+		},
+		Responses: []routes.Response{
+			routes.Redirect("Home, with the session_token cookie set"),
+			routes.Page("Why the code was refused"),
+			wrongMethod,
+		},
+	})
+	reg.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		helpers.LogoutHandler(w, r, sm)
+	}, routes.Route{
+		Method:    http.MethodPost,
+		Path:      "/logout",
+		Summary:   "Log out of the session of the request",
+		Auth:      routes.Session,
+		Params:    []routes.Param{csrfToken},
+		Responses: []routes.Response{routes.Redirect("Home, with the session ended"), wrongMethod},
+	})
+	reg.HandleFunc("/forgot-password", func(w http.ResponseWriter, r *http.Request) {
+		helpers.ForgotPasswordHandler(w, r, st, m)
+	}, routes.Route{
+		Method:    http.MethodGet,
+		Path:      "/forgot-password",
+		Summary:   "The form to ask for a password reset link",
+		Responses: []routes.Response{routes.Page("The form")},
+	}, routes.Route{
+		Method:  http.MethodPost,
+		Path:    "/forgot-password",
+		Summary: "Email a password reset link",
+		Description: fmt.Sprintf("Sends the user with the email a link to /reset-password that works once, for %v, "+
+			"unless they were sent one in the last %v. The email is looked up and sent after the answer, "+
+			"which is the same whether or not a user has the email.", helpers.PasswordResetTTL, helpers.PasswordResetInterval),
+		Params: []routes.Param{
+			routes.FormField("email", "The email of the account").Require(),
+			csrfToken,
+		},
+		Responses: []routes.Response{routes.Page("Says the link is on its way, if the email has an account")},
+	})
+	reg.HandleFunc("/reset-password", func(w http.ResponseWriter, r *http.Request) {
+		helpers.ResetPasswordHandler(w, r, st)
+	}, routes.Route{
+		Method:    http.MethodGet,
+		Path:      "/reset-password",
+		Summary:   "The form to choose a new password, opened from the emailed link",
+		Params:    []routes.Param{routes.QueryParam("token", "The token of the link").Require()},
+		Responses: []routes.Response{routes.Page("The form, or why the link no longer works")},
+	}, routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/reset-password",
+		Summary:     "Choose a new password",
+		Description: "Uses up the link and the user's other reset links, and logs the user out everywhere.",
+		Params: []routes.Param{
+			routes.FormField("token", "The token of the link").Require(),
+			routes.FormField("password", "The new password").Require(),
+			routes.FormField("confirm", "The new password again").Require(),
+			csrfToken,
+		},
+		Responses: []routes.Response{routes.Page("Says the password was changed, or why it was not")},
+	})
+	reg.HandleFunc("/verify-email", func(w http.ResponseWriter, r *http.Request) {
+		helpers.VerifyEmailHandler(w, r, st, m)
+	}, routes.Route{
+		Method:  http.MethodGet,
+		Path:    "/verify-email",
+		Summary: "Verify the user's email, opened from the emailed link",
+		Description: fmt.Sprintf("The link is signed for the user and their address, and works for %v.",
+			helpers.VerificationLinkTTL),
+		Params: []routes.Param{
+			routes.QueryParam("email", "The address the link was sent to").Require(),
+			routes.QueryParam("expires", "When the link stops working, in unix seconds").Int().Require(),
+			routes.QueryParam("sig", "The signature of the link").Require(),
+		},
+		Responses: []routes.Response{routes.Page("Says the email is verified, or why the link does not work")},
+	})
+	reg.HandleFunc("/verify-email/resend", func(w http.ResponseWriter, r *http.Request) {
+		helpers.ResendVerificationHandler(w, r, st, m)
+	}, routes.Route{
+		Method:  http.MethodPost,
+		Path:    "/verify-email/resend",
+		Summary: "Email another link to verify the user's email",
+		Description: fmt.Sprintf("Sends the logged-in user, or the user with the email, a new link, "+
+			"unless one was sent in the last %v. To visitors, the answer is the same whether or not a user has the email.",
+			helpers.VerificationResendInterval),
+		Params: []routes.Param{
+			routes.FormField("email", "The email of the account, when not logged in"),
+			csrfToken,
+		},
+		Responses: []routes.Response{
+			routes.Page("Says whether a link was sent"),
+			routes.Error(http.StatusInternalServerError, "The email to the logged-in user could not be sent"),
+			wrongMethod,
+		},
+	})
+	account := func(w http.ResponseWriter, r *http.Request) {
+		helpers.AccountHandler(w, r, st, sm)
+	}
+	reg.HandleFunc("/account", account, routes.Route{
+		Method:    http.MethodGet,
+		Path:      "/account",
+		Summary:   "The user's API tokens",
+		Auth:      routes.Session,
+		Responses: []routes.Response{routes.Page("The tokens"), routes.Redirect("Home, when not logged in")},
+	})
+	reg.HandleFunc("/account/", account, routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/account/tokens",
+		Summary:     "Create an API token",
+		Description: "The answer is the account page showing the token, the only time it is shown.",
+		Auth:        routes.Session,
+		Params: []routes.Param{
+			routes.FormField("name", "What the token is for").Require(),
+			routes.FormField("scopes", "What the token may do; at least one").Require().Repeated().
+				OneOf(string(auth.ScopeRead), string(auth.ScopeWrite), string(auth.ScopeModerate)),
+			csrfToken,
+		},
+		Responses: []routes.Response{routes.Page("The account page with the new token"), badForm, routes.Redirect("Home, when not logged in")},
+	}, routes.Route{
+		Method:    http.MethodPost,
+		Path:      "/account/tokens/{id}/revoke",
+		Summary:   "Revoke an API token",
+		Auth:      routes.Session,
+		Params:    []routes.Param{routes.PathParam("id", "The token's ID").Int(), csrfToken},
+		Responses: []routes.Response{routes.Redirect("To the account page"), notFound},
+	}, routes.Route{
+		Method:      http.MethodGet,
+		Path:        "/account/sessions",
+		Summary:     "Where the user is logged in",
+		Description: "Lists the user's sessions with the browser, address and times of each.",
+		Auth:        routes.Session,
+		Responses:   []routes.Response{routes.Page("The sessions"), routes.Redirect("Home, when not logged in")},
+	}, routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/account/sessions/{id}/revoke",
+		Summary:     "Log out one of the user's sessions",
+		Description: "Revoking the session of the request logs out and redirects home.",
+		Auth:        routes.Session,
+		Params:      []routes.Param{routes.PathParam("id", "The session's ID").Int(), csrfToken},
+		Responses:   []routes.Response{routes.Redirect("To the sessions page"), notFound, wrongMethod},
+	}, routes.Route{
+		Method:    http.MethodGet,
+		Path:      "/account/2fa",
+		Summary:   "Whether two-factor authentication is on, with the forms to change it",
+		Auth:      routes.Session,
+		Responses: []routes.Response{routes.Page("The two-factor page"), routes.Redirect("Home, when not logged in")},
+	}, routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/account/2fa/setup",
+		Summary:     "Start setting up an authenticator app",
+		Description: "Shows a new secret and its otpauth:// URI. Two-factor authentication stays off until the app is confirmed.",
+		Auth:        routes.Session,
+		Params:      []routes.Param{csrfToken},
+		Responses:   []routes.Response{routes.Page("The secret to add to the app")},
+	}, routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/account/2fa/enable",
+		Summary:     "Confirm the authenticator app and turn two-factor authentication on",
+		Description: fmt.Sprintf("The answer shows %d recovery codes, the only time they are shown.", helpers.RecoveryCodeCount),
+		Auth:        routes.Session,
+		Params:      []routes.Param{routes.FormField("code", "The code the app shows").Require(), csrfToken},
+		Responses:   []routes.Response{routes.Page("The recovery codes, or why the code was refused")},
+	}, routes.Route{
+		Method:    http.MethodPost,
+		Path:      "/account/2fa/recovery-codes",
+		Summary:   "Replace the recovery codes",
+		Auth:      routes.Session,
+		Params:    []routes.Param{routes.FormField("code", "A code from the app, or a recovery code").Require(), csrfToken},
+		Responses: []routes.Response{routes.Page("The new recovery codes, or why the code was refused")},
+	}, routes.Route{
+		Method:    http.MethodPost,
+		Path:      "/account/2fa/disable",
+		Summary:   "Turn two-factor authentication off",
+		Auth:      routes.Session,
+		Params:    []routes.Param{routes.FormField("code", "A code from the app, or a recovery code").Require(), csrfToken},
+		Responses: []routes.Response{routes.Redirect("To the two-factor page"), routes.Page("Why the code was refused")},
+	})
+	reg.HandleFunc("/warnings", func(w http.ResponseWriter, r *http.Request) {
+		helpers.WarningsHandler(w, r, st)
+	}, routes.Route{
+		Method:    http.MethodGet,
+		Path:      "/warnings",
+		Summary:   "The warnings moderators gave the user",
+		Auth:      routes.Session,
+		Responses: []routes.Response{routes.Page("The warnings"), routes.Redirect("Home, when not logged in")},
+	})
+
+	// Moderation
+	reg.HandleFunc("/report", helpers.Require(st, auth.Report, func(w http.ResponseWriter, r *http.Request) {
+		helpers.ReportHandler(w, r, st)
+	}), routes.Route{
+		Method:     http.MethodPost,
+		Path:       "/report",
+		Summary:    "Report a post or comment to the moderators",
+		Auth:       routes.Session,
+		Permission: auth.Report,
+		Params: []routes.Param{
+			targetType,
+			targetID,
+			routes.FormField("reason", fmt.Sprintf("Why; at most %d characters", helpers.MaxReportReason)).Require(),
+			csrfToken,
+		},
+		Responses: []routes.Response{routes.Redirect("Back to the post"), badForm, notLoggedIn, forbidden, wrongMethod},
+	})
+	reg.HandleFunc("/moderation", helpers.RequireWithTokens(st, auth.ModerateContent, func(w http.ResponseWriter, r *http.Request) {
+		helpers.ModerationHandler(w, r, st)
+	}), routes.Route{
+		Method:     http.MethodGet,
+		Path:       "/moderation",
+		Summary:    "The open reports and the latest decisions",
+		Auth:       routes.SessionOrToken,
+		Permission: auth.ModerateContent,
+		Responses:  []routes.Response{routes.Page("The queue"), notLoggedIn, forbidden},
+	})
+	reg.HandleFunc("/moderation/resolve", helpers.RequireWithTokens(st, auth.ModerateContent, func(w http.ResponseWriter, r *http.Request) {
+		helpers.ResolveReportHandler(w, r, st)
+	}), routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/moderation/resolve",
+		Summary:     "Decide on a report",
+		Description: "The decision resolves every open report about the same post or comment.",
+		Auth:        routes.SessionOrToken,
+		Permission:  auth.ModerateContent,
+		Params: []routes.Param{
+			routes.FormField("reportID", "The report's ID").Require().Int(),
+			routes.FormField("decision", "Hide the target, warn its author, or do nothing").Require().
+				OneOf(store.DecisionHide, store.DecisionWarn, store.DecisionDismiss),
+			routes.FormField("note", "The moderator's note for the log and the warning"),
+			csrfToken,
+		},
+		Responses: []routes.Response{
+			routes.Redirect("Back to the queue"), badForm, notLoggedIn, forbidden,
+			routes.Error(http.StatusNotFound, "The report has already been resolved"), wrongMethod,
+		},
+	})
+	adminCategories := helpers.Require(st, auth.ManageCategories, func(w http.ResponseWriter, r *http.Request) {
+		helpers.AdminCategoriesHandler(w, r, st)
+	})
+	categoryRoute := func(path, summary string, params ...routes.Param) routes.Route {
+		return routes.Route{
+			Method:     http.MethodPost,
+			Path:       path,
+			Summary:    summary,
+			Auth:       routes.Session,
+			Permission: auth.ManageCategories,
+			Params:     append(append([]routes.Param{}, params...), csrfToken),
+			Responses: []routes.Response{
+				routes.Redirect("Back to /admin/categories"), badForm, notLoggedIn, forbidden,
+				routes.Error(http.StatusConflict, "The name or slug is taken"),
+			},
+		}
+	}
+	reg.HandleFunc("/admin/categories", adminCategories, routes.Route{
+		Method:     http.MethodGet,
+		Path:       "/admin/categories",
+		Summary:    "Every category, with the forms to change them",
+		Auth:       routes.Session,
+		Permission: auth.ManageCategories,
+		Responses:  []routes.Response{routes.Page("The categories"), notLoggedIn, forbidden},
+	}, categoryRoute("/admin/categories", "Add a category", categoryFields...))
+	reg.HandleFunc("/admin/categories/", adminCategories,
+		categoryRoute("/admin/categories/{id}/edit", "Change a category", append([]routes.Param{categoryID}, categoryFields...)...),
+		categoryRoute("/admin/categories/{id}/retire", "Retire a category: its posts keep it but new ones cannot use it", categoryID),
+		categoryRoute("/admin/categories/{id}/restore", "Bring back a retired category", categoryID),
+		categoryRoute("/admin/categories/{id}/merge", "File a category's posts under another one and delete it",
+			categoryID, routes.FormField("into", "The ID of the category to merge into").Require().Int()),
+	)
+
+	reg.HandleFunc("/admin/security", helpers.Require(st, auth.ManageUsers, func(w http.ResponseWriter, r *http.Request) {
+		helpers.AdminSecurityHandler(w, r, st, settings)
+	}), routes.Route{
+		Method:     http.MethodGet,
+		Path:       "/admin/security",
+		Summary:    "Whether moderators and admins need two-factor authentication",
+		Auth:       routes.Session,
+		Permission: auth.ManageUsers,
+		Responses:  []routes.Response{routes.Page("The setting"), notLoggedIn, forbidden},
+	}, routes.Route{
+		Method:      http.MethodPost,
+		Path:        "/admin/security",
+		Summary:     "Require two-factor authentication of moderators and admins, or stop",
+		Description: "While it is required, moderators and admins without it can only do what members can.",
+		Auth:        routes.Session,
+		Permission:  auth.ManageUsers,
+		Params: []routes.Param{
+			routes.FormField("require_2fa", "on to require it").OneOf("on"),
+			csrfToken,
+		},
+		Responses: []routes.Response{
+			routes.Redirect("Back to /admin/security"),
+			routes.Page("Why the setting was not saved: the admin has no two-factor authentication"),
+			notLoggedIn, forbidden,
+		},
+	})
+
+	// The JSON API and its description
+	reg.HandleFunc(helpers.APIPrefix, func(w http.ResponseWriter, r *http.Request) {
+		helpers.APIHandler(w, r, st, hot, bus)
+	}, helpers.APIRoutes...)
+	reg.HandleFunc("/openapi.json", reg.OpenAPIHandler(apiInfo), routes.Route{
+		Method:    http.MethodGet,
+		Path:      "/openapi.json",
+		Summary:   "This document",
+		Responses: []routes.Response{{Status: http.StatusOK, Description: "The OpenAPI document", ContentType: "application/json"}},
+	})
+	return reg.Err()
+}
@@ -0,0 +1,280 @@
+package routes
+
+import (
+	"encoding/json"
+	"forum/sessions"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Document is an OpenAPI 3 document.
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"` // path, then lower-case method
+	Components Components                      `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Reply      `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Permission  string                `json:"x-permission,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Reply is an OpenAPI response object.
+type Reply struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// Schema is the subset of JSON Schema the forum's types need.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// The names of the security schemes in Components.
+const (
+	CookieAuth = "cookieAuth"
+	BearerAuth = "bearerAuth"
+)
+
+// OpenAPI builds the document describing every registered route.
+func (reg *Registry) OpenAPI(info Info) Document {
+	doc := Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   map[string]map[string]Operation{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{
+				CookieAuth: {Type: "apiKey", In: "cookie", Name: sessions.CookieName},
+				BearerAuth: {Type: "http", Scheme: "bearer"},
+			},
+		},
+	}
+	for _, route := range reg.routes {
+		if doc.Paths[route.Path] == nil {
+			doc.Paths[route.Path] = map[string]Operation{}
+		}
+		doc.Paths[route.Path][strings.ToLower(route.Method)] = operation(route, doc.Components.Schemas)
+	}
+	return doc
+}
+
+// OpenAPIHandler serves the document as JSON.
+func (reg *Registry) OpenAPIHandler(info Info) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(reg.OpenAPI(info)); err != nil {
+			log.Println("Error writing the OpenAPI document:", err)
+		}
+	}
+}
+
+func operation(route Route, schemas map[string]*Schema) Operation {
+	op := Operation{
+		Summary:     route.Summary,
+		Description: route.Description,
+		Responses:   map[string]Reply{},
+		Permission:  string(route.Permission),
+	}
+	switch route.Auth {
+	case Session:
+		op.Security = []map[string][]string{{CookieAuth: {}}}
+	case SessionOrToken:
+		op.Security = []map[string][]string{{CookieAuth: {}}, {BearerAuth: {}}}
+	}
+
+	form := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, param := range route.Params {
+		schema := &Schema{Type: param.Type, Enum: param.Enum}
+		if param.List {
+			schema = &Schema{Type: "array", Items: schema}
+		}
+		if param.In != InForm {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:        param.Name,
+				In:          param.In,
+				Description: param.Description,
+				Required:    param.Required,
+				Schema:      schema,
+			})
+			continue
+		}
+		schema.Description = param.Description
+		form.Properties[param.Name] = schema
+		if param.Required {
+			form.Required = append(form.Required, param.Name)
+		}
+	}
+	if len(form.Properties) > 0 {
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"application/x-www-form-urlencoded": {Schema: form},
+		}}
+	} else if route.JSONBody != nil {
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"application/json": {Schema: schemaOf(reflect.TypeOf(route.JSONBody), schemas)},
+		}}
+	}
+
+	for _, response := range route.Responses {
+		reply := Reply{Description: response.Description}
+		if response.ContentType != "" {
+			media := MediaType{}
+			if response.Body != nil {
+				media.Schema = schemaOf(reflect.TypeOf(response.Body), schemas)
+			}
+			reply.Content = map[string]MediaType{response.ContentType: media}
+		}
+		op.Responses[strconv.Itoa(response.Status)] = reply
+	}
+	return op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf describes a Go type the way encoding/json encodes it. Named
+// structs go into schemas and are referred to, which also lets them refer
+// to themselves.
+func schemaOf(t reflect.Type, schemas map[string]*Schema) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := schemaOf(t.Elem(), schemas)
+		if schema.Ref != "" {
+			// $ref takes no siblings in OpenAPI 3.0
+			return schema
+		}
+		schema.Nullable = true
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		name := schemaName(t)
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = &Schema{} // taken before recursing
+			*schemas[name] = *structSchema(t, schemas)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]*Schema) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	addFields(schema, t, schemas)
+	sort.Strings(schema.Required)
+	return schema
+}
+
+func addFields(schema *Schema, t reflect.Type, schemas map[string]*Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			// Embedded structs are flattened like encoding/json does
+			addFields(schema, field.Type, schemas)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = schemaOf(field.Type, schemas)
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// schemaName names the schema of a struct after its type, without the
+// "api" prefix the JSON types carry.
+func schemaName(t reflect.Type) string {
+	name := strings.TrimPrefix(t.Name(), "api")
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
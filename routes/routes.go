@@ -0,0 +1,233 @@
+// Package routes keeps the description of every route the server serves
+// next to its handler, and turns the descriptions into an OpenAPI document.
+package routes
+
+import (
+	"fmt"
+	"forum/auth"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Auth says how a route expects its caller to be logged in.
+type Auth int
+
+const (
+	// Public routes serve everybody; some show more to logged-in users.
+	Public Auth = iota
+	// Session routes need the session_token cookie set by /login.
+	Session
+	// SessionOrToken routes also accept an API token in an
+	// "Authorization: Bearer" header.
+	SessionOrToken
+)
+
+// Route describes one method of one path.
+type Route struct {
+	Method      string
+	Path        string // with {name} for path parameters, e.g. /post/{id}
+	Summary     string
+	Description string
+	Auth        Auth
+	Permission  auth.Permission // the permission the caller's role needs, if any
+	Params      []Param
+	JSONBody    interface{} // a value of the type of a JSON request body
+	Responses   []Response
+}
+
+// Where a Param is read from.
+const (
+	InPath  = "path"
+	InQuery = "query"
+	InForm  = "form" // a field of an application/x-www-form-urlencoded body
+)
+
+// Param is a path or query parameter or a form field.
+type Param struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Type        string   // "string" or "integer"
+	List        bool     // repeated, e.g. categories[]
+	Enum        []string // the values accepted, if they are fixed
+}
+
+// PathParam describes a {name} of the path. Path parameters are always
+// required.
+func PathParam(name, description string) Param {
+	return Param{Name: name, In: InPath, Description: description, Required: true, Type: "string"}
+}
+
+// QueryParam describes an optional query parameter.
+func QueryParam(name, description string) Param {
+	return Param{Name: name, In: InQuery, Description: description, Type: "string"}
+}
+
+// FormField describes an optional field of a form body.
+func FormField(name, description string) Param {
+	return Param{Name: name, In: InForm, Description: description, Type: "string"}
+}
+
+// Require marks the parameter as required.
+func (p Param) Require() Param {
+	p.Required = true
+	return p
+}
+
+// Int makes the parameter an integer.
+func (p Param) Int() Param {
+	p.Type = "integer"
+	return p
+}
+
+// Repeated makes the parameter a list, given once per value.
+func (p Param) Repeated() Param {
+	p.List = true
+	return p
+}
+
+// OneOf lists the values the parameter accepts.
+func (p Param) OneOf(values ...string) Param {
+	p.Enum = values
+	return p
+}
+
+// Response describes one status a route answers with.
+type Response struct {
+	Status      int
+	Description string
+	ContentType string      // empty when there is no body worth describing
+	Body        interface{} // a value of the type of a JSON body
+}
+
+// Page is a 200 answered with an HTML page.
+func Page(description string) Response {
+	return Response{Status: http.StatusOK, Description: description, ContentType: "text/html"}
+}
+
+// Redirect is a 303 to the page named in the description.
+func Redirect(description string) Response {
+	return Response{Status: http.StatusSeeOther, Description: description}
+}
+
+// Error is an error status answered with a short message.
+func Error(status int, description string) Response {
+	return Response{Status: status, Description: description}
+}
+
+// JSON is a status answered with a JSON body of the type of body.
+func JSON(status int, description string, body interface{}) Response {
+	return Response{Status: status, Description: description, ContentType: "application/json", Body: body}
+}
+
+// Registry is an http.Handler that serves handlers registered together
+// with descriptions of the routes they serve, so that no route goes
+// undescribed.
+type Registry struct {
+	mux    *http.ServeMux
+	routes []Route
+	errs   []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{mux: http.NewServeMux()}
+}
+
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mux.ServeHTTP(w, r)
+}
+
+// Handle registers a handler for a ServeMux pattern together with the
+// routes it serves. When the routes are missing or incomplete, or do not
+// fall under the pattern, the handler is not registered and Err says why,
+// so a server whose routes are not all described does not start.
+func (reg *Registry) Handle(pattern string, handler http.Handler, routes ...Route) {
+	if len(routes) == 0 {
+		reg.errs = append(reg.errs, fmt.Sprintf("%s is registered without a description", pattern))
+		return
+	}
+	failed := false
+	for _, route := range routes {
+		if err := check(pattern, route); err != nil {
+			reg.errs = append(reg.errs, fmt.Sprintf("%s %s: %v", route.Method, route.Path, err))
+			failed = true
+		}
+	}
+	if failed {
+		return
+	}
+	reg.mux.Handle(pattern, handler)
+	reg.routes = append(reg.routes, routes...)
+}
+
+// HandleFunc is Handle for a handler function.
+func (reg *Registry) HandleFunc(pattern string, handler http.HandlerFunc, routes ...Route) {
+	reg.Handle(pattern, handler, routes...)
+}
+
+// Err returns why the handlers that were not registered were refused, or
+// nil when every one was.
+func (reg *Registry) Err() error {
+	if len(reg.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("routes: %s", strings.Join(reg.errs, "; "))
+}
+
+// Routes returns the routes registered so far, in the order they were.
+func (reg *Registry) Routes() []Route {
+	return append([]Route(nil), reg.routes...)
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+func check(pattern string, route Route) error {
+	switch {
+	case route.Method == "":
+		return fmt.Errorf("no method")
+	case route.Summary == "":
+		return fmt.Errorf("no summary")
+	case len(route.Responses) == 0:
+		return fmt.Errorf("no responses")
+	}
+	// A pattern ending in a slash serves the paths below it
+	if strings.HasSuffix(pattern, "/") && pattern != "/" {
+		if !strings.HasPrefix(route.Path, pattern) {
+			return fmt.Errorf("not served by %s", pattern)
+		}
+	} else if route.Path != pattern {
+		return fmt.Errorf("not served by %s", pattern)
+	}
+
+	inPath := map[string]bool{}
+	for _, match := range pathParam.FindAllStringSubmatch(route.Path, -1) {
+		inPath[match[1]] = true
+	}
+	for _, param := range route.Params {
+		if param.In != InPath {
+			continue
+		}
+		if !inPath[param.Name] {
+			return fmt.Errorf("path parameter %s is not in the path", param.Name)
+		}
+		delete(inPath, param.Name)
+	}
+	for name := range inPath {
+		return fmt.Errorf("path parameter %s is not described", name)
+	}
+	if route.JSONBody != nil && hasForm(route) {
+		return fmt.Errorf("both a JSON and a form body")
+	}
+	return nil
+}
+
+func hasForm(route Route) bool {
+	for _, param := range route.Params {
+		if param.In == InForm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleRefusesUndescribedRoutes(t *testing.T) {
+	ok := []Response{Page("The page")}
+	tests := []struct {
+		name    string
+		pattern string
+		routes  []Route
+		err     string
+	}{
+		{"described", "/posts", []Route{{Method: http.MethodGet, Path: "/posts", Summary: "Posts", Responses: ok}}, ""},
+		{"no description", "/posts", nil, "/posts is registered without a description"},
+		{"no summary", "/posts", []Route{{Method: http.MethodGet, Path: "/posts", Responses: ok}}, "no summary"},
+		{"no responses", "/posts", []Route{{Method: http.MethodGet, Path: "/posts", Summary: "Posts"}}, "no responses"},
+		{"outside the pattern", "/posts", []Route{{Method: http.MethodGet, Path: "/post", Summary: "Posts", Responses: ok}}, "not served by /posts"},
+		{"undescribed path parameter", "/post/", []Route{{Method: http.MethodGet, Path: "/post/{id}", Summary: "A post", Responses: ok}}, "path parameter id is not described"},
+		{"one bad route of two", "/posts", []Route{
+			{Method: http.MethodGet, Path: "/posts", Summary: "Posts", Responses: ok},
+			{Method: http.MethodPost, Path: "/posts", Responses: ok},
+		}, "POST /posts: no summary"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := NewRegistry()
+			reg.HandleFunc(tc.pattern, func(w http.ResponseWriter, r *http.Request) {}, tc.routes...)
+
+			err := reg.Err()
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("got error %v, want one saying %q", err, tc.err)
+			}
+
+			// A refused handler is not served and not described.
+			w := httptest.NewRecorder()
+			reg.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.pattern, nil))
+			if registered := w.Code != http.StatusNotFound; registered != (tc.err == "") {
+				t.Errorf("%s answered %d", tc.pattern, w.Code)
+			}
+			if n := len(reg.Routes()); tc.err != "" && n != 0 {
+				t.Errorf("%d routes are described", n)
+			}
+		})
+	}
+}
+
+func TestErrListsEveryRefusal(t *testing.T) {
+	reg := NewRegistry()
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	reg.HandleFunc("/a", handler)
+	reg.HandleFunc("/b", handler)
+	err := reg.Err()
+	if err == nil || !strings.Contains(err.Error(), "/a is") || !strings.Contains(err.Error(), "/b is") {
+		t.Errorf("got %v, want both routes named", err)
+	}
+}
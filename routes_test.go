@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestRoutesAreDescribed walks every route the forum registers and checks
+// that it is described completely, once, and in the OpenAPI document.
+func TestRoutesAreDescribed(t *testing.T) {
+	f := newTestForum(t)
+	doc := f.reg.OpenAPI(apiInfo)
+	seen := map[string]bool{}
+	for _, route := range f.reg.Routes() {
+		name := route.Method + " " + route.Path
+		if seen[name] {
+			t.Errorf("%s is described twice", name)
+		}
+		seen[name] = true
+
+		if route.Summary == "" || len(route.Responses) == 0 {
+			t.Errorf("%s has no summary or no responses", name)
+		}
+		for _, param := range route.Params {
+			if param.Description == "" {
+				t.Errorf("%s: %s parameter %s is not described", name, param.In, param.Name)
+			}
+		}
+		for _, response := range route.Responses {
+			if response.Description == "" {
+				t.Errorf("%s: the %d response is not described", name, response.Status)
+			}
+		}
+		if _, ok := doc.Paths[route.Path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("%s is not in the OpenAPI document", name)
+		}
+	}
+
+	// The pages every visitor starts from are among them.
+	for _, name := range []string{"GET /", "GET /post/{id}", "POST /login", "GET /openapi.json"} {
+		if !seen[name] {
+			t.Errorf("%s is not described", name)
+		}
+	}
+	if resp, _ := f.client(t).get("/openapi.json"); resp.StatusCode != http.StatusOK {
+		t.Errorf("/openapi.json answered %d", resp.StatusCode)
+	}
+}
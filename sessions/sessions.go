@@ -0,0 +1,210 @@
+// Package sessions logs users in with a cookie holding a random token, of
+// which the store only keeps a hash. A user may be logged in on several
+// devices at once, and each session stays alive for as long as it is used.
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"forum/store"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// CookieName is the name of the session cookie.
+const CookieName = "session_token"
+
+// Defaults of a Manager.
+const (
+	// DefaultIdleTimeout is how long a session lasts when it is not used.
+	DefaultIdleTimeout = 90 * time.Minute
+	// DefaultMaxAge is how long a session lasts at most, however much it is
+	// used.
+	DefaultMaxAge = 30 * 24 * time.Hour
+)
+
+// touchInterval is how often the use of a session is recorded, so that
+// not every request writes to the store.
+const touchInterval = time.Minute
+
+// maxUserAgentLength is how much of the User-Agent header is kept.
+const maxUserAgentLength = 255
+
+// ErrNoSession is returned when a request has no valid session.
+var ErrNoSession = errors.New("sessions: not logged in")
+
+// Manager starts, ends and looks up sessions.
+type Manager struct {
+	store       store.SessionStore
+	IdleTimeout time.Duration
+	MaxAge      time.Duration
+	// InsecureCookies leaves Secure off the cookie for requests that arrive
+	// over plain HTTP, for running the forum locally without TLS. Without
+	// it the cookie is always Secure, including behind a proxy that
+	// terminates TLS without setting X-Forwarded-Proto.
+	InsecureCookies bool
+}
+
+func NewManager(st store.SessionStore) *Manager {
+	return &Manager{store: st, IdleTimeout: DefaultIdleTimeout, MaxAge: DefaultMaxAge}
+}
+
+// HashToken is what the store keeps of a session token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Start logs the user in on the device the request came from, next to any
+// sessions they have elsewhere, and sets the session cookie.
+func (m *Manager) Start(w http.ResponseWriter, r *http.Request, userID int) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	session := store.Session{
+		UserID:     userID,
+		UserAgent:  userAgent(r),
+		IP:         clientIP(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  m.expiry(now, now),
+	}
+	if _, err := m.store.CreateSession(HashToken(token), session); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  now.Add(m.MaxAge),
+		HttpOnly: true,
+		Secure:   m.SecureCookie(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// End logs out the session of the request, if it has one, and clears the
+// cookie.
+func (m *Manager) End(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   m.SecureCookie(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return nil
+	}
+	return m.store.DeleteSession(HashToken(cookie.Value))
+}
+
+// Revoke ends one of the user's sessions, on whichever device it is.
+func (m *Manager) Revoke(userID, sessionID int) error {
+	return m.store.RevokeSession(userID, sessionID)
+}
+
+type sessionKey struct{}
+
+// Handler looks up the session of each request before passing it on, so
+// handlers find it with Current, and keeps sessions in use from expiring.
+func (m *Manager) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := m.load(r)
+		if err == nil {
+			r = r.WithContext(context.WithValue(r.Context(), sessionKey{}, session))
+		} else if !errors.Is(err, ErrNoSession) {
+			log.Println("Database error:", err)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// load returns the session of the request, after moving its expiry when
+// it is due.
+func (m *Manager) load(r *http.Request) (store.Session, error) {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil || cookie.Value == "" {
+		return store.Session{}, ErrNoSession
+	}
+	session, err := m.store.GetSession(HashToken(cookie.Value))
+	if errors.Is(err, store.ErrNotFound) {
+		return store.Session{}, ErrNoSession
+	} else if err != nil {
+		return store.Session{}, err
+	}
+
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) >= touchInterval {
+		session.LastSeenAt = now
+		session.ExpiresAt = m.expiry(session.CreatedAt, now)
+		if err := m.store.TouchSession(session.SessionID, session.LastSeenAt, session.ExpiresAt); err != nil {
+			return store.Session{}, err
+		}
+	}
+	return session, nil
+}
+
+// Current returns the session Handler found for the request.
+func Current(r *http.Request) (store.Session, error) {
+	session, ok := r.Context().Value(sessionKey{}).(store.Session)
+	if !ok {
+		return store.Session{}, ErrNoSession
+	}
+	return session, nil
+}
+
+// expiry is when a session created and last used at the given times
+// expires: after IdleTimeout without use, and after MaxAge at the latest.
+func (m *Manager) expiry(createdAt, lastSeenAt time.Time) time.Time {
+	expiresAt := lastSeenAt.Add(m.IdleTimeout)
+	if limit := createdAt.Add(m.MaxAge); expiresAt.After(limit) {
+		return limit
+	}
+	return expiresAt
+}
+
+// SecureCookie reports whether the cookies set in answer to the request
+// are marked Secure: always, unless InsecureCookies is set and the request
+// came over plain HTTP.
+func (m *Manager) SecureCookie(r *http.Request) bool {
+	return !m.InsecureCookies || r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func userAgent(r *http.Request) string {
+	agent := r.UserAgent()
+	if len(agent) > maxUserAgentLength {
+		agent = agent[:maxUserAgentLength]
+	}
+	return agent
+}
+
+// clientIP is the address the request came from. Behind a proxy, that is
+// the proxy's.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,63 @@
+package sessions_test
+
+import (
+	"crypto/tls"
+	"forum/sessions"
+	"forum/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCookiesAreSecureByDefault(t *testing.T) {
+	tests := []struct {
+		name     string
+		insecure bool
+		tls      bool
+		proto    string
+		want     bool
+	}{
+		{"plain HTTP", false, false, "", true},
+		{"TLS", false, true, "", true},
+		{"plain HTTP, opted out", true, false, "", false},
+		{"TLS, opted out", true, true, "", true},
+		{"a proxy over HTTPS, opted out", true, false, "https", true},
+		{"a proxy over HTTP, opted out", true, false, "http", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := store.NewMemory()
+			userID, err := st.AddUser("alice@example.com", "alice", []byte("hash"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sm := sessions.NewManager(st)
+			sm.InsecureCookies = tt.insecure
+
+			r := httptest.NewRequest(http.MethodPost, "/login", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if got := sm.SecureCookie(r); got != tt.want {
+				t.Errorf("SecureCookie = %v, want %v", got, tt.want)
+			}
+
+			for what, set := range map[string]func(w http.ResponseWriter) error{
+				"logging in":  func(w http.ResponseWriter) error { return sm.Start(w, r, userID) },
+				"logging out": func(w http.ResponseWriter) error { return sm.End(w, r) },
+			} {
+				w := httptest.NewRecorder()
+				if err := set(w); err != nil {
+					t.Fatal(err)
+				}
+				cookies := w.Result().Cookies()
+				if len(cookies) != 1 || cookies[0].Name != sessions.CookieName || cookies[0].Secure != tt.want {
+					t.Errorf("%s set %v, want the session cookie with Secure %v", what, cookies, tt.want)
+				}
+			}
+		})
+	}
+}
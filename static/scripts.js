@@ -34,3 +34,58 @@ function filterPosts(filterType, filterValue) {
   window.location.href = url;
 }
 
+
+// Post pages follow their post's events, so new comments and reaction
+// counts show up without a reload.
+const postComments = document.getElementById("post-comments");
+
+if (postComments && postComments.dataset.events && window.EventSource) {
+  const source = new EventSource(postComments.dataset.events);
+
+  source.addEventListener("comment", event => {
+    const comment = JSON.parse(event.data);
+    if (document.getElementById("comment-" + comment.id)) {
+      return;
+    }
+    const template = document.createElement("template");
+    template.innerHTML = comment.html.trim();
+    const element = template.content.firstElementChild;
+
+    if (!comment.parent_id) {
+      // A thread view only shows the replies below one comment
+      if (!("thread" in postComments.dataset)) {
+        postComments.appendChild(element);
+      }
+      return;
+    }
+    const parent = document.getElementById("comment-" + comment.parent_id);
+    if (!parent || parent.querySelector(":scope > .continue-thread")) {
+      return;
+    }
+    let replies = parent.querySelector(":scope > details.replies");
+    if (!replies) {
+      replies = document.createElement("details");
+      replies.className = "replies";
+      replies.open = true;
+      replies.appendChild(document.createElement("summary"));
+      parent.appendChild(replies);
+    }
+    replies.appendChild(element);
+    const count = replies.querySelectorAll(":scope > .comment-thread").length;
+    replies.querySelector(":scope > summary").textContent = count + (count === 1 ? " reply" : " replies");
+  });
+
+  source.addEventListener("reactions", event => {
+    const reactions = JSON.parse(event.data);
+    const container = document.querySelector(`[data-target="${reactions.target_type}-${reactions.target_id}"]`);
+    if (!container) {
+      return;
+    }
+    reactions.counts.forEach(reaction => {
+      const count = container.querySelector(`button[value="${reaction.type}"] .reaction-count`);
+      if (count) {
+        count.textContent = reaction.count;
+      }
+    });
+  });
+}
@@ -0,0 +1,25 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Slugify turns a category name into the slug suggested for it: lower case
+// letters and digits with single dashes between words.
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
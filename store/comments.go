@@ -0,0 +1,31 @@
+package store
+
+// buildCommentTree nests comments under their parents. comments must be
+// ordered by ID, so that every parent comes before its replies; comments at
+// depth 0 become the roots.
+func buildCommentTree(comments []Comment) []Comment {
+	replies := map[int][]int{}
+	var roots []int
+	for i, comment := range comments {
+		if comment.Depth == 0 {
+			roots = append(roots, i)
+		} else {
+			replies[comment.ParentID] = append(replies[comment.ParentID], i)
+		}
+	}
+
+	var build func(i int) Comment
+	build = func(i int) Comment {
+		comment := comments[i]
+		for _, j := range replies[comment.CommentID] {
+			comment.Replies = append(comment.Replies, build(j))
+		}
+		return comment
+	}
+
+	tree := make([]Comment, 0, len(roots))
+	for _, i := range roots {
+		tree = append(tree, build(i))
+	}
+	return tree
+}
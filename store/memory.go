@@ -0,0 +1,1980 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory implements Store in process memory. It keeps the same rows as
+// the SQL schema so handlers behave identically against either store.
+type Memory struct {
+	mu sync.Mutex
+
+	categories     []Category
+	users          []User
+	posts          []memoryPost
+	comments       []memoryComment
+	sessions       []memorySession
+	likes          []memoryLike
+	reactionTypes  []ReactionType
+	postCategories map[int][]int
+	revisions      []memoryRevision
+	reports        []memoryReport
+	actions        []memoryAction
+	warnings       []memoryWarning
+	apiTokens      []memoryAPIToken
+	passwordResets []memoryPasswordReset
+	// emailsSent holds when each user was last sent each kind of email
+	emailsSent      map[memoryEmail]time.Time
+	totp            map[int]memoryTOTP
+	recoveryCodes   []memoryRecoveryCode
+	loginChallenges []memoryLoginChallenge
+	secondFactor    map[int]memorySecondFactor
+	settings        map[string]string
+
+	// lastID holds the last ID handed out per table, like AUTOINCREMENT
+	lastID map[string]int
+}
+
+var _ Store = (*Memory)(nil)
+
+type memoryPost struct {
+	PostID    int
+	UserID    int
+	Title     string
+	Content   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	HiddenAt  time.Time
+}
+
+type memoryRevision struct {
+	RevisionID  int
+	PostID      int
+	EditorID    int
+	Title       string
+	Content     string
+	CategoryIDs []int
+	CreatedAt   time.Time
+}
+
+type memoryComment struct {
+	CommentID int
+	PostID    int
+	UserID    int
+	ParentID  int
+	Content   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt time.Time
+	HiddenAt  time.Time
+}
+
+type memorySession struct {
+	Session
+	TokenHash string
+}
+
+type memoryLike struct {
+	PostID    int
+	CommentID int
+	UserID    int
+	Type      int
+	CreatedAt time.Time
+}
+
+type memoryReport struct {
+	ReportID   int
+	ReporterID int
+	PostID     int
+	CommentID  int
+	Reason     string
+	Status     string
+	CreatedAt  time.Time
+	ResolvedAt time.Time
+}
+
+type memoryAction struct {
+	ActionID    int
+	ModeratorID int
+	AuthorID    int
+	TargetType  string
+	TargetID    int
+	PostID      int
+	Decision    string
+	Reason      string
+	Note        string
+	CreatedAt   time.Time
+}
+
+type memoryWarning struct {
+	WarningID   int
+	UserID      int
+	ModeratorID int
+	Reason      string
+	Note        string
+	CreatedAt   time.Time
+}
+
+// memoryEmail is a kind of email sent to a user.
+type memoryEmail struct {
+	UserID int
+	Kind   string
+}
+
+type memoryPasswordReset struct {
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    time.Time
+}
+
+type memoryTOTP struct {
+	Secret   string
+	LastStep int64
+}
+
+// memorySecondFactor counts a user's wrong codes.
+type memorySecondFactor struct {
+	Failures    int
+	LockedUntil time.Time
+}
+
+type memoryRecoveryCode struct {
+	UserID int
+	Hash   string
+	Used   bool
+}
+
+type memoryLoginChallenge struct {
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	Attempts  int
+}
+
+type memoryAPIToken struct {
+	TokenID    int
+	UserID     int
+	Name       string
+	Hash       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+}
+
+func (t memoryAPIToken) token() APIToken {
+	token := APIToken{
+		TokenID:   t.TokenID,
+		Name:      t.Name,
+		Scopes:    append([]string(nil), t.Scopes...),
+		CreatedAt: t.CreatedAt.Format(memoryTimeFormat),
+	}
+	if !t.LastUsedAt.IsZero() {
+		token.LastUsedAt = t.LastUsedAt.Format(memoryTimeFormat)
+	}
+	return token
+}
+
+// NewMemory returns an empty store holding the given categories.
+func NewMemory(categories ...string) *Memory {
+	m := &Memory{
+		postCategories: map[int][]int{},
+		emailsSent:     map[memoryEmail]time.Time{},
+		totp:           map[int]memoryTOTP{},
+		secondFactor:   map[int]memorySecondFactor{},
+		settings:       map[string]string{},
+		lastID:         map[string]int{},
+	}
+	for i, category := range categories {
+		m.categories = append(m.categories, Category{
+			CategoryID: i + 1,
+			Category:   category,
+			Slug:       Slugify(category),
+			SortOrder:  i + 1,
+		})
+	}
+	m.lastID["categories"] = len(categories)
+	m.reactionTypes = []ReactionType{
+		{Type: Like, Name: "like", Emoji: "👍", SortOrder: 0, Enabled: true},
+		{Type: Dislike, Name: "dislike", Emoji: "👎", SortOrder: 1, Enabled: true},
+		{Type: 2, Name: "love", Emoji: "❤️", SortOrder: 2},
+		{Type: 3, Name: "laugh", Emoji: "😂", SortOrder: 3},
+		{Type: 4, Name: "wow", Emoji: "😮", SortOrder: 4},
+		{Type: 5, Name: "sad", Emoji: "😢", SortOrder: 5},
+	}
+	return m
+}
+
+const memoryTimeFormat = "2006-01-02T15:04:05Z"
+
+func (m *Memory) nextID(table string) int {
+	m.lastID[table]++
+	return m.lastID[table]
+}
+
+// CATEGORIES
+func (m *Memory) GetCategories() ([]Category, error) {
+	var categories []Category
+	all, _ := m.GetAllCategories()
+	for _, category := range all {
+		if !category.Retired {
+			categories = append(categories, category)
+		}
+	}
+	return categories, nil
+}
+
+func (m *Memory) GetAllCategories() ([]Category, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	categories := append([]Category(nil), m.categories...)
+	sortCategories(categories)
+	return categories, nil
+}
+
+func sortCategories(categories []Category) {
+	sort.SliceStable(categories, func(i, j int) bool {
+		if categories[i].SortOrder != categories[j].SortOrder {
+			return categories[i].SortOrder < categories[j].SortOrder
+		}
+		return categories[i].CategoryID < categories[j].CategoryID
+	})
+}
+
+func (m *Memory) GetCategory(categoryID int) (Category, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if category, ok := m.categoryByID(categoryID); ok {
+		return category, nil
+	}
+	return Category{}, ErrNotFound
+}
+
+func (m *Memory) categoryTaken(categoryID int, name, slug string) bool {
+	for _, category := range m.categories {
+		if category.CategoryID != categoryID && (strings.EqualFold(category.Category, name) || category.Slug == slug) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) AddCategory(category Category) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.categoryTaken(0, category.Category, category.Slug) {
+		return 0, ErrDuplicate
+	}
+	category.CategoryID = m.nextID("categories")
+	category.Retired = false
+	m.categories = append(m.categories, category)
+	return category.CategoryID, nil
+}
+
+func (m *Memory) UpdateCategory(category Category) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.categoryTaken(category.CategoryID, category.Category, category.Slug) {
+		return ErrDuplicate
+	}
+	for i := range m.categories {
+		if m.categories[i].CategoryID == category.CategoryID {
+			category.Retired = m.categories[i].Retired
+			m.categories[i] = category
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) SetCategoryRetired(categoryID int, retired bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.categories {
+		if m.categories[i].CategoryID == categoryID {
+			m.categories[i].Retired = retired
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) MergeCategory(sourceID, targetID int) error {
+	if sourceID == targetID {
+		return errors.New("cannot merge a category into itself")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, sourceFound := m.categoryByID(sourceID)
+	_, targetFound := m.categoryByID(targetID)
+	if !sourceFound || !targetFound {
+		return ErrNotFound
+	}
+
+	for postID, categoryIDs := range m.postCategories {
+		m.postCategories[postID] = mergeCategoryIDs(categoryIDs, sourceID, targetID)
+	}
+	for i := range m.revisions {
+		m.revisions[i].CategoryIDs = mergeCategoryIDs(m.revisions[i].CategoryIDs, sourceID, targetID)
+	}
+
+	var categories []Category
+	for _, category := range m.categories {
+		if category.CategoryID != sourceID {
+			categories = append(categories, category)
+		}
+	}
+	m.categories = categories
+	return nil
+}
+
+// mergeCategoryIDs replaces sourceID with targetID, keeping targetID once.
+func mergeCategoryIDs(categoryIDs []int, sourceID, targetID int) []int {
+	var merged []int
+	hasTarget := false
+	for _, categoryID := range categoryIDs {
+		if categoryID == sourceID {
+			categoryID = targetID
+		}
+		if categoryID == targetID {
+			if hasTarget {
+				continue
+			}
+			hasTarget = true
+		}
+		merged = append(merged, categoryID)
+	}
+	return merged
+}
+
+func (m *Memory) categoryByName(name string) (Category, bool) {
+	for _, category := range m.categories {
+		if category.Category == name {
+			return category, true
+		}
+	}
+	return Category{}, false
+}
+
+func (m *Memory) categoryByID(categoryID int) (Category, bool) {
+	for _, category := range m.categories {
+		if category.CategoryID == categoryID {
+			return category, true
+		}
+	}
+	return Category{}, false
+}
+
+// POSTS
+func (m *Memory) GetPosts(opts ListOptions) (PostPage, error) {
+	return m.listPosts(opts, func(memoryPost) bool { return true })
+}
+
+func (m *Memory) GetPost(postID int) (Post, error) {
+	posts := m.filterPosts(func(p memoryPost) bool { return p.PostID == postID })
+	if len(posts) == 0 {
+		return Post{}, ErrNotFound
+	}
+	return posts[0], nil
+}
+
+func (m *Memory) GetPostsByCategory(slug string, opts ListOptions) (PostPage, error) {
+	if slug == "all" {
+		return m.GetPosts(opts)
+	}
+	return m.listPosts(opts, func(p memoryPost) bool {
+		for _, categoryID := range m.postCategories[p.PostID] {
+			if c, ok := m.categoryByID(categoryID); ok && c.Slug == slug {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (m *Memory) GetUserLikedPosts(username string, opts ListOptions) (PostPage, error) {
+	return m.listPosts(opts, func(p memoryPost) bool {
+		for _, like := range m.likes {
+			if like.PostID == p.PostID && m.usernameByID(like.UserID) == username {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (m *Memory) GetUserCreatedPosts(username string, opts ListOptions) (PostPage, error) {
+	return m.listPosts(opts, func(p memoryPost) bool {
+		return m.usernameByID(p.UserID) == username
+	})
+}
+
+func (m *Memory) GetPostsByID(postIDs []int) ([]Post, error) {
+	wanted := map[int]bool{}
+	for _, postID := range postIDs {
+		wanted[postID] = true
+	}
+	byID := map[int]Post{}
+	for _, post := range m.filterPosts(func(p memoryPost) bool { return p.HiddenAt.IsZero() && wanted[p.PostID] }) {
+		byID[post.PostID] = post
+	}
+	posts := make([]Post, 0, len(byID))
+	for _, postID := range postIDs {
+		if post, ok := byID[postID]; ok {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+func (m *Memory) GetPostActivity(since time.Time) ([]PostActivity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var activity []PostActivity
+	for _, p := range m.posts {
+		if !p.HiddenAt.IsZero() {
+			continue
+		}
+		a := PostActivity{PostID: p.PostID, CreatedAt: p.CreatedAt}
+		a.Likes, a.Dislikes = m.countLikes(func(l memoryLike) bool { return l.PostID == p.PostID })
+		for _, comment := range m.comments {
+			if comment.PostID != p.PostID || !comment.DeletedAt.IsZero() || !comment.HiddenAt.IsZero() {
+				continue
+			}
+			a.Comments++
+			if !comment.CreatedAt.Before(since) {
+				a.RecentComments++
+			}
+		}
+		activity = append(activity, a)
+	}
+	return activity, nil
+}
+
+// listPosts returns a page of the visible posts accepted by keep, which is
+// called with the lock held.
+func (m *Memory) listPosts(opts ListOptions, keep func(memoryPost) bool) (PostPage, error) {
+	opts, err := listOptions(opts)
+	if err != nil {
+		return PostPage{}, err
+	}
+	after, err := parseCursor(opts)
+	if err != nil {
+		return PostPage{}, err
+	}
+
+	posts := m.filterPosts(func(p memoryPost) bool { return p.HiddenAt.IsZero() && keep(p) })
+	keys := map[int]string{}
+	for _, post := range posts {
+		keys[post.PostID] = m.sortKey(opts.Sort, post)
+	}
+
+	// compare orders a before b when it is negative, as the sort order has it
+	compare := func(aKey string, aID int, bKey string, bID int) int {
+		c := compareKeys(opts.Sort, aKey, bKey)
+		if c == 0 {
+			c = aID - bID
+		}
+		if opts.Sort != SortOldest {
+			c = -c
+		}
+		return c
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return compare(keys[posts[i].PostID], posts[i].PostID, keys[posts[j].PostID], posts[j].PostID) < 0
+	})
+
+	var page PostPage
+	for _, post := range posts {
+		if opts.After != "" && compare(keys[post.PostID], post.PostID, after.Key, after.PostID) <= 0 {
+			continue
+		}
+		if opts.Limit > 0 && len(page.Posts) == opts.Limit {
+			last := page.Posts[len(page.Posts)-1]
+			page.NextCursor = cursor{Sort: opts.Sort, Key: keys[last.PostID], PostID: last.PostID}.String()
+			break
+		}
+		page.Posts = append(page.Posts, post)
+	}
+	return page, nil
+}
+
+// sortKey is the value a sort order sorts the post by.
+func (m *Memory) sortKey(sort string, post Post) string {
+	switch sort {
+	case SortMostLiked:
+		return strconv.Itoa(post.Likes)
+	case SortMostCommented:
+		return strconv.Itoa(post.CommentCount)
+	case SortActive:
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		latest := post.CreatedAt
+		if post.UpdatedAt > latest {
+			latest = post.UpdatedAt
+		}
+		for _, comment := range m.comments {
+			if created := comment.CreatedAt.Format(memoryTimeFormat); comment.PostID == post.PostID && created > latest {
+				latest = created
+			}
+		}
+		return latest
+	}
+	return post.CreatedAt
+}
+
+// filterPosts builds the Post of every row accepted by keep. keep is
+// called with the lock held.
+func (m *Memory) filterPosts(keep func(memoryPost) bool) []Post {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var posts []Post
+	for _, p := range m.posts {
+		if !keep(p) {
+			continue
+		}
+		post := Post{
+			PostID:    p.PostID,
+			Username:  m.usernameByID(p.UserID),
+			Title:     p.Title,
+			Content:   p.Content,
+			CreatedAt: p.CreatedAt.Format(memoryTimeFormat),
+			Hidden:    !p.HiddenAt.IsZero(),
+		}
+		if !p.UpdatedAt.IsZero() {
+			post.UpdatedAt = p.UpdatedAt.Format(memoryTimeFormat)
+		}
+		post.Likes, post.Dislikes = m.countLikes(func(l memoryLike) bool { return l.PostID == p.PostID })
+		post.Reactions = m.countReactions(func(l memoryLike) bool { return l.PostID == p.PostID })
+		for _, comment := range m.comments {
+			if comment.PostID == p.PostID {
+				post.CommentCount++
+			}
+		}
+		for _, categoryID := range m.postCategories[p.PostID] {
+			if category, ok := m.categoryByID(categoryID); ok {
+				post.Categories = append(post.Categories, category)
+			}
+		}
+		sortCategories(post.Categories)
+		post.PostCategory = joinCategories(post.Categories)
+		posts = append(posts, post)
+	}
+	return posts
+}
+
+func (m *Memory) countLikes(match func(memoryLike) bool) (likes, dislikes int) {
+	for _, like := range m.likes {
+		if !match(like) {
+			continue
+		}
+		if like.Type == Like {
+			likes++
+		} else if like.Type == Dislike {
+			dislikes++
+		}
+	}
+	return likes, dislikes
+}
+
+// countReactions counts the matching reactions of every enabled type.
+func (m *Memory) countReactions(match func(memoryLike) bool) []ReactionCount {
+	var reactions []ReactionCount
+	for _, reactionType := range m.sortedReactionTypes() {
+		if !reactionType.Enabled {
+			continue
+		}
+		reaction := ReactionCount{ReactionType: reactionType}
+		for _, like := range m.likes {
+			if like.Type == reactionType.Type && match(like) {
+				reaction.Count++
+			}
+		}
+		reactions = append(reactions, reaction)
+	}
+	return reactions
+}
+
+func (m *Memory) sortedReactionTypes() []ReactionType {
+	types := append([]ReactionType(nil), m.reactionTypes...)
+	sort.SliceStable(types, func(i, j int) bool {
+		if types[i].SortOrder != types[j].SortOrder {
+			return types[i].SortOrder < types[j].SortOrder
+		}
+		return types[i].Type < types[j].Type
+	})
+	return types
+}
+
+func (m *Memory) AddPost(userID int, title, content string, categories []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	categoryIDs, err := m.categoryIDs(categories)
+	if err != nil {
+		return 0, err
+	}
+
+	postID := m.nextID("posts")
+	m.posts = append(m.posts, memoryPost{
+		PostID:    postID,
+		UserID:    userID,
+		Title:     title,
+		Content:   content,
+		CreatedAt: time.Now().UTC(),
+	})
+	m.postCategories[postID] = categoryIDs
+	return postID, nil
+}
+
+func (m *Memory) categoryIDs(names []string) ([]int, error) {
+	var categoryIDs []int
+	for _, name := range names {
+		category, ok := m.categoryByName(name)
+		if !ok {
+			return nil, ErrNotFound
+		}
+		categoryIDs = append(categoryIDs, category.CategoryID)
+	}
+	return categoryIDs, nil
+}
+
+func (m *Memory) UpdatePost(postID, editorID int, title, content string, categories []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	categoryIDs, err := m.categoryIDs(categories)
+	if err != nil {
+		return err
+	}
+	for i, p := range m.posts {
+		if p.PostID != postID {
+			continue
+		}
+		m.revisions = append(m.revisions, memoryRevision{
+			RevisionID:  m.nextID("post_revisions"),
+			PostID:      postID,
+			EditorID:    editorID,
+			Title:       p.Title,
+			Content:     p.Content,
+			CategoryIDs: m.postCategories[postID],
+			CreatedAt:   time.Now().UTC(),
+		})
+		m.posts[i].Title = title
+		m.posts[i].Content = content
+		m.posts[i].UpdatedAt = time.Now().UTC()
+		m.postCategories[postID] = categoryIDs
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) DeletePost(postID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := -1
+	for i, p := range m.posts {
+		if p.PostID == postID {
+			index = i
+		}
+	}
+	if index < 0 {
+		return ErrNotFound
+	}
+	m.posts = append(m.posts[:index], m.posts[index+1:]...)
+
+	removedComments := map[int]bool{}
+	var comments []memoryComment
+	for _, comment := range m.comments {
+		if comment.PostID == postID {
+			removedComments[comment.CommentID] = true
+		} else {
+			comments = append(comments, comment)
+		}
+	}
+	m.comments = comments
+
+	var likes []memoryLike
+	for _, like := range m.likes {
+		if like.PostID != postID && !removedComments[like.CommentID] {
+			likes = append(likes, like)
+		}
+	}
+	m.likes = likes
+
+	var revisions []memoryRevision
+	for _, revision := range m.revisions {
+		if revision.PostID != postID {
+			revisions = append(revisions, revision)
+		}
+	}
+	m.revisions = revisions
+
+	var reports []memoryReport
+	for _, report := range m.reports {
+		if report.PostID != postID && !removedComments[report.CommentID] {
+			reports = append(reports, report)
+		}
+	}
+	m.reports = reports
+	delete(m.postCategories, postID)
+	return nil
+}
+
+func (m *Memory) GetPostRevisions(postID int) ([]PostRevision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var revisions []PostRevision
+	for _, r := range m.revisions {
+		if r.PostID != postID {
+			continue
+		}
+		revision := PostRevision{
+			RevisionID: r.RevisionID,
+			PostID:     r.PostID,
+			Editor:     m.usernameByID(r.EditorID),
+			Title:      r.Title,
+			Content:    r.Content,
+			EditedAt:   r.CreatedAt.Format(memoryTimeFormat),
+		}
+		for _, categoryID := range r.CategoryIDs {
+			if category, ok := m.categoryByID(categoryID); ok {
+				revision.Categories = append(revision.Categories, category)
+			}
+		}
+		revision.PostCategory = joinCategories(revision.Categories)
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// COMMENTS
+func (m *Memory) GetCommentsForPost(postID, rootID, maxDepth int) ([]Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	depth := map[int]int{}
+	var comments []Comment
+	for _, c := range m.comments {
+		if c.PostID != postID {
+			continue
+		}
+		// Comments are kept in ID order, so a parent's depth is known
+		// before its replies are reached
+		d, ok := 0, false
+		if rootID == 0 {
+			ok = c.ParentID == 0
+		} else {
+			ok = c.CommentID == rootID
+		}
+		if !ok {
+			parentDepth, found := depth[c.ParentID]
+			d, ok = parentDepth+1, found && c.ParentID != 0
+		}
+		if !ok || d >= maxDepth {
+			continue
+		}
+		depth[c.CommentID] = d
+
+		comment := m.comment(c)
+		comment.Depth = d
+		for _, reply := range m.comments {
+			if reply.ParentID == c.CommentID {
+				comment.ReplyCount++
+			}
+		}
+		comment.Likes, comment.Dislikes = m.countLikes(func(l memoryLike) bool { return l.CommentID == c.CommentID })
+		comment.Reactions = m.countReactions(func(l memoryLike) bool { return l.CommentID == c.CommentID })
+		comments = append(comments, comment)
+	}
+	return buildCommentTree(comments), nil
+}
+
+func (m *Memory) comment(c memoryComment) Comment {
+	comment := Comment{
+		CommentID: c.CommentID,
+		PostID:    c.PostID,
+		ParentID:  c.ParentID,
+		Username:  m.usernameByID(c.UserID),
+		Content:   c.Content,
+		CreatedAt: c.CreatedAt.Format(memoryTimeFormat),
+		Deleted:   !c.DeletedAt.IsZero(),
+		Hidden:    !c.HiddenAt.IsZero(),
+	}
+	if !c.UpdatedAt.IsZero() {
+		comment.UpdatedAt = c.UpdatedAt.Format(memoryTimeFormat)
+	}
+	return comment
+}
+
+func (m *Memory) GetComment(commentID int) (Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.comments {
+		if c.CommentID == commentID {
+			return m.comment(c), nil
+		}
+	}
+	return Comment{}, ErrNotFound
+}
+
+func (m *Memory) UpdateComment(commentID int, content string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, c := range m.comments {
+		if c.CommentID == commentID && c.DeletedAt.IsZero() {
+			m.comments[i].Content = content
+			m.comments[i].UpdatedAt = time.Now().UTC()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) DeleteComment(commentID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, c := range m.comments {
+		if c.CommentID == commentID && c.DeletedAt.IsZero() {
+			m.comments[i].Content = ""
+			m.comments[i].DeletedAt = time.Now().UTC()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) AddComment(postID, userID, parentID int, content string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.visibleTarget(TargetPost, postID) {
+		return 0, ErrNotFound
+	}
+	if parentID != 0 {
+		if !m.visibleTarget(TargetComment, parentID) {
+			return 0, ErrNotFound
+		}
+		found := false
+		for _, c := range m.comments {
+			if c.CommentID == parentID && c.PostID == postID {
+				found = true
+			}
+		}
+		if !found {
+			return 0, ErrNotFound
+		}
+	}
+
+	commentID := m.nextID("comments")
+	m.comments = append(m.comments, memoryComment{
+		CommentID: commentID,
+		PostID:    postID,
+		UserID:    userID,
+		ParentID:  parentID,
+		Content:   content,
+		CreatedAt: time.Now().UTC(),
+	})
+	return commentID, nil
+}
+
+// visibleTarget reports whether the post, or the comment and its post,
+// exists and is neither hidden nor deleted.
+func (m *Memory) visibleTarget(targetType string, targetID int) bool {
+	postID := targetID
+	if targetType == TargetComment {
+		postID = 0
+		for _, c := range m.comments {
+			if c.CommentID == targetID && c.DeletedAt.IsZero() && c.HiddenAt.IsZero() {
+				postID = c.PostID
+			}
+		}
+	}
+	for _, p := range m.posts {
+		if p.PostID == postID {
+			return p.HiddenAt.IsZero()
+		}
+	}
+	return false
+}
+
+// USERS
+func (m *Memory) usernameByID(userID int) string {
+	for _, user := range m.users {
+		if user.UserID == userID {
+			return user.Username
+		}
+	}
+	return ""
+}
+
+func (m *Memory) GetUserByUsername(username string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (m *Memory) GetUserByEmail(email string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (m *Memory) UserExists(email, username string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) || strings.EqualFold(user.Username, username) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) AddUser(email, username string, password []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userID := m.nextID("users")
+	m.users = append(m.users, User{
+		UserID:    userID,
+		Email:     email,
+		Username:  username,
+		Password:  password,
+		Role:      "member",
+		CreatedAt: time.Now().UTC().Format(memoryTimeFormat),
+	})
+	return userID, nil
+}
+
+func (m *Memory) SetUserRole(username, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].Username == username {
+			m.users[i].Role = role
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) VerifyEmail(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].UserID == userID {
+			m.users[i].EmailVerified = true
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) ClaimEmail(userID int, kind string, since time.Time) (bool, error) {
+	if _, err := emailColumn(kind); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.usernameByID(userID) == "" {
+		return false, nil
+	}
+	email := memoryEmail{userID, kind}
+	if sent, ok := m.emailsSent[email]; ok && sent.After(since) {
+		return false, nil
+	}
+	m.emailsSent[email] = time.Now().UTC()
+	return true, nil
+}
+
+func (m *Memory) ReleaseEmail(userID int, kind string) error {
+	if _, err := emailColumn(kind); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.emailsSent, memoryEmail{userID, kind})
+	return nil
+}
+
+// SESSIONS
+func (m *Memory) CreateSession(tokenHash string, session Session) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.sessions {
+		if existing.TokenHash == tokenHash {
+			return 0, errors.New("the session token hash is taken")
+		}
+	}
+	session.SessionID = m.nextID("sessions")
+	m.sessions = append(m.sessions, memorySession{Session: session, TokenHash: tokenHash})
+	return session.SessionID, nil
+}
+
+// session returns a stored session with its username.
+func (m *Memory) session(s memorySession) Session {
+	session := s.Session
+	session.Username = m.usernameByID(s.UserID)
+	return session
+}
+
+func (m *Memory) GetSession(tokenHash string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, s := range m.sessions {
+		if s.TokenHash == tokenHash && s.ExpiresAt.After(now) {
+			return m.session(s), nil
+		}
+	}
+	return Session{}, ErrNotFound
+}
+
+func (m *Memory) GetUserSessions(userID int) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	var sessions []Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.ExpiresAt.After(now) {
+			sessions = append(sessions, m.session(s))
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if !sessions[i].LastSeenAt.Equal(sessions[j].LastSeenAt) {
+			return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+		}
+		return sessions[i].SessionID > sessions[j].SessionID
+	})
+	return sessions, nil
+}
+
+func (m *Memory) TouchSession(sessionID int, lastSeenAt, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.sessions {
+		if s.SessionID == sessionID {
+			m.sessions[i].LastSeenAt = lastSeenAt
+			m.sessions[i].ExpiresAt = expiresAt
+		}
+	}
+	return nil
+}
+
+func (m *Memory) DeleteSession(tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteSessions(func(s memorySession) bool { return s.TokenHash == tokenHash })
+	return nil
+}
+
+func (m *Memory) RevokeSession(userID, sessionID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.deleteSessions(func(s memorySession) bool { return s.SessionID == sessionID && s.UserID == userID }) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Memory) DeleteExpiredSessions() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	m.deleteSessions(func(s memorySession) bool { return !s.ExpiresAt.After(now) })
+	return nil
+}
+
+// deleteSessions removes the sessions matching the condition and returns
+// how many there were.
+func (m *Memory) deleteSessions(match func(memorySession) bool) int {
+	kept := m.sessions[:0]
+	for _, s := range m.sessions {
+		if !match(s) {
+			kept = append(kept, s)
+		}
+	}
+	deleted := len(m.sessions) - len(kept)
+	m.sessions = kept
+	return deleted
+}
+
+// PASSWORD RESETS
+func (m *Memory) AddPasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.passwordResets = append(m.passwordResets, memoryPasswordReset{UserID: userID, TokenHash: tokenHash, ExpiresAt: expiresAt})
+	return nil
+}
+
+// passwordReset returns the index of the unused, unexpired reset with the
+// hash, or -1.
+func (m *Memory) passwordReset(tokenHash string) int {
+	now := time.Now().UTC()
+	for i, reset := range m.passwordResets {
+		if reset.TokenHash == tokenHash && reset.UsedAt.IsZero() && reset.ExpiresAt.After(now) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Memory) GetPasswordReset(tokenHash string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.passwordReset(tokenHash)
+	if i < 0 {
+		return User{}, ErrNotFound
+	}
+	for _, user := range m.users {
+		if user.UserID == m.passwordResets[i].UserID {
+			return user, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (m *Memory) ResetPassword(tokenHash string, password []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.passwordReset(tokenHash)
+	if i < 0 {
+		return ErrNotFound
+	}
+	userID := m.passwordResets[i].UserID
+	now := time.Now().UTC()
+	for j := range m.passwordResets {
+		if m.passwordResets[j].UserID == userID && m.passwordResets[j].UsedAt.IsZero() {
+			m.passwordResets[j].UsedAt = now
+		}
+	}
+	for j := range m.users {
+		if m.users[j].UserID == userID {
+			m.users[j].Password = password
+		}
+	}
+	m.deleteSessions(func(s memorySession) bool { return s.UserID == userID })
+	return nil
+}
+
+// TWO-FACTOR AUTHENTICATION
+func (m *Memory) GetTOTPSecret(userID int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.usernameByID(userID) == "" {
+		return "", ErrNotFound
+	}
+	return m.totp[userID].Secret, nil
+}
+
+// setTwoFactor sets the TwoFactor field of the user, and reports whether the
+// user exists.
+func (m *Memory) setTwoFactor(userID int, on bool) bool {
+	for i := range m.users {
+		if m.users[i].UserID == userID {
+			m.users[i].TwoFactor = on
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) SetTOTPSecret(userID int, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.UserID == userID && !user.TwoFactor {
+			m.totp[userID] = memoryTOTP{Secret: secret}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	totp, ok := m.totp[userID]
+	if !ok || !m.setTwoFactor(userID, true) {
+		return ErrNotFound
+	}
+	totp.LastStep = step
+	m.totp[userID] = totp
+	m.replaceRecoveryCodes(userID, recoveryCodeHashes)
+	return nil
+}
+
+func (m *Memory) DisableTOTP(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setTwoFactor(userID, false)
+	delete(m.totp, userID)
+	m.replaceRecoveryCodes(userID, nil)
+	return nil
+}
+
+func (m *Memory) UseTOTPStep(userID int, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	totp, ok := m.totp[userID]
+	if !ok || totp.LastStep >= step {
+		return false, nil
+	}
+	totp.LastStep = step
+	m.totp[userID] = totp
+	return true, nil
+}
+
+func (m *Memory) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+func (m *Memory) replaceRecoveryCodes(userID int, codeHashes []string) {
+	kept := m.recoveryCodes[:0]
+	for _, code := range m.recoveryCodes {
+		if code.UserID != userID {
+			kept = append(kept, code)
+		}
+	}
+	m.recoveryCodes = kept
+	for _, hash := range codeHashes {
+		m.recoveryCodes = append(m.recoveryCodes, memoryRecoveryCode{UserID: userID, Hash: hash})
+	}
+}
+
+func (m *Memory) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, code := range m.recoveryCodes {
+		if code.UserID == userID && code.Hash == codeHash && !code.Used {
+			m.recoveryCodes[i].Used = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) CountRecoveryCodes(userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, code := range m.recoveryCodes {
+		if code.UserID == userID && !code.Used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) FailSecondFactor(userID, maxFailures int, lockUntil time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.usernameByID(userID) == "" {
+		return false, ErrNotFound
+	}
+	state := m.secondFactor[userID]
+	state.Failures++
+	locked := state.Failures >= maxFailures
+	if locked {
+		state.Failures = 0
+		state.LockedUntil = lockUntil
+	}
+	m.secondFactor[userID] = state
+	return locked, nil
+}
+
+func (m *Memory) GetSecondFactorLock(userID int) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.usernameByID(userID) == "" {
+		return time.Time{}, ErrNotFound
+	}
+	lockedUntil := m.secondFactor[userID].LockedUntil
+	if !lockedUntil.After(time.Now().UTC()) {
+		return time.Time{}, nil
+	}
+	return lockedUntil, nil
+}
+
+func (m *Memory) ResetSecondFactorFailures(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := m.secondFactor[userID]
+	state.Failures = 0
+	m.secondFactor[userID] = state
+	return nil
+}
+
+func (m *Memory) AddLoginChallenge(userID int, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.loginChallenges = append(m.loginChallenges, memoryLoginChallenge{UserID: userID, TokenHash: tokenHash, ExpiresAt: expiresAt})
+	return nil
+}
+
+// loginChallenge returns the index of the unexpired challenge with the
+// hash, or -1.
+func (m *Memory) loginChallenge(tokenHash string) int {
+	now := time.Now().UTC()
+	for i, challenge := range m.loginChallenges {
+		if challenge.TokenHash == tokenHash && challenge.ExpiresAt.After(now) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Memory) GetLoginChallenge(tokenHash string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.loginChallenge(tokenHash)
+	if i < 0 {
+		return 0, ErrNotFound
+	}
+	return m.loginChallenges[i].UserID, nil
+}
+
+func (m *Memory) FailLoginChallenge(tokenHash string, maxAttempts int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.loginChallenge(tokenHash)
+	if i < 0 {
+		return false, nil
+	}
+	m.loginChallenges[i].Attempts++
+	if m.loginChallenges[i].Attempts >= maxAttempts {
+		m.loginChallenges = append(m.loginChallenges[:i], m.loginChallenges[i+1:]...)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (m *Memory) DeleteLoginChallenge(tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	kept := m.loginChallenges[:0]
+	for _, challenge := range m.loginChallenges {
+		if challenge.TokenHash != tokenHash && challenge.ExpiresAt.After(now) {
+			kept = append(kept, challenge)
+		}
+	}
+	m.loginChallenges = kept
+	return nil
+}
+
+// SETTINGS
+func (m *Memory) GetSetting(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.settings[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (m *Memory) SetSetting(name, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.settings[name] = value
+	return nil
+}
+
+// API TOKENS
+func (m *Memory) AddAPIToken(userID int, name, hash string, scopes []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokenID := m.nextID("api_tokens")
+	m.apiTokens = append(m.apiTokens, memoryAPIToken{
+		TokenID:   tokenID,
+		UserID:    userID,
+		Name:      name,
+		Hash:      hash,
+		Scopes:    append([]string(nil), scopes...),
+		CreatedAt: time.Now().UTC(),
+	})
+	return tokenID, nil
+}
+
+func (m *Memory) GetAPITokens(userID int) ([]APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tokens []APIToken
+	for i := len(m.apiTokens) - 1; i >= 0; i-- {
+		if t := m.apiTokens[i]; t.UserID == userID && t.RevokedAt.IsZero() {
+			tokens = append(tokens, t.token())
+		}
+	}
+	return tokens, nil
+}
+
+func (m *Memory) RevokeAPIToken(userID, tokenID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, t := range m.apiTokens {
+		if t.TokenID == tokenID && t.UserID == userID && t.RevokedAt.IsZero() {
+			m.apiTokens[i].RevokedAt = time.Now().UTC()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) UseAPIToken(hash string) (User, APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, t := range m.apiTokens {
+		if t.Hash != hash || !t.RevokedAt.IsZero() {
+			continue
+		}
+		for _, user := range m.users {
+			if user.UserID == t.UserID {
+				m.apiTokens[i].LastUsedAt = time.Now().UTC()
+				return user, m.apiTokens[i].token(), nil
+			}
+		}
+	}
+	return User{}, APIToken{}, ErrNotFound
+}
+
+// REACTIONS
+func (m *Memory) SetReaction(userID int, targetType string, targetID, reactionType int) error {
+	if _, err := targetColumn(targetType); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	enabled := false
+	for _, t := range m.reactionTypes {
+		enabled = enabled || (t.Type == reactionType && t.Enabled)
+	}
+	if !enabled || !m.visibleTarget(targetType, targetID) {
+		return ErrNotFound
+	}
+
+	like := memoryLike{UserID: userID, Type: reactionType, CreatedAt: time.Now().UTC()}
+	if targetType == TargetPost {
+		like.PostID = targetID
+	} else {
+		like.CommentID = targetID
+	}
+	for i, existing := range m.likes {
+		if existing.UserID == userID && existing.PostID == like.PostID && existing.CommentID == like.CommentID {
+			if existing.Type == reactionType {
+				m.likes = append(m.likes[:i], m.likes[i+1:]...)
+			} else {
+				m.likes[i].Type = reactionType
+				m.likes[i].CreatedAt = like.CreatedAt
+			}
+			return nil
+		}
+	}
+	m.likes = append(m.likes, like)
+	return nil
+}
+
+func (m *Memory) GetUserReactions(userID int, targetType string, targetIDs []int) (map[int]int, error) {
+	if _, err := targetColumn(targetType); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := map[int]bool{}
+	for _, targetID := range targetIDs {
+		wanted[targetID] = true
+	}
+	reactions := map[int]int{}
+	for _, like := range m.likes {
+		targetID := like.CommentID
+		if targetType == TargetPost {
+			targetID = like.PostID
+		}
+		if like.UserID == userID && targetID != 0 && wanted[targetID] {
+			reactions[targetID] = like.Type
+		}
+	}
+	return reactions, nil
+}
+
+func (m *Memory) GetReactionCounts(targetType string, targetIDs []int) (map[int][]ReactionCount, error) {
+	if _, err := targetColumn(targetType); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byTarget := map[int][]ReactionCount{}
+	for _, targetID := range targetIDs {
+		targetID := targetID
+		byTarget[targetID] = m.countReactions(func(l memoryLike) bool {
+			if targetType == TargetPost {
+				return l.PostID == targetID
+			}
+			return l.CommentID == targetID
+		})
+	}
+	return byTarget, nil
+}
+
+func (m *Memory) GetReactors(targetType string, targetID int) ([]Reactor, error) {
+	if _, err := targetColumn(targetType); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reactors []Reactor
+	for _, reactionType := range m.sortedReactionTypes() {
+		if !reactionType.Enabled {
+			continue
+		}
+		var likes []memoryLike
+		for _, like := range m.likes {
+			matches := like.CommentID == targetID
+			if targetType == TargetPost {
+				matches = like.PostID == targetID
+			}
+			if matches && like.Type == reactionType.Type {
+				likes = append(likes, like)
+			}
+		}
+		sort.SliceStable(likes, func(i, j int) bool { return likes[i].CreatedAt.Before(likes[j].CreatedAt) })
+		for _, like := range likes {
+			reactors = append(reactors, Reactor{
+				Username:  m.usernameByID(like.UserID),
+				Type:      like.Type,
+				CreatedAt: like.CreatedAt.Format(memoryTimeFormat),
+			})
+		}
+	}
+	return reactors, nil
+}
+
+func (m *Memory) GetReactionTypes() ([]ReactionType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sortedReactionTypes(), nil
+}
+
+func (m *Memory) AddReactionType(name, emoji string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reactionType := ReactionType{Name: name, Emoji: emoji, Enabled: true}
+	for _, t := range m.reactionTypes {
+		if t.Name == name {
+			return 0, ErrDuplicate
+		}
+		if t.Type >= reactionType.Type {
+			reactionType.Type = t.Type + 1
+		}
+		if t.SortOrder >= reactionType.SortOrder {
+			reactionType.SortOrder = t.SortOrder + 1
+		}
+	}
+	m.reactionTypes = append(m.reactionTypes, reactionType)
+	return reactionType.Type, nil
+}
+
+func (m *Memory) SetReactionTypeEnabled(name string, enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, t := range m.reactionTypes {
+		if t.Name == name {
+			m.reactionTypes[i].Enabled = enabled
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Recount has nothing to do: Memory counts reactions and comments whenever
+// it is asked for them.
+func (m *Memory) Recount() (posts, comments int, err error) {
+	return 0, 0, nil
+}
+
+// REPORTS
+func (m *Memory) AddReport(reporterID int, targetType string, targetID int, reason string) error {
+	if _, err := targetColumn(targetType); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := memoryReport{ReporterID: reporterID, Reason: reason, Status: ReportOpen, CreatedAt: time.Now().UTC()}
+	if targetType == TargetPost {
+		report.PostID = targetID
+	} else {
+		report.CommentID = targetID
+	}
+	if _, _, ok := m.reportTarget(report); !ok {
+		return ErrNotFound
+	}
+	for _, existing := range m.reports {
+		if existing.ReporterID == reporterID && existing.Status == ReportOpen && sameTarget(existing, report) {
+			return nil
+		}
+	}
+	report.ReportID = m.nextID("reports")
+	m.reports = append(m.reports, report)
+	return nil
+}
+
+func sameTarget(a, b memoryReport) bool {
+	return a.PostID == b.PostID && a.CommentID == b.CommentID
+}
+
+// reportTarget returns the reported post, or the post the reported comment
+// is on, together with the author of the reported post or comment.
+func (m *Memory) reportTarget(report memoryReport) (postID, authorID int, ok bool) {
+	if report.CommentID != 0 {
+		for _, comment := range m.comments {
+			if comment.CommentID == report.CommentID {
+				return comment.PostID, comment.UserID, true
+			}
+		}
+		return 0, 0, false
+	}
+	for _, post := range m.posts {
+		if post.PostID == report.PostID {
+			return post.PostID, post.UserID, true
+		}
+	}
+	return 0, 0, false
+}
+
+func (m *Memory) GetOpenReports() ([]Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reports []Report
+	for _, r := range m.reports {
+		if r.Status != ReportOpen {
+			continue
+		}
+		postID, authorID, ok := m.reportTarget(r)
+		if !ok {
+			continue
+		}
+		report := Report{
+			ReportID:   r.ReportID,
+			Reporter:   m.usernameByID(r.ReporterID),
+			TargetType: TargetPost,
+			TargetID:   r.PostID,
+			PostID:     postID,
+			Author:     m.usernameByID(authorID),
+			Reason:     r.Reason,
+			Status:     r.Status,
+			CreatedAt:  r.CreatedAt.Format(memoryTimeFormat),
+		}
+		if r.CommentID != 0 {
+			report.TargetType, report.TargetID = TargetComment, r.CommentID
+			for _, comment := range m.comments {
+				if comment.CommentID == r.CommentID {
+					report.Excerpt = comment.Content
+				}
+			}
+		} else {
+			for _, post := range m.posts {
+				if post.PostID == r.PostID {
+					report.Excerpt = post.Title
+				}
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func (m *Memory) ResolveReport(reportID, moderatorID int, decision, note string) error {
+	switch decision {
+	case DecisionHide, DecisionWarn, DecisionDismiss:
+	default:
+		return errors.New("invalid decision " + decision)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := -1
+	for i, report := range m.reports {
+		if report.ReportID == reportID && report.Status == ReportOpen {
+			index = i
+		}
+	}
+	if index < 0 {
+		return ErrNotFound
+	}
+	report := m.reports[index]
+	postID, authorID, ok := m.reportTarget(report)
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+
+	switch decision {
+	case DecisionHide:
+		if report.CommentID != 0 {
+			for i := range m.comments {
+				if m.comments[i].CommentID == report.CommentID {
+					m.comments[i].HiddenAt = now
+				}
+			}
+		} else {
+			for i := range m.posts {
+				if m.posts[i].PostID == report.PostID {
+					m.posts[i].HiddenAt = now
+				}
+			}
+		}
+	case DecisionWarn:
+		m.warnings = append(m.warnings, memoryWarning{
+			WarningID:   m.nextID("warnings"),
+			UserID:      authorID,
+			ModeratorID: moderatorID,
+			Reason:      report.Reason,
+			Note:        note,
+			CreatedAt:   now,
+		})
+	}
+
+	for i := range m.reports {
+		if m.reports[i].Status == ReportOpen && sameTarget(m.reports[i], report) {
+			m.reports[i].Status = decision
+			m.reports[i].ResolvedAt = now
+		}
+	}
+
+	action := memoryAction{
+		ActionID:    m.nextID("moderation_actions"),
+		ModeratorID: moderatorID,
+		AuthorID:    authorID,
+		TargetType:  TargetPost,
+		TargetID:    report.PostID,
+		PostID:      postID,
+		Decision:    decision,
+		Reason:      report.Reason,
+		Note:        note,
+		CreatedAt:   now,
+	}
+	if report.CommentID != 0 {
+		action.TargetType, action.TargetID = TargetComment, report.CommentID
+	}
+	m.actions = append(m.actions, action)
+	return nil
+}
+
+func (m *Memory) GetModerationLog(limit int) ([]ModerationAction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var actions []ModerationAction
+	for i := len(m.actions) - 1; i >= 0 && len(actions) < limit; i-- {
+		a := m.actions[i]
+		actions = append(actions, ModerationAction{
+			ActionID:   a.ActionID,
+			Moderator:  m.usernameByID(a.ModeratorID),
+			Author:     m.usernameByID(a.AuthorID),
+			TargetType: a.TargetType,
+			TargetID:   a.TargetID,
+			PostID:     a.PostID,
+			Decision:   a.Decision,
+			Reason:     a.Reason,
+			Note:       a.Note,
+			CreatedAt:  a.CreatedAt.Format(memoryTimeFormat),
+		})
+	}
+	return actions, nil
+}
+
+func (m *Memory) GetWarnings(userID int) ([]Warning, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var warnings []Warning
+	for i := len(m.warnings) - 1; i >= 0; i-- {
+		w := m.warnings[i]
+		if w.UserID != userID {
+			continue
+		}
+		warnings = append(warnings, Warning{
+			WarningID: w.WarningID,
+			Moderator: m.usernameByID(w.ModeratorID),
+			Reason:    w.Reason,
+			Note:      w.Note,
+			CreatedAt: w.CreatedAt.Format(memoryTimeFormat),
+		})
+	}
+	return warnings, nil
+}
+
+// SEARCH
+func (m *Memory) Search(query SearchQuery, limit int) ([]SearchResult, error) {
+	words := searchWords(query.Text)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inCategory := func(postID int) bool {
+		if query.Category == "" {
+			return true
+		}
+		for _, categoryID := range m.postCategories[postID] {
+			if category, ok := m.categoryByID(categoryID); ok && category.Slug == query.Category {
+				return true
+			}
+		}
+		return false
+	}
+	visiblePosts := map[int]memoryPost{}
+	for _, p := range m.posts {
+		if p.HiddenAt.IsZero() {
+			visiblePosts[p.PostID] = p
+		}
+	}
+
+	type scored struct {
+		SearchResult
+		score int
+	}
+	var matches []scored
+	for _, p := range m.posts {
+		author := m.usernameByID(p.UserID)
+		if !p.HiddenAt.IsZero() || (query.Author != "" && author != query.Author) || !inCategory(p.PostID) {
+			continue
+		}
+		score := memoryScore(p.Title+" "+p.Content, words)
+		if score == 0 {
+			continue
+		}
+		// Like the bm25 weights in SQLite, titles count more
+		score += 4 * memoryScore(p.Title, words)
+		snippetText := p.Content
+		if memoryScore(p.Content, words) == 0 {
+			snippetText = p.Title
+		}
+		matches = append(matches, scored{SearchResult{
+			TargetType: TargetPost,
+			PostID:     p.PostID,
+			Title:      p.Title,
+			Author:     author,
+			Snippet:    memorySnippet(snippetText, words),
+			CreatedAt:  p.CreatedAt.Format(memoryTimeFormat),
+		}, score})
+	}
+	for _, c := range m.comments {
+		post, ok := visiblePosts[c.PostID]
+		author := m.usernameByID(c.UserID)
+		if !ok || !c.DeletedAt.IsZero() || !c.HiddenAt.IsZero() ||
+			(query.Author != "" && author != query.Author) || !inCategory(c.PostID) {
+			continue
+		}
+		score := memoryScore(c.Content, words)
+		if score == 0 {
+			continue
+		}
+		matches = append(matches, scored{SearchResult{
+			TargetType: TargetComment,
+			PostID:     c.PostID,
+			CommentID:  c.CommentID,
+			Title:      post.Title,
+			Author:     author,
+			Snippet:    memorySnippet(c.Content, words),
+			CreatedAt:  c.CreatedAt.Format(memoryTimeFormat),
+		}, score})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	var results []SearchResult
+	for i := 0; i < len(matches) && i < limit; i++ {
+		results = append(results, matches[i].SearchResult)
+	}
+	return results, nil
+}
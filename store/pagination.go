@@ -0,0 +1,100 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort order")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Sorts lists the sort orders in the order the index page offers them.
+var Sorts = []string{SortNewest, SortOldest, SortMostLiked, SortMostCommented, SortActive}
+
+// ValidSort reports whether sort names a sort order; empty means SortNewest.
+func ValidSort(sort string) bool {
+	if sort == "" {
+		return true
+	}
+	for _, s := range Sorts {
+		if s == sort {
+			return true
+		}
+	}
+	return false
+}
+
+// cursor marks the last post of a page: the value it was sorted by and its
+// ID. Pages continue after it.
+type cursor struct {
+	Sort   string
+	Key    string
+	PostID int
+}
+
+func (c cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Sort + "\x00" + c.Key + "\x00" + strconv.Itoa(c.PostID)))
+}
+
+// parseCursor decodes the After of opts, whose sort must already have been
+// defaulted. An empty After gives the zero cursor.
+func parseCursor(opts ListOptions) (cursor, error) {
+	if opts.After == "" {
+		return cursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(opts.After)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), "\x00")
+	if len(parts) != 3 || parts[0] != opts.Sort {
+		return cursor{}, ErrInvalidCursor
+	}
+	postID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	if countSort(opts.Sort) {
+		if _, err := strconv.Atoi(parts[1]); err != nil {
+			return cursor{}, ErrInvalidCursor
+		}
+	}
+	return cursor{Sort: parts[0], Key: parts[1], PostID: postID}, nil
+}
+
+// listOptions defaults the sort order of opts and checks it.
+func listOptions(opts ListOptions) (ListOptions, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortNewest
+	}
+	if !ValidSort(opts.Sort) {
+		return opts, ErrInvalidSort
+	}
+	return opts, nil
+}
+
+// countSort reports whether the sort order compares counts rather than
+// times.
+func countSort(sort string) bool {
+	return sort == SortMostLiked || sort == SortMostCommented
+}
+
+// compareKeys compares two sort keys of the sort order.
+func compareKeys(sort, a, b string) int {
+	if countSort(sort) {
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,289 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"forum/database"
+	"forum/database/migrations"
+	"forum/store"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// queries counts the statements run through the "sqlite3-counting"
+// driver.
+var queries int64
+
+var registerCounting sync.Once
+
+// countingDriver wraps the SQLite driver and counts every statement it
+// runs, whether directly on the connection or through a prepared
+// statement.
+type countingDriver struct{ driver.Driver }
+
+func (d countingDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{c}, nil
+}
+
+type countingConn struct{ driver.Conn }
+
+func (c countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	atomic.AddInt64(&queries, 1)
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	atomic.AddInt64(&queries, 1)
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c countingConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return countingStmt{stmt}, nil
+}
+
+type countingStmt struct{ driver.Stmt }
+
+func (s countingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	atomic.AddInt64(&queries, 1)
+	return s.Stmt.Exec(args) //nolint:staticcheck // the only method a plain driver.Stmt has
+}
+
+func (s countingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	atomic.AddInt64(&queries, 1)
+	return s.Stmt.Query(args) //nolint:staticcheck // the only method a plain driver.Stmt has
+}
+
+// openCounted returns a migrated SQLite store in a temporary directory
+// whose statements are counted in queries. It skips when SQLite was built
+// without FTS5.
+func openCounted(tb testing.TB) store.Store {
+	tb.Helper()
+	registerCounting.Do(func() {
+		sql.Register("sqlite3-counting", countingDriver{&sqlite3.SQLiteDriver{}})
+	})
+	path := filepath.Join(tb.TempDir(), "forum.db")
+	db, err := sql.Open("sqlite3-counting", "file:"+path+"?_sync=OFF&_journal=WAL")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, string(database.SQLite))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			tb.Skip("SQLite was built without FTS5; run the tests with -tags sqlite_fts5")
+		}
+		tb.Fatal(err)
+	}
+	st := store.NewSQL(db, database.SQLite)
+	for _, name := range []string{"General", "Help"} {
+		if _, err := st.AddCategory(store.Category{Category: name, Slug: store.Slugify(name)}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return st
+}
+
+// seed fills the store with users, posts in both categories, comments,
+// reactions and edits, and returns the IDs of the posts.
+func seed(tb testing.TB, st store.Store, users, posts, comments int) []int {
+	tb.Helper()
+	userIDs := make([]int, users)
+	for i := range userIDs {
+		id, err := st.AddUser(fmt.Sprintf("user%d@example.com", i), fmt.Sprintf("user%d", i), []byte("hash"))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		userIDs[i] = id
+	}
+
+	postIDs := make([]int, posts)
+	for i := range postIDs {
+		author := userIDs[i%users]
+		categories := []string{"General"}
+		if i%3 == 0 {
+			categories = append(categories, "Help")
+		}
+		id, err := st.AddPost(author, fmt.Sprintf("Post %d", i), fmt.Sprintf("The text of post %d", i), categories)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		postIDs[i] = id
+		for edit := 0; i%10 == 0 && edit < 3; edit++ {
+			title := fmt.Sprintf("Post %d, edit %d", i, edit)
+			if err := st.UpdatePost(id, author, title, "Edited text", []string{"Help"}); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+
+	for i := 0; i < comments; i++ {
+		postID := postIDs[i%posts]
+		commentID, err := st.AddComment(postID, userIDs[i%users], 0, fmt.Sprintf("Comment %d", i))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := st.SetReaction(userIDs[(i+1)%users], store.TargetComment, commentID, store.Like); err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := st.AddComment(postID, userIDs[(i+2)%users], commentID, fmt.Sprintf("Reply %d", i)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	for i, postID := range postIDs {
+		reaction := store.Like
+		if i%4 == 0 {
+			reaction = store.Dislike
+		}
+		for j := 0; j < i%users; j++ {
+			if err := st.SetReaction(userIDs[j], store.TargetPost, postID, reaction); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return postIDs
+}
+
+// listingCase is one read the pages of the forum make, with the number of
+// statements it runs however much there is to read. The post listings read
+// two pages.
+type listingCase struct {
+	name    string
+	queries int64
+	run     func(st store.Store, postIDs []int, limit int) error
+}
+
+func listingCases() []listingCase {
+	listing := func(get func(st store.Store, opts store.ListOptions) (store.PostPage, error), sort string) func(store.Store, []int, int) error {
+		return func(st store.Store, _ []int, limit int) error {
+			page, err := get(st, store.ListOptions{Sort: sort, Limit: limit})
+			if err != nil {
+				return err
+			}
+			// The second page goes through the cursor.
+			_, err = get(st, store.ListOptions{Sort: sort, After: page.NextCursor, Limit: limit})
+			return err
+		}
+	}
+	posts := func(st store.Store, opts store.ListOptions) (store.PostPage, error) { return st.GetPosts(opts) }
+	byCategory := func(st store.Store, opts store.ListOptions) (store.PostPage, error) {
+		return st.GetPostsByCategory("help", opts)
+	}
+	created := func(st store.Store, opts store.ListOptions) (store.PostPage, error) {
+		return st.GetUserCreatedPosts("user1", opts)
+	}
+	liked := func(st store.Store, opts store.ListOptions) (store.PostPage, error) {
+		return st.GetUserLikedPosts("user1", opts)
+	}
+
+	cases := []listingCase{
+		{"category", 10, listing(byCategory, "")},
+		{"created", 10, listing(created, "")},
+		{"liked", 10, listing(liked, "")},
+		{"by ID", 4, func(st store.Store, postIDs []int, limit int) error {
+			_, err := st.GetPostsByID(postIDs[:limit])
+			return err
+		}},
+		{"comments", 3, func(st store.Store, postIDs []int, _ int) error {
+			_, err := st.GetCommentsForPost(postIDs[0], 0, 0)
+			return err
+		}},
+		{"reaction counts", 2, func(st store.Store, postIDs []int, limit int) error {
+			_, err := st.GetReactionCounts(store.TargetPost, postIDs[:limit])
+			return err
+		}},
+		{"revisions", 2, func(st store.Store, postIDs []int, _ int) error {
+			_, err := st.GetPostRevisions(postIDs[0])
+			return err
+		}},
+	}
+	for _, sort := range []string{store.SortNewest, store.SortOldest, store.SortMostLiked, store.SortMostCommented, store.SortActive} {
+		cases = append(cases, listingCase{sort, 10, listing(posts, sort)})
+	}
+	return cases
+}
+
+// countQueries returns the number of statements run runs.
+func countQueries(run func() error) (int64, error) {
+	before := atomic.LoadInt64(&queries)
+	err := run()
+	return atomic.LoadInt64(&queries) - before, err
+}
+
+// TestListingQueryCount checks that reading a page of posts, comments or
+// revisions runs the same few statements whether it shows a handful of
+// rows or many, rather than one more for each row.
+func TestListingQueryCount(t *testing.T) {
+	st := openCounted(t)
+	postIDs := seed(t, st, 10, 60, 60)
+
+	for _, tc := range listingCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, limit := range []int{2, 25} {
+				n, err := countQueries(func() error { return tc.run(st, postIDs, limit) })
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != tc.queries {
+					t.Errorf("ran %d statements for %d rows, want %d", n, limit, tc.queries)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkListing times the reads of TestListingQueryCount on a large
+// forum, reports the statements each one runs and fails when that is more
+// than on a small one.
+func BenchmarkListing(b *testing.B) {
+	st := openCounted(b)
+	postIDs := seed(b, st, 50, 2000, 5000)
+
+	for _, tc := range listingCases() {
+		b.Run(tc.name, func(b *testing.B) {
+			b.ResetTimer()
+			n, err := countQueries(func() error {
+				for i := 0; i < b.N; i++ {
+					if err := tc.run(st, postIDs, 50); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if n != tc.queries*int64(b.N) {
+				b.Errorf("ran %d statements in %d reads, want %d each", n, b.N, tc.queries)
+			}
+			b.ReportMetric(float64(n)/float64(b.N), "queries/op")
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+)
+
+// searchWords splits search text into the words that must all match.
+// Everything but letters and digits separates words, so no query syntax
+// reaches the search engine.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// memoryScore counts how often the words occur in text, or returns 0 unless
+// every one of them does.
+func memoryScore(text string, words []string) int {
+	text = strings.ToLower(text)
+	score := 0
+	for _, word := range words {
+		n := strings.Count(text, word)
+		if n == 0 {
+			return 0
+		}
+		score += n
+	}
+	return score
+}
+
+// memorySnippet cuts an excerpt of about snippetRunes characters around the
+// first match in text and highlights every match in it.
+func memorySnippet(text string, words []string) string {
+	const snippetRunes = 120
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// Lower-casing changed the length, so offsets would not line up
+		lower = runes
+	}
+
+	first := -1
+	for _, word := range words {
+		if i := strings.Index(string(lower), word); i >= 0 {
+			if at := len([]rune(string(lower)[:i])); first < 0 || at < first {
+				first = at
+			}
+		}
+	}
+	start := 0
+	if first > snippetRunes/3 {
+		start = first - snippetRunes/3
+	}
+	end := start + snippetRunes
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	excerpt := lower[start:end]
+	original := runes[start:end]
+	for i := 0; i < len(original); {
+		matched := 0
+		for _, word := range words {
+			if strings.HasPrefix(string(excerpt[i:]), word) {
+				if n := len([]rune(word)); n > matched {
+					matched = n
+				}
+			}
+		}
+		if matched > 0 {
+			b.WriteString(HighlightStart + string(original[i:i+matched]) + HighlightEnd)
+			i += matched
+			continue
+		}
+		b.WriteRune(original[i])
+		i++
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
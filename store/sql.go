@@ -0,0 +1,2060 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLStore implements Store on top of a database/sql connection. Queries
+// are written once with ? placeholders and rebound for the dialect.
+type SQLStore struct {
+	db *sql.DB
+	conn
+}
+
+var _ Store = (*SQLStore)(nil)
+
+func NewSQL(db *sql.DB, dialect database.Dialect) *SQLStore {
+	return &SQLStore{db: db, conn: conn{q: db, dialect: dialect}}
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// conn runs queries against a database or a transaction, rewriting
+// placeholders for the dialect on the way.
+type conn struct {
+	q       querier
+	dialect database.Dialect
+}
+
+func (c conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.q.Exec(c.dialect.Rebind(query), args...)
+}
+
+func (c conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.q.Query(c.dialect.Rebind(query), args...)
+}
+
+func (c conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.q.QueryRow(c.dialect.Rebind(query), args...)
+}
+
+// Insert runs an INSERT and returns the generated value of idColumn.
+// PostgreSQL has no LastInsertId, so there the ID comes from RETURNING.
+func (c conn) Insert(query, idColumn string, args ...interface{}) (int, error) {
+	if c.dialect == database.Postgres {
+		var id int
+		err := c.QueryRow(query+" RETURNING "+idColumn, args...).Scan(&id)
+		return id, err
+	}
+	result, err := c.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// begin starts a transaction and returns a conn bound to it.
+func (s *SQLStore) begin() (*sql.Tx, conn, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, conn{}, err
+	}
+	return tx, conn{q: tx, dialect: s.dialect}, nil
+}
+
+// CATEGORIES
+const selectCategories = `
+	SELECT category_ID, category, slug, description, color, sort_order, retired_at
+	FROM categories
+`
+
+func (s *SQLStore) GetCategories() ([]Category, error) {
+	return s.queryCategories(selectCategories + "WHERE retired_at IS NULL ORDER BY sort_order, category_ID")
+}
+
+func (s *SQLStore) GetAllCategories() ([]Category, error) {
+	return s.queryCategories(selectCategories + "ORDER BY sort_order, category_ID")
+}
+
+func (s *SQLStore) GetCategory(categoryID int) (Category, error) {
+	categories, err := s.queryCategories(selectCategories+"WHERE category_ID = ?", categoryID)
+	if err != nil {
+		return Category{}, err
+	}
+	if len(categories) == 0 {
+		return Category{}, ErrNotFound
+	}
+	return categories[0], nil
+}
+
+func (s *SQLStore) queryCategories(query string, args ...interface{}) ([]Category, error) {
+	rows, err := s.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// scanCategory reads the columns of selectCategories, followed by any
+// columns scanned into dest.
+func scanCategory(rows *sql.Rows, dest ...interface{}) (Category, error) {
+	var category Category
+	var retiredAt sql.NullString
+	columns := append([]interface{}{&category.CategoryID, &category.Category, &category.Slug, &category.Description,
+		&category.Color, &category.SortOrder, &retiredAt}, dest...)
+	if err := rows.Scan(columns...); err != nil {
+		return Category{}, err
+	}
+	category.Retired = retiredAt.Valid
+	return category, nil
+}
+
+// categoryTaken reports whether another category than categoryID already
+// has the name, ignoring case, or the slug.
+func (s *SQLStore) categoryTaken(categoryID int, name, slug string) (bool, error) {
+	var taken int
+	query := "SELECT COUNT(*) FROM categories WHERE (LOWER(category) = LOWER(?) OR slug = ?) AND category_ID <> ?"
+	if err := s.QueryRow(query, name, slug, categoryID).Scan(&taken); err != nil {
+		return false, err
+	}
+	return taken > 0, nil
+}
+
+func (s *SQLStore) AddCategory(category Category) (int, error) {
+	if taken, err := s.categoryTaken(0, category.Category, category.Slug); err != nil {
+		return 0, err
+	} else if taken {
+		return 0, ErrDuplicate
+	}
+	query := "INSERT INTO categories (category, slug, description, color, sort_order) VALUES (?, ?, ?, ?, ?)"
+	return s.Insert(query, "category_ID", category.Category, category.Slug, category.Description, category.Color, category.SortOrder)
+}
+
+func (s *SQLStore) UpdateCategory(category Category) error {
+	if taken, err := s.categoryTaken(category.CategoryID, category.Category, category.Slug); err != nil {
+		return err
+	} else if taken {
+		return ErrDuplicate
+	}
+	query := "UPDATE categories SET category = ?, slug = ?, description = ?, color = ?, sort_order = ? WHERE category_ID = ?"
+	result, err := s.Exec(query, category.Category, category.Slug, category.Description, category.Color, category.SortOrder, category.CategoryID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) SetCategoryRetired(categoryID int, retired bool) error {
+	var retiredAt interface{}
+	if retired {
+		retiredAt = time.Now().UTC()
+	}
+	result, err := s.Exec("UPDATE categories SET retired_at = ? WHERE category_ID = ?", retiredAt, categoryID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) MergeCategory(sourceID, targetID int) error {
+	if sourceID == targetID {
+		return errors.New("cannot merge a category into itself")
+	}
+
+	tx, c, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var found int
+	err = c.QueryRow("SELECT COUNT(*) FROM categories WHERE category_ID IN (?, ?)", sourceID, targetID).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != 2 {
+		return ErrNotFound
+	}
+
+	// Posts already filed under both keep a single row for the target
+	queries := []string{
+		`INSERT INTO post_categories (post_ID, category_ID)
+			SELECT post_ID, ? FROM post_categories
+			WHERE category_ID = ? AND post_ID NOT IN (SELECT post_ID FROM post_categories WHERE category_ID = ?)`,
+		`INSERT INTO post_revision_categories (revision_ID, category_ID)
+			SELECT revision_ID, ? FROM post_revision_categories
+			WHERE category_ID = ? AND revision_ID NOT IN (SELECT revision_ID FROM post_revision_categories WHERE category_ID = ?)`,
+	}
+	for _, query := range queries {
+		if _, err := c.Exec(query, targetID, sourceID, targetID); err != nil {
+			return err
+		}
+	}
+	for _, query := range []string{
+		"DELETE FROM post_categories WHERE category_ID = ?",
+		"DELETE FROM post_revision_categories WHERE category_ID = ?",
+		"DELETE FROM categories WHERE category_ID = ?",
+	} {
+		if _, err := c.Exec(query, sourceID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// getCategoriesForPosts returns the categories of each of the posts, in
+// one query.
+func (s *SQLStore) getCategoriesForPosts(postIDs []int) (map[int][]Category, error) {
+	byPost := map[int][]Category{}
+	if len(postIDs) == 0 {
+		return byPost, nil
+	}
+	placeholders, args := inList(postIDs)
+	rows, err := s.Query(`
+		SELECT c.category_ID, c.category, c.slug, c.description, c.color, c.sort_order, c.retired_at, pc.post_ID
+		FROM categories AS c
+		INNER JOIN post_categories AS pc ON c.category_ID = pc.category_ID
+		WHERE pc.post_ID IN (`+placeholders+`)
+		ORDER BY c.sort_order, c.category_ID
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		category, err := scanCategory(rows, &postID)
+		if err != nil {
+			return nil, err
+		}
+		byPost[postID] = append(byPost[postID], category)
+	}
+	return byPost, rows.Err()
+}
+
+// inList returns the placeholders and arguments of an IN (...) list.
+func inList(ids []int) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+// POSTS
+const selectPosts = `
+	SELECT p.post_ID, u.username, p.title, p.content, p.created_at, p.updated_at, p.hidden_at,
+		p.like_count, p.dislike_count, p.comment_count
+	FROM posts AS p
+	INNER JOIN users AS u ON p.user_ID = u.user_ID
+`
+
+func (s *SQLStore) GetPosts(opts ListOptions) (PostPage, error) {
+	return s.listPosts(opts, "")
+}
+
+func (s *SQLStore) GetPost(postID int) (Post, error) {
+	posts, err := s.queryPosts(selectPosts+"WHERE p.post_ID = ?", postID)
+	if err != nil {
+		return Post{}, err
+	}
+	if len(posts) == 0 {
+		return Post{}, ErrNotFound
+	}
+	return posts[0], nil
+}
+
+func (s *SQLStore) GetPostsByCategory(slug string, opts ListOptions) (PostPage, error) {
+	if slug == "all" {
+		return s.GetPosts(opts)
+	}
+	return s.listPosts(opts, `
+		AND p.post_ID IN (
+			SELECT pc.post_ID FROM post_categories AS pc
+			INNER JOIN categories AS c ON pc.category_ID = c.category_ID
+			WHERE c.slug = ?
+		)`, slug)
+}
+
+func (s *SQLStore) GetUserLikedPosts(username string, opts ListOptions) (PostPage, error) {
+	return s.listPosts(opts, `
+		AND p.post_ID IN (
+			SELECT post_ID FROM likes WHERE user_ID = (SELECT user_ID FROM users WHERE username = ?)
+		)`, username)
+}
+
+func (s *SQLStore) GetUserCreatedPosts(username string, opts ListOptions) (PostPage, error) {
+	return s.listPosts(opts, " AND u.username = ?", username)
+}
+
+// sortKey is the SQL expression a sort order sorts posts by.
+func (s *SQLStore) sortKey(sort string) string {
+	switch sort {
+	case SortMostLiked:
+		return "p.like_count"
+	case SortMostCommented:
+		return "p.comment_count"
+	case SortActive:
+		lastComment := "(SELECT MAX(c.created_at) FROM comments AS c WHERE c.post_ID = p.post_ID)"
+		if s.dialect == database.Postgres {
+			return "GREATEST(p.created_at, p.updated_at, " + lastComment + ")"
+		}
+		// SQLite's MAX is NULL as soon as one argument is
+		return "MAX(p.created_at, COALESCE(p.updated_at, p.created_at), COALESCE(" + lastComment + ", p.created_at))"
+	}
+	return "p.created_at"
+}
+
+// listPosts returns a page of the visible posts matching condition, which
+// is appended to the WHERE clause with its args. Posts are joined as p and
+// their authors as u.
+func (s *SQLStore) listPosts(opts ListOptions, condition string, args ...interface{}) (PostPage, error) {
+	opts, err := listOptions(opts)
+	if err != nil {
+		return PostPage{}, err
+	}
+	after, err := parseCursor(opts)
+	if err != nil {
+		return PostPage{}, err
+	}
+
+	key := s.sortKey(opts.Sort)
+	direction, beyond := "DESC", "<"
+	if opts.Sort == SortOldest {
+		direction, beyond = "ASC", ">"
+	}
+	selected := key
+	if !countSort(opts.Sort) {
+		// The cursor is compared with the stored text
+		selected = s.timestampText(key)
+	}
+	query := `
+		SELECT p.post_ID, ` + selected + `
+		FROM posts AS p
+		INNER JOIN users AS u ON p.user_ID = u.user_ID
+		WHERE p.hidden_at IS NULL` + condition
+	if opts.After != "" {
+		var afterKey interface{} = after.Key
+		if countSort(opts.Sort) {
+			afterKey, _ = strconv.Atoi(after.Key)
+		}
+		query += " AND (" + key + " " + beyond + " ? OR (" + key + " = ? AND p.post_ID " + beyond + " ?))"
+		args = append(args, afterKey, afterKey, after.PostID)
+	}
+	query += " ORDER BY " + key + " " + direction + ", p.post_ID " + direction
+	if opts.Limit > 0 {
+		// One more than asked tells whether there is a next page
+		query += " LIMIT ?"
+		args = append(args, opts.Limit+1)
+	}
+
+	rows, err := s.Query(query, args...)
+	if err != nil {
+		return PostPage{}, err
+	}
+	var postIDs []int
+	var keys []string
+	for rows.Next() {
+		var postID int
+		var key string
+		if err := rows.Scan(&postID, &key); err != nil {
+			rows.Close()
+			return PostPage{}, err
+		}
+		postIDs = append(postIDs, postID)
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return PostPage{}, err
+	}
+
+	var page PostPage
+	if opts.Limit > 0 && len(postIDs) > opts.Limit {
+		postIDs = postIDs[:opts.Limit]
+		page.NextCursor = cursor{Sort: opts.Sort, Key: keys[opts.Limit-1], PostID: postIDs[opts.Limit-1]}.String()
+	}
+	page.Posts, err = s.GetPostsByID(postIDs)
+	return page, err
+}
+
+func (s *SQLStore) GetPostsByID(postIDs []int) ([]Post, error) {
+	if len(postIDs) == 0 {
+		return nil, nil
+	}
+	placeholders, args := inList(postIDs)
+	posts, err := s.queryPosts(selectPosts+"WHERE p.post_ID IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[int]Post{}
+	for _, post := range posts {
+		byID[post.PostID] = post
+	}
+	ordered := make([]Post, 0, len(postIDs))
+	for _, postID := range postIDs {
+		if post, ok := byID[postID]; ok && !post.Hidden {
+			ordered = append(ordered, post)
+		}
+	}
+	return ordered, nil
+}
+
+func (s *SQLStore) GetPostActivity(since time.Time) ([]PostActivity, error) {
+	visibleComments := "FROM comments AS c WHERE c.post_ID = p.post_ID AND c.deleted_at IS NULL AND c.hidden_at IS NULL"
+	rows, err := s.Query(`
+		SELECT p.post_ID, `+s.timestampText("p.created_at")+`,
+			(SELECT COUNT(*) FROM likes AS l WHERE l.post_ID = p.post_ID AND l.type = 0),
+			(SELECT COUNT(*) FROM likes AS l WHERE l.post_ID = p.post_ID AND l.type = 1),
+			(SELECT COUNT(*) `+visibleComments+`),
+			(SELECT COUNT(*) `+visibleComments+` AND c.created_at >= ?)
+		FROM posts AS p
+		WHERE p.hidden_at IS NULL`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []PostActivity
+	for rows.Next() {
+		var a PostActivity
+		var createdAt string
+		if err := rows.Scan(&a.PostID, &createdAt, &a.Likes, &a.Dislikes, &a.Comments, &a.RecentComments); err != nil {
+			return nil, err
+		}
+		if a.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+			return nil, err
+		}
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+// timestampText selects a timestamp column as the text it holds. On SQLite
+// the driver would otherwise parse it into a time.Time, which formats
+// differently from the stored text and is the zero time for values it
+// cannot parse, like the demo data's.
+func (s *SQLStore) timestampText(column string) string {
+	if s.dialect == database.SQLite {
+		return "CAST(" + column + " AS TEXT)"
+	}
+	return column
+}
+
+// parseTimestamp reads a timestamp in any of the forms the rows hold: the
+// drivers' own, Go's and the demo data's.
+func parseTimestamp(value string) (time.Time, error) {
+	layouts := []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05 MST", "2006-01-02 15:04:05"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown timestamp format %q", value)
+}
+
+// queryPosts runs a query selecting the columns of selectPosts and fills in
+// the categories of the posts it returns with one more query.
+func (s *SQLStore) queryPosts(query string, args ...interface{}) ([]Post, error) {
+	rows, err := s.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var posts []Post
+	for rows.Next() {
+		var post Post
+		var updatedAt, hiddenAt sql.NullString
+		err := rows.Scan(&post.PostID, &post.Username, &post.Title, &post.Content, &post.CreatedAt, &updatedAt, &hiddenAt,
+			&post.Likes, &post.Dislikes, &post.CommentCount)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		post.UpdatedAt = updatedAt.String
+		post.Hidden = hiddenAt.Valid
+		posts = append(posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	postIDs := make([]int, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.PostID
+	}
+	categories, err := s.getCategoriesForPosts(postIDs)
+	if err != nil {
+		return nil, err
+	}
+	reactions, err := s.reactionCounts(TargetPost, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].Categories = categories[posts[i].PostID]
+		posts[i].PostCategory = joinCategories(posts[i].Categories)
+		posts[i].Reactions = reactions[posts[i].PostID]
+	}
+	return posts, nil
+}
+
+func joinCategories(categories []Category) string {
+	names := make([]string, len(categories))
+	for i, category := range categories {
+		names[i] = category.Category
+	}
+	return strings.Join(names, " ")
+}
+
+func (s *SQLStore) AddPost(userID int, title, content string, categories []string) (int, error) {
+	tx, c, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	insertQuery := "INSERT INTO posts (user_ID, title, content, created_at) VALUES (?, ?, ?, ?)"
+	postID, err := c.Insert(insertQuery, "post_ID", userID, title, content, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, category := range categories {
+		insertCategoryQuery := "INSERT INTO post_categories (post_ID, category_ID) VALUES (?, (SELECT category_ID FROM categories WHERE category = ?))"
+		if _, err := c.Exec(insertCategoryQuery, postID, category); err != nil {
+			return 0, err
+		}
+	}
+	return postID, tx.Commit()
+}
+
+func (s *SQLStore) UpdatePost(postID, editorID int, title, content string, categories []string) error {
+	tx, c, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldTitle, oldContent string
+	err = c.QueryRow("SELECT title, content FROM posts WHERE post_ID = ?", postID).Scan(&oldTitle, &oldContent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	// Keep the version being replaced, categories included
+	revisionQuery := "INSERT INTO post_revisions (post_ID, editor_ID, title, content, created_at) VALUES (?, ?, ?, ?, ?)"
+	revisionID, err := c.Insert(revisionQuery, "revision_ID", postID, editorID, oldTitle, oldContent, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	_, err = c.Exec("INSERT INTO post_revision_categories (revision_ID, category_ID) SELECT ?, category_ID FROM post_categories WHERE post_ID = ?", revisionID, postID)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Exec("UPDATE posts SET title = ?, content = ?, updated_at = ? WHERE post_ID = ?", title, content, time.Now().UTC(), postID)
+	if err != nil {
+		return err
+	}
+	if _, err := c.Exec("DELETE FROM post_categories WHERE post_ID = ?", postID); err != nil {
+		return err
+	}
+	for _, category := range categories {
+		insertCategoryQuery := "INSERT INTO post_categories (post_ID, category_ID) VALUES (?, (SELECT category_ID FROM categories WHERE category = ?))"
+		if _, err := c.Exec(insertCategoryQuery, postID, category); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeletePost(postID int) error {
+	tx, c, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Children first, so foreign keys never point at a missing row
+	queries := []string{
+		"DELETE FROM likes WHERE comment_ID IN (SELECT comment_ID FROM comments WHERE post_ID = ?)",
+		"DELETE FROM likes WHERE post_ID = ?",
+		"DELETE FROM reports WHERE comment_ID IN (SELECT comment_ID FROM comments WHERE post_ID = ?)",
+		"DELETE FROM reports WHERE post_ID = ?",
+		"DELETE FROM comments WHERE post_ID = ?",
+		"DELETE FROM post_categories WHERE post_ID = ?",
+		"DELETE FROM post_revision_categories WHERE revision_ID IN (SELECT revision_ID FROM post_revisions WHERE post_ID = ?)",
+		"DELETE FROM post_revisions WHERE post_ID = ?",
+	}
+	for _, query := range queries {
+		if _, err := c.Exec(query, postID); err != nil {
+			return err
+		}
+	}
+	result, err := c.Exec("DELETE FROM posts WHERE post_ID = ?", postID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetPostRevisions(postID int) ([]PostRevision, error) {
+	query := `
+		SELECT r.revision_ID, r.post_ID, u.username, r.title, r.content, r.created_at
+		FROM post_revisions AS r
+		INNER JOIN users AS u ON r.editor_ID = u.user_ID
+		WHERE r.post_ID = ?
+		ORDER BY r.revision_ID
+	`
+	rows, err := s.Query(query, postID)
+	if err != nil {
+		return nil, err
+	}
+	var revisions []PostRevision
+	for rows.Next() {
+		var revision PostRevision
+		err := rows.Scan(&revision.RevisionID, &revision.PostID, &revision.Editor, &revision.Title, &revision.Content, &revision.EditedAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The categories of every revision come back in one query rather
+	// than one per revision.
+	rows, err = s.Query(`
+		SELECT rc.revision_ID, c.category_ID, c.category
+		FROM categories AS c
+		INNER JOIN post_revision_categories AS rc ON c.category_ID = rc.category_ID
+		INNER JOIN post_revisions AS r ON rc.revision_ID = r.revision_ID
+		WHERE r.post_ID = ?
+		ORDER BY c.category_ID
+	`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byRevision := map[int][]Category{}
+	for rows.Next() {
+		var revisionID int
+		var category Category
+		if err := rows.Scan(&revisionID, &category.CategoryID, &category.Category); err != nil {
+			return nil, err
+		}
+		byRevision[revisionID] = append(byRevision[revisionID], category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range revisions {
+		revision := &revisions[i]
+		revision.Categories = byRevision[revision.RevisionID]
+		revision.PostCategory = joinCategories(revision.Categories)
+	}
+	return revisions, nil
+}
+
+// COMMENTS
+const commentColumns = `com.comment_ID, com.post_ID, COALESCE(com.parent_comment_ID, 0), u.username, com.content,
+	com.created_at, com.updated_at, com.deleted_at, com.hidden_at`
+
+func (s *SQLStore) GetComment(commentID int) (Comment, error) {
+	query := `
+		SELECT ` + commentColumns + `
+		FROM comments AS com
+		INNER JOIN users AS u ON com.user_ID = u.user_ID
+		WHERE com.comment_ID = ?
+	`
+	var comment Comment
+	var updatedAt, deletedAt, hiddenAt sql.NullString
+	err := s.QueryRow(query, commentID).Scan(&comment.CommentID, &comment.PostID, &comment.ParentID, &comment.Username,
+		&comment.Content, &comment.CreatedAt, &updatedAt, &deletedAt, &hiddenAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Comment{}, ErrNotFound
+	} else if err != nil {
+		return Comment{}, err
+	}
+	comment.UpdatedAt = updatedAt.String
+	comment.Deleted = deletedAt.Valid
+	comment.Hidden = hiddenAt.Valid
+	return comment, nil
+}
+
+func (s *SQLStore) UpdateComment(commentID int, content string) error {
+	result, err := s.Exec("UPDATE comments SET content = ?, updated_at = ? WHERE comment_ID = ? AND deleted_at IS NULL", content, time.Now().UTC(), commentID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteComment(commentID int) error {
+	result, err := s.Exec("UPDATE comments SET content = '', deleted_at = ? WHERE comment_ID = ? AND deleted_at IS NULL", time.Now().UTC(), commentID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) GetCommentsForPost(postID, rootID, maxDepth int) ([]Comment, error) {
+	// Walk down the reply chains from the roots, one level per step,
+	// stopping at the depth limit
+	rootCondition := "post_ID = ? AND parent_comment_ID IS NULL"
+	args := []interface{}{postID}
+	if rootID != 0 {
+		rootCondition = "post_ID = ? AND comment_ID = ?"
+		args = append(args, rootID)
+	}
+	args = append(args, maxDepth)
+	query := `
+		WITH RECURSIVE thread (comment_ID, depth) AS (
+			SELECT comment_ID, 0 FROM comments WHERE ` + rootCondition + `
+			UNION ALL
+			SELECT c.comment_ID, t.depth + 1
+			FROM comments AS c
+			INNER JOIN thread AS t ON c.parent_comment_ID = t.comment_ID
+			WHERE t.depth + 1 < ?
+		)
+		SELECT ` + commentColumns + `, t.depth,
+			com.comment_count, com.like_count, com.dislike_count
+		FROM thread AS t
+		INNER JOIN comments AS com ON com.comment_ID = t.comment_ID
+		INNER JOIN users AS u ON com.user_ID = u.user_ID
+		ORDER BY com.comment_ID
+	`
+	rows, err := s.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var comments []Comment
+	for rows.Next() {
+		var comment Comment
+		var updatedAt, deletedAt, hiddenAt sql.NullString
+		err := rows.Scan(&comment.CommentID, &comment.PostID, &comment.ParentID, &comment.Username, &comment.Content,
+			&comment.CreatedAt, &updatedAt, &deletedAt, &hiddenAt, &comment.Depth, &comment.ReplyCount,
+			&comment.Likes, &comment.Dislikes)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		comment.UpdatedAt = updatedAt.String
+		comment.Deleted = deletedAt.Valid
+		comment.Hidden = hiddenAt.Valid
+		comments = append(comments, comment)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	commentIDs := make([]int, len(comments))
+	for i, comment := range comments {
+		commentIDs[i] = comment.CommentID
+	}
+	reactions, err := s.reactionCounts(TargetComment, commentIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range comments {
+		comments[i].Reactions = reactions[comments[i].CommentID]
+	}
+	return buildCommentTree(comments), nil
+}
+
+func (s *SQLStore) AddComment(postID, userID, parentID int, content string) (int, error) {
+	tx, c, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := c.checkTarget(TargetPost, postID); err != nil {
+		return 0, err
+	}
+	var commentID int
+	if parentID != 0 {
+		if err := c.checkTarget(TargetComment, parentID); err != nil {
+			return 0, err
+		}
+		var parentPostID int
+		err := c.QueryRow("SELECT post_ID FROM comments WHERE comment_ID = ?", parentID).Scan(&parentPostID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && parentPostID != postID) {
+			return 0, ErrNotFound
+		} else if err != nil {
+			return 0, err
+		}
+		commentID, err = c.Insert("INSERT INTO comments (post_ID, user_ID, parent_comment_ID, content, created_at) VALUES (?, ?, ?, ?, ?)", "comment_ID", postID, userID, parentID, content, time.Now().UTC())
+		if err != nil {
+			return 0, err
+		}
+		if _, err := c.Exec("UPDATE comments SET comment_count = comment_count + 1 WHERE comment_ID = ?", parentID); err != nil {
+			return 0, err
+		}
+	} else {
+		commentID, err = c.Insert("INSERT INTO comments (post_ID, user_ID, content, created_at) VALUES (?, ?, ?, ?)", "comment_ID", postID, userID, content, time.Now().UTC())
+		if err != nil {
+			return 0, err
+		}
+	}
+	if _, err := c.Exec("UPDATE posts SET comment_count = comment_count + 1 WHERE post_ID = ?", postID); err != nil {
+		return 0, err
+	}
+	return commentID, tx.Commit()
+}
+
+// USERS
+func (s *SQLStore) GetUserByUsername(username string) (User, error) {
+	var user User
+	var email sql.NullString
+	query := "SELECT user_ID, email, username, password, role, created_at, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL FROM users WHERE username = ? LIMIT 1"
+	err := s.QueryRow(query, username).Scan(&user.UserID, &email, &user.Username, &user.Password, &user.Role, &user.CreatedAt, &user.EmailVerified, &user.TwoFactor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	user.Email = email.String
+	return user, err
+}
+
+func (s *SQLStore) GetUserByEmail(email string) (User, error) {
+	var user User
+	var storedEmail sql.NullString
+	query := "SELECT user_ID, email, username, password, role, created_at, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL FROM users WHERE LOWER(email) = LOWER(?) LIMIT 1"
+	err := s.QueryRow(query, email).Scan(&user.UserID, &storedEmail, &user.Username, &user.Password, &user.Role, &user.CreatedAt, &user.EmailVerified, &user.TwoFactor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	user.Email = storedEmail.String
+	return user, err
+}
+
+func (s *SQLStore) UserExists(email, username string) (bool, error) {
+	var existingUser int
+	query := "SELECT COUNT(*) FROM users WHERE LOWER(email) = LOWER(?) OR LOWER(username) = LOWER(?)"
+	if err := s.QueryRow(query, email, username).Scan(&existingUser); err != nil {
+		return false, err
+	}
+	return existingUser > 0, nil
+}
+
+func (s *SQLStore) AddUser(email, username string, password []byte) (int, error) {
+	query := "INSERT INTO users (email, username, password, created_at) VALUES (?, ?, ?, ?)"
+	return s.Insert(query, "user_ID", email, username, string(password), time.Now().UTC())
+}
+
+func (s *SQLStore) SetUserRole(username, role string) error {
+	result, err := s.Exec("UPDATE users SET role = ? WHERE username = ?", role, username)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) VerifyEmail(userID int) error {
+	// A second visit of the link keeps the time of the first
+	query := "UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE user_ID = ?"
+	result, err := s.Exec(query, time.Now().Unix(), userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) ClaimEmail(userID int, kind string, since time.Time) (bool, error) {
+	column, err := emailColumn(kind)
+	if err != nil {
+		return false, err
+	}
+	// A single statement, so two requests at once cannot both claim it
+	query := `
+		UPDATE users SET ` + column + ` = ?
+		WHERE user_ID = ? AND (` + column + ` IS NULL OR ` + column + ` <= ?)
+	`
+	result, err := s.Exec(query, time.Now().Unix(), userID, since.Unix())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLStore) ReleaseEmail(userID int, kind string) error {
+	column, err := emailColumn(kind)
+	if err != nil {
+		return err
+	}
+	_, err = s.Exec(`UPDATE users SET `+column+` = NULL WHERE user_ID = ?`, userID)
+	return err
+}
+
+// SESSIONS
+func (s *SQLStore) CreateSession(tokenHash string, session Session) (int, error) {
+	query := `
+		INSERT INTO sessions (token_hash, user_ID, user_agent, ip, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	return s.Insert(query, "session_ID", tokenHash, session.UserID, session.UserAgent, session.IP,
+		session.CreatedAt.Unix(), session.LastSeenAt.Unix(), session.ExpiresAt.Unix())
+}
+
+const selectSessions = `
+	SELECT s.session_ID, s.user_ID, u.username, s.user_agent, s.ip, s.created_at, s.last_seen_at, s.expires_at
+	FROM sessions AS s
+	INNER JOIN users AS u ON s.user_ID = u.user_ID
+`
+
+// scanSession reads the columns of selectSessions from a *sql.Row or
+// *sql.Rows.
+func scanSession(row interface{ Scan(...interface{}) error }) (Session, error) {
+	var session Session
+	var createdAt, lastSeenAt, expiresAt int64
+	err := row.Scan(&session.SessionID, &session.UserID, &session.Username, &session.UserAgent, &session.IP,
+		&createdAt, &lastSeenAt, &expiresAt)
+	if err != nil {
+		return Session{}, err
+	}
+	session.CreatedAt = time.Unix(createdAt, 0)
+	session.LastSeenAt = time.Unix(lastSeenAt, 0)
+	session.ExpiresAt = time.Unix(expiresAt, 0)
+	return session, nil
+}
+
+func (s *SQLStore) GetSession(tokenHash string) (Session, error) {
+	row := s.QueryRow(selectSessions+"WHERE s.token_hash = ? AND s.expires_at > ?", tokenHash, time.Now().Unix())
+	session, err := scanSession(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrNotFound
+	}
+	return session, err
+}
+
+func (s *SQLStore) GetUserSessions(userID int) ([]Session, error) {
+	rows, err := s.Query(selectSessions+"WHERE s.user_ID = ? AND s.expires_at > ? ORDER BY s.last_seen_at DESC, s.session_ID DESC",
+		userID, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLStore) TouchSession(sessionID int, lastSeenAt, expiresAt time.Time) error {
+	_, err := s.Exec("UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE session_ID = ?", lastSeenAt.Unix(), expiresAt.Unix(), sessionID)
+	return err
+}
+
+func (s *SQLStore) DeleteSession(tokenHash string) error {
+	_, err := s.Exec("DELETE FROM sessions WHERE token_hash = ?", tokenHash)
+	return err
+}
+
+func (s *SQLStore) RevokeSession(userID, sessionID int) error {
+	result, err := s.Exec("DELETE FROM sessions WHERE session_ID = ? AND user_ID = ?", sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteExpiredSessions() error {
+	_, err := s.Exec("DELETE FROM sessions WHERE expires_at <= ?", time.Now().Unix())
+	return err
+}
+
+// PASSWORD RESETS
+func (s *SQLStore) AddPasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	query := "INSERT INTO password_resets (user_ID, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?)"
+	_, err := s.Exec(query, userID, tokenHash, time.Now().Unix(), expiresAt.Unix())
+	return err
+}
+
+func (s *SQLStore) GetPasswordReset(tokenHash string) (User, error) {
+	query := `
+		SELECT u.user_ID, u.email, u.username, u.password, u.role, u.created_at, u.email_verified_at IS NOT NULL, u.totp_enabled_at IS NOT NULL
+		FROM password_resets AS p
+		INNER JOIN users AS u ON p.user_ID = u.user_ID
+		WHERE p.token_hash = ? AND p.used_at IS NULL AND p.expires_at > ?
+	`
+	var user User
+	var email sql.NullString
+	err := s.QueryRow(query, tokenHash, time.Now().Unix()).Scan(&user.UserID, &email, &user.Username, &user.Password, &user.Role, &user.CreatedAt, &user.EmailVerified, &user.TwoFactor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	user.Email = email.String
+	return user, err
+}
+
+func (s *SQLStore) ResetPassword(tokenHash string, password []byte) error {
+	tx, c, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	var userID int
+	query := "SELECT user_ID FROM password_resets WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?"
+	err = c.QueryRow(query, tokenHash, now).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	// Claiming the reset and checking it was still unused keeps two
+	// concurrent uses from both succeeding
+	result, err := c.Exec("UPDATE password_resets SET used_at = ? WHERE token_hash = ? AND used_at IS NULL", now, tokenHash)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	if _, err := c.Exec("UPDATE password_resets SET used_at = ? WHERE user_ID = ? AND used_at IS NULL", now, userID); err != nil {
+		return err
+	}
+	if _, err := c.Exec("UPDATE users SET password = ? WHERE user_ID = ?", string(password), userID); err != nil {
+		return err
+	}
+	if _, err := c.Exec("DELETE FROM sessions WHERE user_ID = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TWO-FACTOR AUTHENTICATION
+func (s *SQLStore) GetTOTPSecret(userID int) (string, error) {
+	var secret sql.NullString
+	err := s.QueryRow("SELECT totp_secret FROM users WHERE user_ID = ?", userID).Scan(&secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return secret.String, err
+}
+
+func (s *SQLStore) SetTOTPSecret(userID int, secret string) error {
+	result, err := s.Exec("UPDATE users SET totp_secret = ? WHERE user_ID = ? AND totp_enabled_at IS NULL", secret, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error {
+	tx, c, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE users SET totp_enabled_at = ?, totp_last_step = ? WHERE user_ID = ? AND totp_secret IS NOT NULL"
+	result, err := c.Exec(query, time.Now().Unix(), step, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	if err := replaceRecoveryCodes(c, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) DisableTOTP(userID int) error {
+	tx, c, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE user_ID = ?"
+	if _, err := c.Exec(query, userID); err != nil {
+		return err
+	}
+	if _, err := c.Exec("DELETE FROM recovery_codes WHERE user_ID = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	// A single statement, so a code cannot be used twice at once
+	query := "UPDATE users SET totp_last_step = ? WHERE user_ID = ? AND (totp_last_step IS NULL OR totp_last_step < ?)"
+	result, err := s.Exec(query, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLStore) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, c, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(c, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(c conn, userID int, codeHashes []string) error {
+	if _, err := c.Exec("DELETE FROM recovery_codes WHERE user_ID = ?", userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := c.Exec("INSERT INTO recovery_codes (user_ID, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := "UPDATE recovery_codes SET used_at = ? WHERE user_ID = ? AND code_hash = ? AND used_at IS NULL"
+	result, err := s.Exec(query, time.Now().Unix(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLStore) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := s.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_ID = ? AND used_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+func (s *SQLStore) FailSecondFactor(userID, maxFailures int, lockUntil time.Time) (bool, error) {
+	tx, c, err := s.begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Updating first locks the row, so two wrong codes at once both count
+	if _, err := c.Exec("UPDATE users SET totp_failures = totp_failures + 1 WHERE user_ID = ?", userID); err != nil {
+		return false, err
+	}
+	var failures int
+	err = c.QueryRow("SELECT totp_failures FROM users WHERE user_ID = ?", userID).Scan(&failures)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	} else if err != nil {
+		return false, err
+	}
+	if failures < maxFailures {
+		return false, tx.Commit()
+	}
+	_, err = c.Exec("UPDATE users SET totp_failures = 0, totp_locked_until = ? WHERE user_ID = ?", lockUntil.Unix(), userID)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *SQLStore) GetSecondFactorLock(userID int) (time.Time, error) {
+	var lockedUntil sql.NullInt64
+	err := s.QueryRow("SELECT totp_locked_until FROM users WHERE user_ID = ?", userID).Scan(&lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrNotFound
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	if !lockedUntil.Valid || lockedUntil.Int64 <= time.Now().Unix() {
+		return time.Time{}, nil
+	}
+	return time.Unix(lockedUntil.Int64, 0), nil
+}
+
+func (s *SQLStore) ResetSecondFactorFailures(userID int) error {
+	_, err := s.Exec("UPDATE users SET totp_failures = 0 WHERE user_ID = ?", userID)
+	return err
+}
+
+func (s *SQLStore) AddLoginChallenge(userID int, tokenHash string, expiresAt time.Time) error {
+	query := "INSERT INTO login_challenges (user_ID, token_hash, expires_at) VALUES (?, ?, ?)"
+	_, err := s.Exec(query, userID, tokenHash, expiresAt.Unix())
+	return err
+}
+
+func (s *SQLStore) GetLoginChallenge(tokenHash string) (int, error) {
+	var userID int
+	query := "SELECT user_ID FROM login_challenges WHERE token_hash = ? AND expires_at > ?"
+	err := s.QueryRow(query, tokenHash, time.Now().Unix()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return userID, err
+}
+
+func (s *SQLStore) FailLoginChallenge(tokenHash string, maxAttempts int) (bool, error) {
+	tx, c, err := s.begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = ? AND expires_at > ?"
+	result, err := c.Exec(query, tokenHash, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	result, err = c.Exec("DELETE FROM login_challenges WHERE token_hash = ? AND attempts >= ?", tokenHash, maxAttempts)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 0, tx.Commit()
+}
+
+func (s *SQLStore) DeleteLoginChallenge(tokenHash string) error {
+	_, err := s.Exec("DELETE FROM login_challenges WHERE token_hash = ? OR expires_at <= ?", tokenHash, time.Now().Unix())
+	return err
+}
+
+// SETTINGS
+func (s *SQLStore) GetSetting(name string) (string, error) {
+	var value string
+	err := s.QueryRow("SELECT value FROM settings WHERE name = ?", name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+func (s *SQLStore) SetSetting(name, value string) error {
+	query := "INSERT INTO settings (name, value) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET value = excluded.value"
+	_, err := s.Exec(query, name, value)
+	return err
+}
+
+// API TOKENS
+func (s *SQLStore) AddAPIToken(userID int, name, hash string, scopes []string) (int, error) {
+	query := "INSERT INTO api_tokens (user_ID, name, token_hash, scopes, created_at) VALUES (?, ?, ?, ?, ?)"
+	return s.Insert(query, "token_ID", userID, name, hash, strings.Join(scopes, ","), time.Now().UTC())
+}
+
+func (s *SQLStore) GetAPITokens(userID int) ([]APIToken, error) {
+	query := `
+		SELECT token_ID, name, scopes, created_at, last_used_at
+		FROM api_tokens
+		WHERE user_ID = ? AND revoked_at IS NULL
+		ORDER BY token_ID DESC
+	`
+	rows, err := s.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var token APIToken
+		var scopes string
+		var lastUsedAt sql.NullString
+		if err := rows.Scan(&token.TokenID, &token.Name, &scopes, &token.CreatedAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		token.Scopes = strings.Split(scopes, ",")
+		token.LastUsedAt = lastUsedAt.String
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *SQLStore) RevokeAPIToken(userID, tokenID int) error {
+	result, err := s.Exec("UPDATE api_tokens SET revoked_at = ? WHERE token_ID = ? AND user_ID = ? AND revoked_at IS NULL", time.Now().UTC(), tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) UseAPIToken(hash string) (User, APIToken, error) {
+	query := `
+		SELECT u.user_ID, u.email, u.username, u.password, u.role, u.created_at, u.email_verified_at IS NOT NULL, u.totp_enabled_at IS NOT NULL,
+			t.token_ID, t.name, t.scopes, t.created_at
+		FROM api_tokens AS t
+		INNER JOIN users AS u ON t.user_ID = u.user_ID
+		WHERE t.token_hash = ? AND t.revoked_at IS NULL
+	`
+	var user User
+	var token APIToken
+	var email sql.NullString
+	var scopes string
+	err := s.QueryRow(query, hash).Scan(&user.UserID, &email, &user.Username, &user.Password, &user.Role, &user.CreatedAt, &user.EmailVerified, &user.TwoFactor,
+		&token.TokenID, &token.Name, &scopes, &token.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, APIToken{}, ErrNotFound
+	} else if err != nil {
+		return User{}, APIToken{}, err
+	}
+	user.Email = email.String
+	token.Scopes = strings.Split(scopes, ",")
+
+	now := time.Now().UTC()
+	if _, err := s.Exec("UPDATE api_tokens SET last_used_at = ? WHERE token_ID = ?", now, token.TokenID); err != nil {
+		return User{}, APIToken{}, err
+	}
+	token.LastUsedAt = now.Format(time.RFC3339)
+	return user, token, nil
+}
+
+// REACTIONS
+func (s *SQLStore) SetReaction(userID int, targetType string, targetID, reactionType int) error {
+	targetColumn, err := targetColumn(targetType)
+	if err != nil {
+		return err
+	}
+	tx, c, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var enabled int
+	err = c.QueryRow("SELECT COUNT(*) FROM reaction_types WHERE type = ? AND disabled_at IS NULL", reactionType).Scan(&enabled)
+	if err != nil {
+		return err
+	}
+	if enabled == 0 {
+		return ErrNotFound
+	}
+	if err := c.checkTarget(targetType, targetID); err != nil {
+		return err
+	}
+
+	// Insert the reaction unless the user already has one on this target.
+	// When another request is adding one at the same time, the insert
+	// waits for it and does nothing, and the reaction it added is then
+	// read below instead of failing on the unique index.
+	var existingReactionType int
+	for {
+		result, err := c.Exec("INSERT INTO likes ("+targetColumn+", user_ID, type, created_at) VALUES (?, ?, ?, ?)"+
+			" ON CONFLICT (user_ID, "+targetColumn+") WHERE "+targetColumn+" IS NOT NULL DO NOTHING",
+			targetID, userID, reactionType, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 1 {
+			if err := c.addToCount(targetType, targetID, reactionType, 1); err != nil {
+				return err
+			}
+			return tx.Commit()
+		}
+		err = c.QueryRow("SELECT type FROM likes WHERE "+targetColumn+" = ? AND user_ID = ?", targetID, userID).Scan(&existingReactionType)
+		if err == nil {
+			break
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		// The reaction was taken back in between, so try adding it again
+	}
+	if existingReactionType == reactionType {
+		// The same reaction again takes it back
+		_, err = c.Exec("DELETE FROM likes WHERE "+targetColumn+" = ? AND user_ID = ?", targetID, userID)
+		if err != nil {
+			return err
+		}
+		if err := c.addToCount(targetType, targetID, reactionType, -1); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	// User has already reacted, update the reaction type
+	_, err = c.Exec("UPDATE likes SET type = ? WHERE "+targetColumn+" = ? AND user_ID = ?", reactionType, targetID, userID)
+	if err != nil {
+		return err
+	}
+	if err := c.addToCount(targetType, targetID, existingReactionType, -1); err != nil {
+		return err
+	}
+	if err := c.addToCount(targetType, targetID, reactionType, 1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetUserReactions(userID int, targetType string, targetIDs []int) (map[int]int, error) {
+	targetColumn, err := targetColumn(targetType)
+	if err != nil {
+		return nil, err
+	}
+	reactions := map[int]int{}
+	if userID == 0 || len(targetIDs) == 0 {
+		return reactions, nil
+	}
+	placeholders, args := inList(targetIDs)
+	rows, err := s.Query("SELECT "+targetColumn+", type FROM likes WHERE user_ID = ? AND "+targetColumn+" IN ("+placeholders+")",
+		append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var targetID, reactionType int
+		if err := rows.Scan(&targetID, &reactionType); err != nil {
+			return nil, err
+		}
+		reactions[targetID] = reactionType
+	}
+	return reactions, rows.Err()
+}
+
+// checkTarget returns ErrNotFound unless the post, or the comment and its
+// post, exists and is neither hidden nor deleted, so nothing is added to
+// what readers cannot see.
+func (c conn) checkTarget(targetType string, targetID int) error {
+	query := "SELECT COUNT(*) FROM posts WHERE post_ID = ? AND hidden_at IS NULL"
+	if targetType == TargetComment {
+		query = `
+			SELECT COUNT(*)
+			FROM comments AS com
+			INNER JOIN posts AS p ON com.post_ID = p.post_ID
+			WHERE com.comment_ID = ? AND com.deleted_at IS NULL AND com.hidden_at IS NULL AND p.hidden_at IS NULL
+		`
+	}
+	var found int
+	if err := c.QueryRow(query, targetID).Scan(&found); err != nil {
+		return err
+	}
+	if found == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// addToCount adds delta to the stored count of reactionType reactions to a
+// post or comment. Only likes and dislikes are stored; the other types are
+// counted when they are read.
+func (c conn) addToCount(targetType string, targetID, reactionType, delta int) error {
+	var countColumn string
+	switch reactionType {
+	case Like:
+		countColumn = "like_count"
+	case Dislike:
+		countColumn = "dislike_count"
+	default:
+		return nil
+	}
+	targetColumn, err := targetColumn(targetType)
+	if err != nil {
+		return err
+	}
+	query := "UPDATE " + targetTable(targetType) + " SET " + countColumn + " = " + countColumn + " + ? WHERE " + targetColumn + " = ?"
+	_, err = c.Exec(query, delta, targetID)
+	return err
+}
+
+// reactionCounts returns the reaction counts of each of the posts or
+// comments, with every enabled type present, in two queries.
+func (s *SQLStore) GetReactionCounts(targetType string, targetIDs []int) (map[int][]ReactionCount, error) {
+	return s.reactionCounts(targetType, targetIDs)
+}
+
+func (s *SQLStore) reactionCounts(targetType string, targetIDs []int) (map[int][]ReactionCount, error) {
+	targetColumn, err := targetColumn(targetType)
+	if err != nil {
+		return nil, err
+	}
+	byTarget := map[int][]ReactionCount{}
+	if len(targetIDs) == 0 {
+		return byTarget, nil
+	}
+	types, err := s.queryReactionTypes(selectReactionTypes + "WHERE disabled_at IS NULL ORDER BY sort_order, type")
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders, args := inList(targetIDs)
+	rows, err := s.Query("SELECT "+targetColumn+", type, COUNT(*) FROM likes WHERE "+targetColumn+" IN ("+placeholders+") GROUP BY "+targetColumn+", type", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[[2]int]int{}
+	for rows.Next() {
+		var targetID, reactionType, count int
+		if err := rows.Scan(&targetID, &reactionType, &count); err != nil {
+			return nil, err
+		}
+		counts[[2]int{targetID, reactionType}] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, targetID := range targetIDs {
+		reactions := make([]ReactionCount, len(types))
+		for i, reactionType := range types {
+			reactions[i] = ReactionCount{ReactionType: reactionType, Count: counts[[2]int{targetID, reactionType.Type}]}
+		}
+		byTarget[targetID] = reactions
+	}
+	return byTarget, nil
+}
+
+func (s *SQLStore) GetReactors(targetType string, targetID int) ([]Reactor, error) {
+	targetColumn, err := targetColumn(targetType)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.Query(`
+		SELECT u.username, l.type, `+s.timestampText("l.created_at")+`
+		FROM likes AS l
+		INNER JOIN users AS u ON l.user_ID = u.user_ID
+		INNER JOIN reaction_types AS rt ON l.type = rt.type
+		WHERE l.`+targetColumn+` = ? AND rt.disabled_at IS NULL
+		ORDER BY rt.sort_order, rt.type, l.created_at, l.like_ID
+	`, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactors []Reactor
+	for rows.Next() {
+		var reactor Reactor
+		var createdAt sql.NullString
+		if err := rows.Scan(&reactor.Username, &reactor.Type, &createdAt); err != nil {
+			return nil, err
+		}
+		reactor.CreatedAt = createdAt.String
+		reactors = append(reactors, reactor)
+	}
+	return reactors, rows.Err()
+}
+
+const selectReactionTypes = "SELECT type, name, emoji, sort_order, disabled_at FROM reaction_types "
+
+func (s *SQLStore) GetReactionTypes() ([]ReactionType, error) {
+	return s.queryReactionTypes(selectReactionTypes + "ORDER BY sort_order, type")
+}
+
+func (s *SQLStore) queryReactionTypes(query string, args ...interface{}) ([]ReactionType, error) {
+	rows, err := s.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []ReactionType
+	for rows.Next() {
+		var reactionType ReactionType
+		var disabledAt sql.NullString
+		if err := rows.Scan(&reactionType.Type, &reactionType.Name, &reactionType.Emoji, &reactionType.SortOrder, &disabledAt); err != nil {
+			return nil, err
+		}
+		reactionType.Enabled = !disabledAt.Valid
+		types = append(types, reactionType)
+	}
+	return types, rows.Err()
+}
+
+func (s *SQLStore) AddReactionType(name, emoji string) (int, error) {
+	tx, c, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var taken int
+	if err := c.QueryRow("SELECT COUNT(*) FROM reaction_types WHERE name = ?", name).Scan(&taken); err != nil {
+		return 0, err
+	}
+	if taken > 0 {
+		return 0, ErrDuplicate
+	}
+	// Types are never reused, so old reactions cannot turn into new ones
+	var reactionType, sortOrder int
+	err = c.QueryRow("SELECT COALESCE(MAX(type), -1) + 1, COALESCE(MAX(sort_order), -1) + 1 FROM reaction_types").Scan(&reactionType, &sortOrder)
+	if err != nil {
+		return 0, err
+	}
+	_, err = c.Exec("INSERT INTO reaction_types (type, name, emoji, sort_order) VALUES (?, ?, ?, ?)", reactionType, name, emoji, sortOrder)
+	if err != nil {
+		return 0, err
+	}
+	return reactionType, tx.Commit()
+}
+
+func (s *SQLStore) SetReactionTypeEnabled(name string, enabled bool) error {
+	var disabledAt interface{}
+	if !enabled {
+		disabledAt = time.Now().UTC()
+	}
+	result, err := s.Exec("UPDATE reaction_types SET disabled_at = ? WHERE name = ?", disabledAt, name)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// recountQueries set every stored count to the one computed from the likes
+// and comments tables, changing only the rows where they differ.
+var recountQueries = []string{`
+	UPDATE posts SET like_count = l.likes, dislike_count = l.dislikes, comment_count = l.comments
+	FROM (SELECT p.post_ID,
+			(SELECT COUNT(*) FROM likes WHERE likes.post_ID = p.post_ID AND likes.type = 0) AS likes,
+			(SELECT COUNT(*) FROM likes WHERE likes.post_ID = p.post_ID AND likes.type = 1) AS dislikes,
+			(SELECT COUNT(*) FROM comments WHERE comments.post_ID = p.post_ID) AS comments
+		FROM posts AS p) AS l
+	WHERE posts.post_ID = l.post_ID
+		AND (posts.like_count <> l.likes OR posts.dislike_count <> l.dislikes OR posts.comment_count <> l.comments)`, `
+	UPDATE comments SET like_count = l.likes, dislike_count = l.dislikes, comment_count = l.replies
+	FROM (SELECT c.comment_ID,
+			(SELECT COUNT(*) FROM likes WHERE likes.comment_ID = c.comment_ID AND likes.type = 0) AS likes,
+			(SELECT COUNT(*) FROM likes WHERE likes.comment_ID = c.comment_ID AND likes.type = 1) AS dislikes,
+			(SELECT COUNT(*) FROM comments AS r WHERE r.parent_comment_ID = c.comment_ID) AS replies
+		FROM comments AS c) AS l
+	WHERE comments.comment_ID = l.comment_ID
+		AND (comments.like_count <> l.likes OR comments.dislike_count <> l.dislikes OR comments.comment_count <> l.replies)`,
+}
+
+func (s *SQLStore) Recount() (posts, comments int, err error) {
+	tx, c, err := s.begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var fixed [2]int
+	for i, query := range recountQueries {
+		result, err := c.Exec(query)
+		if err != nil {
+			return 0, 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, 0, err
+		}
+		fixed[i] = int(n)
+	}
+	return fixed[0], fixed[1], tx.Commit()
+}
+
+// REPORTS
+func (s *SQLStore) AddReport(reporterID int, targetType string, targetID int, reason string) error {
+	targetColumn, err := targetColumn(targetType)
+	if err != nil {
+		return err
+	}
+
+	var exists int
+	err = s.QueryRow("SELECT COUNT(*) FROM "+targetTable(targetType)+" WHERE "+targetColumn+" = ?", targetID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrNotFound
+	}
+
+	var alreadyReported int
+	query := "SELECT COUNT(*) FROM reports WHERE " + targetColumn + " = ? AND reporter_ID = ? AND status = ?"
+	if err := s.QueryRow(query, targetID, reporterID, ReportOpen).Scan(&alreadyReported); err != nil {
+		return err
+	}
+	if alreadyReported > 0 {
+		return nil
+	}
+
+	_, err = s.Exec("INSERT INTO reports ("+targetColumn+", reporter_ID, reason, status, created_at) VALUES (?, ?, ?, ?, ?)",
+		targetID, reporterID, reason, ReportOpen, time.Now().UTC())
+	return err
+}
+
+func (s *SQLStore) GetOpenReports() ([]Report, error) {
+	query := `
+		SELECT r.report_ID, reporter.username, COALESCE(r.post_ID, 0), COALESCE(r.comment_ID, 0),
+			COALESCE(p.post_ID, com.post_ID), author.username, COALESCE(p.title, com.content),
+			r.reason, r.status, r.created_at
+		FROM reports AS r
+		INNER JOIN users AS reporter ON r.reporter_ID = reporter.user_ID
+		LEFT JOIN posts AS p ON r.post_ID = p.post_ID
+		LEFT JOIN comments AS com ON r.comment_ID = com.comment_ID
+		INNER JOIN users AS author ON author.user_ID = COALESCE(p.user_ID, com.user_ID)
+		WHERE r.status = ?
+		ORDER BY r.report_ID
+	`
+	rows, err := s.Query(query, ReportOpen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []Report
+	for rows.Next() {
+		var report Report
+		var postID, commentID int
+		err := rows.Scan(&report.ReportID, &report.Reporter, &postID, &commentID, &report.PostID, &report.Author,
+			&report.Excerpt, &report.Reason, &report.Status, &report.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		report.TargetType, report.TargetID = TargetPost, postID
+		if commentID != 0 {
+			report.TargetType, report.TargetID = TargetComment, commentID
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+func (s *SQLStore) ResolveReport(reportID, moderatorID int, decision, note string) error {
+	switch decision {
+	case DecisionHide, DecisionWarn, DecisionDismiss:
+	default:
+		return errors.New("invalid decision " + decision)
+	}
+
+	tx, c, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT COALESCE(r.post_ID, 0), COALESCE(r.comment_ID, 0), COALESCE(p.post_ID, com.post_ID),
+			COALESCE(p.user_ID, com.user_ID), r.reason
+		FROM reports AS r
+		LEFT JOIN posts AS p ON r.post_ID = p.post_ID
+		LEFT JOIN comments AS com ON r.comment_ID = com.comment_ID
+		WHERE r.report_ID = ? AND r.status = ?
+	`
+	var postID, commentID, threadPostID, authorID int
+	var reason string
+	err = c.QueryRow(query, reportID, ReportOpen).Scan(&postID, &commentID, &threadPostID, &authorID, &reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	targetType, targetID := TargetPost, postID
+	if commentID != 0 {
+		targetType, targetID = TargetComment, commentID
+	}
+	targetColumn, _ := targetColumn(targetType)
+	now := time.Now().UTC()
+
+	switch decision {
+	case DecisionHide:
+		_, err = c.Exec("UPDATE "+targetTable(targetType)+" SET hidden_at = ? WHERE "+targetColumn+" = ?", now, targetID)
+	case DecisionWarn:
+		_, err = c.Exec("INSERT INTO warnings (user_ID, moderator_ID, reason, note, created_at) VALUES (?, ?, ?, ?, ?)",
+			authorID, moderatorID, reason, note, now)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Exec("UPDATE reports SET status = ?, resolved_at = ? WHERE "+targetColumn+" = ? AND status = ?",
+		decision, now, targetID, ReportOpen)
+	if err != nil {
+		return err
+	}
+	_, err = c.Exec(`INSERT INTO moderation_actions
+		(moderator_ID, author_ID, target_type, target_ID, post_ID, decision, reason, note, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		moderatorID, authorID, targetType, targetID, threadPostID, decision, reason, note, now)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetModerationLog(limit int) ([]ModerationAction, error) {
+	query := `
+		SELECT a.action_ID, moderator.username, author.username, a.target_type, a.target_ID, a.post_ID,
+			a.decision, a.reason, a.note, a.created_at
+		FROM moderation_actions AS a
+		INNER JOIN users AS moderator ON a.moderator_ID = moderator.user_ID
+		INNER JOIN users AS author ON a.author_ID = author.user_ID
+		ORDER BY a.action_ID DESC
+		LIMIT ?
+	`
+	rows, err := s.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []ModerationAction
+	for rows.Next() {
+		var action ModerationAction
+		err := rows.Scan(&action.ActionID, &action.Moderator, &action.Author, &action.TargetType, &action.TargetID,
+			&action.PostID, &action.Decision, &action.Reason, &action.Note, &action.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	return actions, rows.Err()
+}
+
+func (s *SQLStore) GetWarnings(userID int) ([]Warning, error) {
+	query := `
+		SELECT w.warning_ID, moderator.username, w.reason, w.note, w.created_at
+		FROM warnings AS w
+		INNER JOIN users AS moderator ON w.moderator_ID = moderator.user_ID
+		WHERE w.user_ID = ?
+		ORDER BY w.warning_ID DESC
+	`
+	rows, err := s.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var warnings []Warning
+	for rows.Next() {
+		var warning Warning
+		err := rows.Scan(&warning.WarningID, &warning.Moderator, &warning.Reason, &warning.Note, &warning.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings, rows.Err()
+}
+
+// SEARCH
+func (s *SQLStore) Search(query SearchQuery, limit int) ([]SearchResult, error) {
+	words := searchWords(query.Text)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	// Both post and comment rows join their post as p and their author as u
+	filters := ""
+	var filterArgs []interface{}
+	if query.Author != "" {
+		filters += " AND u.username = ?"
+		filterArgs = append(filterArgs, query.Author)
+	}
+	if query.Category != "" {
+		filters += ` AND p.post_ID IN (
+			SELECT pc.post_ID FROM post_categories AS pc
+			INNER JOIN categories AS c ON pc.category_ID = c.category_ID
+			WHERE c.slug = ?
+		)`
+		filterArgs = append(filterArgs, query.Category)
+	}
+
+	var sqlQuery string
+	var args []interface{}
+	if s.dialect == database.Postgres {
+		// The last word also matches longer words starting with it
+		tsquery := strings.Join(words, " & ") + ":*"
+		options := "StartSel=" + HighlightStart + ", StopSel=" + HighlightEnd + ", MaxWords=30, MinWords=10"
+		sqlQuery = `
+			SELECT 'post', p.post_ID, 0, p.title, u.username, p.created_at,
+				ts_headline('english', p.title || ' ' || p.content, to_tsquery('english', ?), ?),
+				ts_rank(p.search, to_tsquery('english', ?)) AS score
+			FROM posts AS p
+			INNER JOIN users AS u ON p.user_ID = u.user_ID
+			WHERE p.search @@ to_tsquery('english', ?) AND p.hidden_at IS NULL` + filters + `
+			UNION ALL
+			SELECT 'comment', p.post_ID, com.comment_ID, p.title, u.username, com.created_at,
+				ts_headline('english', com.content, to_tsquery('english', ?), ?),
+				ts_rank(com.search, to_tsquery('english', ?)) AS score
+			FROM comments AS com
+			INNER JOIN posts AS p ON com.post_ID = p.post_ID
+			INNER JOIN users AS u ON com.user_ID = u.user_ID
+			WHERE com.search @@ to_tsquery('english', ?)
+				AND com.deleted_at IS NULL AND com.hidden_at IS NULL AND p.hidden_at IS NULL` + filters + `
+			ORDER BY score DESC
+			LIMIT ?
+		`
+		args = append(args, tsquery, options, tsquery, tsquery)
+		args = append(args, filterArgs...)
+		args = append(args, tsquery, options, tsquery, tsquery)
+		args = append(args, filterArgs...)
+	} else {
+		// FTS5 query syntax: every quoted word must match, the last one
+		// also as a prefix
+		match := `"` + strings.Join(words, `" "`) + `"*`
+		// bm25 scores are better the lower they are; titles weigh more
+		sqlQuery = `
+			SELECT 'post', p.post_ID, 0, p.title, u.username, p.created_at,
+				snippet(posts_fts, -1, ?, ?, '…', 16),
+				bm25(posts_fts, 5.0, 1.0) AS score
+			FROM posts_fts
+			INNER JOIN posts AS p ON p.post_ID = posts_fts.rowid
+			INNER JOIN users AS u ON p.user_ID = u.user_ID
+			WHERE posts_fts MATCH ? AND p.hidden_at IS NULL` + filters + `
+			UNION ALL
+			SELECT 'comment', p.post_ID, com.comment_ID, p.title, u.username, com.created_at,
+				snippet(comments_fts, 0, ?, ?, '…', 16),
+				bm25(comments_fts) AS score
+			FROM comments_fts
+			INNER JOIN comments AS com ON com.comment_ID = comments_fts.rowid
+			INNER JOIN posts AS p ON com.post_ID = p.post_ID
+			INNER JOIN users AS u ON com.user_ID = u.user_ID
+			WHERE comments_fts MATCH ?
+				AND com.deleted_at IS NULL AND com.hidden_at IS NULL AND p.hidden_at IS NULL` + filters + `
+			ORDER BY score
+			LIMIT ?
+		`
+		args = append(args, HighlightStart, HighlightEnd, match)
+		args = append(args, filterArgs...)
+		args = append(args, HighlightStart, HighlightEnd, match)
+		args = append(args, filterArgs...)
+	}
+	args = append(args, limit)
+
+	rows, err := s.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		var score float64
+		err := rows.Scan(&result.TargetType, &result.PostID, &result.CommentID, &result.Title, &result.Author,
+			&result.CreatedAt, &result.Snippet, &score)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+func targetColumn(targetType string) (string, error) {
+	switch targetType {
+	case TargetPost:
+		return "post_ID", nil
+	case TargetComment:
+		return "comment_ID", nil
+	}
+	return "", errors.New("invalid target type " + targetType)
+}
+
+// emailColumn names the column of users that holds when an email of the
+// kind was last sent.
+func emailColumn(kind string) (string, error) {
+	switch kind {
+	case EmailVerification:
+		return "verification_sent_at", nil
+	case EmailPasswordReset:
+		return "password_reset_sent_at", nil
+	}
+	return "", errors.New("invalid email kind " + kind)
+}
+
+// targetTable names the table holding a valid target type.
+func targetTable(targetType string) string {
+	if targetType == TargetComment {
+		return "comments"
+	}
+	return "posts"
+}
@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	"database/sql"
+	"errors"
+	"forum/database"
+	"forum/database/migrations"
+	"path/filepath"
+	"testing"
+)
+
+// TestSQLite runs the migration and store checks against a SQLite file
+// opened as the forum opens it. It needs the sqlite_fts5 tag and skips
+// without it.
+func TestSQLite(t *testing.T) {
+	db := openSQLite(t)
+	testMigrations(t, db, database.SQLite)
+}
+
+// TestSQLiteTimestampMigration checks that migration 0021 rewrites the
+// timestamps of older versions in the form the driver writes new ones in,
+// keeping their fraction of a second.
+func TestSQLiteTimestampMigration(t *testing.T) {
+	db := openSQLite(t)
+	migrator, err := migrations.New(db, string(database.SQLite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if last, err := migrator.Down(); err != nil || last.Version != 21 {
+		t.Fatalf("rolled back %04d_%s, %v; the timestamp migration must be the last one here", last.Version, last.Name, err)
+	}
+
+	times := map[string]string{
+		"2024-05-01 10:30:00.123456789+02:00": "2024-05-01 08:30:00.123456789+00:00",
+		"2024-05-01 04:30:00.12345-04:00":     "2024-05-01 08:30:00.12345+00:00",
+		"2024-05-01 10:30:00+02:00":           "2024-05-01 08:30:00+00:00",
+		"2024-05-01 08:30:00":                 "2024-05-01 08:30:00+00:00",
+		"2024-05-01 08:30:00.500 UTC":         "2024-05-01 08:30:00.5+00:00",
+		"2024-05-01 08:30:00.25+00:00":        "2024-05-01 08:30:00.25+00:00",
+		"yesterday":                           "yesterday",
+	}
+	for old := range times {
+		if _, err := db.Exec("INSERT INTO users (username, created_at) VALUES (?, ?)", old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	for old, want := range times {
+		var got string
+		if err := db.QueryRow("SELECT CAST(created_at AS TEXT) FROM users WHERE username = ?", old).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%q was rewritten as %q, want %q", old, got, want)
+		}
+	}
+}
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "sqlite://"+filepath.Join(t.TempDir(), "forum.db"))
+	db, _, err := database.OpenDB()
+	if errors.Is(err, database.ErrNoFTS5) {
+		t.Skip("SQLite was built without FTS5; run the tests with -tags sqlite_fts5")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,537 @@
+// Package store holds the forum's data layer: the models shared by the
+// handlers and templates, the interfaces the handlers depend on, and the
+// implementations behind them.
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// ErrDuplicate is returned when a name that must be unique is taken.
+var ErrDuplicate = errors.New("already exists")
+
+// Reaction targets accepted by SetReaction.
+const (
+	TargetPost    = "post"
+	TargetComment = "comment"
+)
+
+// Kinds of email ClaimEmail throttles.
+const (
+	EmailVerification  = "verification"
+	EmailPasswordReset = "password-reset"
+)
+
+// Reaction types stored in likes.type. They are the first two rows of
+// reaction_types; further types are added there.
+const (
+	Like    = 0
+	Dislike = 1
+)
+
+// ReactionType is one kind of reaction users can give.
+type ReactionType struct {
+	Type      int // the value stored in likes.type
+	Name      string
+	Emoji     string
+	SortOrder int
+	Enabled   bool // disabled types are neither offered nor shown
+}
+
+// ReactionCount is how many reactions of one enabled type a post or comment
+// has.
+type ReactionCount struct {
+	ReactionType
+	Count int
+}
+
+// Reactor is a user who reacted to a post or comment.
+type Reactor struct {
+	Username  string
+	Type      int
+	CreatedAt string
+}
+
+// CATEGORIES
+type Category struct {
+	CategoryID  int
+	Category    string
+	Slug        string // used in URLs, e.g. /?category=travel
+	Description string
+	Color       string // "#rrggbb", or empty for the default
+	SortOrder   int
+	Retired     bool // retired categories keep their posts but take no new ones
+}
+
+// POSTS
+type Post struct {
+	PostID       int
+	Username     string
+	Title        string
+	Content      string
+	Categories   []Category
+	PostCategory string
+	CreatedAt    string
+	UpdatedAt    string // empty unless the post has been edited
+	Hidden       bool   // hidden by a moderator; left out of post lists
+	Likes        int
+	Dislikes     int
+	CommentCount int
+	Reactions    []ReactionCount // one for every enabled reaction type
+}
+
+// Sort orders for lists of posts. Ties are broken by post ID, in the same
+// direction.
+const (
+	SortNewest        = "newest"         // by creation time, newest first
+	SortOldest        = "oldest"         // by creation time, oldest first
+	SortMostLiked     = "most-liked"     // by number of likes
+	SortMostCommented = "most-commented" // by number of comments
+	SortActive        = "active"         // by the latest post, edit or comment
+)
+
+// ListOptions choose the order and the page of a list of posts.
+type ListOptions struct {
+	Sort  string // one of the Sort constants; SortNewest when empty
+	After string // the NextCursor of the previous page, or empty for the first
+	Limit int
+}
+
+// PostPage is one page of a list of posts.
+type PostPage struct {
+	Posts      []Post
+	NextCursor string // empty on the last page
+}
+
+// PostActivity is what a ranking scores a post by. Hidden and deleted
+// comments do not count.
+type PostActivity struct {
+	PostID         int
+	CreatedAt      time.Time
+	Likes          int
+	Dislikes       int
+	Comments       int
+	RecentComments int // comments made since the time asked for
+}
+
+// PostRevision is a version of a post as it was before an edit replaced it.
+type PostRevision struct {
+	RevisionID   int
+	PostID       int
+	Editor       string // who made the edit that replaced this version
+	Title        string
+	Content      string
+	Categories   []Category
+	PostCategory string
+	EditedAt     string
+}
+
+type Comment struct {
+	CommentID  int
+	PostID     int
+	ParentID   int // 0 for a top-level comment
+	Username   string
+	Content    string
+	CreatedAt  string
+	UpdatedAt  string // empty unless the comment has been edited
+	Deleted    bool   // deleted comments keep their place in the thread
+	Hidden     bool   // hidden by a moderator
+	Likes      int
+	Dislikes   int
+	Reactions  []ReactionCount // one for every enabled reaction type
+	Depth      int             // 0 for the root of the returned tree
+	ReplyCount int             // direct replies, whether loaded or not
+	Replies    []Comment
+}
+
+// MoreReplies reports whether the comment has replies that were cut off by
+// the depth limit.
+func (c Comment) MoreReplies() bool {
+	return c.ReplyCount > len(c.Replies)
+}
+
+// Report statuses. A resolved report's status is the decision taken on it.
+const (
+	ReportOpen      = "open"
+	DecisionHide    = "hide"
+	DecisionWarn    = "warn"
+	DecisionDismiss = "dismiss"
+)
+
+// REPORTS
+type Report struct {
+	ReportID   int
+	Reporter   string
+	TargetType string // TargetPost or TargetComment
+	TargetID   int
+	PostID     int    // the post itself, or the post the comment is on
+	Author     string // who wrote the reported post or comment
+	Excerpt    string // the post's title or the comment's content
+	Reason     string
+	Status     string
+	CreatedAt  string
+}
+
+// ModerationAction records a moderator's decision on the reports about one
+// post or comment.
+type ModerationAction struct {
+	ActionID   int
+	Moderator  string
+	Author     string
+	TargetType string
+	TargetID   int
+	PostID     int
+	Decision   string
+	Reason     string // the reason given in the report
+	Note       string // the moderator's own note, if any
+	CreatedAt  string
+}
+
+type Warning struct {
+	WarningID int
+	Moderator string
+	Reason    string
+	Note      string
+	CreatedAt string
+}
+
+// SEARCH
+type SearchQuery struct {
+	Text     string
+	Category string // a category slug, or empty for every category
+	Author   string // a username, or empty for every author
+}
+
+// Snippets mark the matched words with these.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// SearchResult is a post or comment matching a search.
+type SearchResult struct {
+	TargetType string // TargetPost or TargetComment
+	PostID     int
+	CommentID  int    // 0 for posts
+	Title      string // the title of the post, or of the post the comment is on
+	Author     string
+	Snippet    string // an excerpt with the matches between HighlightStart and HighlightEnd
+	CreatedAt  string
+}
+
+// USERS
+type User struct {
+	UserID    int
+	Email     string
+	Username  string
+	Password  []byte // bcrypt hash
+	Role      string // one of the auth package's roles
+	CreatedAt string
+	// EmailVerified is set once the user opened the link emailed to them
+	EmailVerified bool
+	// TwoFactor is set while the user logs in with a code from an
+	// authenticator app too
+	TwoFactor bool
+}
+
+// APIToken is a personal access token. Its value is only shown when it is
+// created; the store keeps a hash of it.
+type APIToken struct {
+	TokenID    int
+	Name       string
+	Scopes     []string // the auth package's scopes
+	CreatedAt  string
+	LastUsedAt string // empty until the token is first used
+}
+
+// Session is a login on one device. The store keeps a hash of its token.
+type Session struct {
+	SessionID  int
+	UserID     int
+	Username   string
+	UserAgent  string // as sent when the user logged in
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+type CategoryStore interface {
+	// GetCategories returns the categories new posts can be filed under,
+	// in their sort order. Retired categories are left out.
+	GetCategories() ([]Category, error)
+	// GetAllCategories is GetCategories with the retired categories.
+	GetAllCategories() ([]Category, error)
+	// GetCategory returns ErrNotFound when there is no such category.
+	GetCategory(categoryID int) (Category, error)
+	// AddCategory returns ErrDuplicate when the name or slug is taken.
+	AddCategory(category Category) (int, error)
+	// UpdateCategory saves the name, slug, description, color and sort
+	// order of a category. It returns ErrNotFound or ErrDuplicate.
+	UpdateCategory(category Category) error
+	// SetCategoryRetired retires a category or brings it back.
+	SetCategoryRetired(categoryID int, retired bool) error
+	// MergeCategory files the posts and revisions of sourceID under
+	// targetID instead and deletes sourceID.
+	MergeCategory(sourceID, targetID int) error
+}
+
+// The lists of posts leave out hidden posts and return ErrInvalidCursor
+// when ListOptions.After was not made for the same sort order.
+type PostStore interface {
+	GetPosts(opts ListOptions) (PostPage, error)
+	// GetPost returns ErrNotFound when there is no post with that ID.
+	GetPost(postID int) (Post, error)
+	// GetPostsByCategory returns the posts filed under the category with
+	// that slug, or every post for "all".
+	GetPostsByCategory(slug string, opts ListOptions) (PostPage, error)
+	GetUserLikedPosts(username string, opts ListOptions) (PostPage, error)
+	GetUserCreatedPosts(username string, opts ListOptions) (PostPage, error)
+	// GetPostsByID returns the visible posts with the given IDs in the
+	// order given, leaving out the ones that are hidden or gone.
+	GetPostsByID(postIDs []int) ([]Post, error)
+	// GetPostActivity returns the activity of every visible post.
+	GetPostActivity(since time.Time) ([]PostActivity, error)
+	// AddPost stores a post under every named category and returns its ID.
+	AddPost(userID int, title, content string, categories []string) (int, error)
+	// UpdatePost saves the current version of the post as a revision
+	// edited by editorID, then replaces it with the new one.
+	UpdatePost(postID, editorID int, title, content string, categories []string) error
+	// DeletePost removes a post together with its comments, reactions,
+	// categories and revisions.
+	DeletePost(postID int) error
+	// GetPostRevisions returns the earlier versions of a post, oldest first.
+	GetPostRevisions(postID int) ([]PostRevision, error)
+}
+
+type CommentStore interface {
+	// GetCommentsForPost returns comments as trees of replies at most
+	// maxDepth levels deep. With rootID 0 the trees are the post's
+	// top-level comments; otherwise the single tree rooted at that comment.
+	GetCommentsForPost(postID, rootID, maxDepth int) ([]Comment, error)
+	// AddComment stores a comment, as a reply when parentID is not 0. It
+	// returns ErrNotFound when the post is missing or hidden, or the parent
+	// is hidden, deleted or not a comment on the same post.
+	AddComment(postID, userID, parentID int, content string) (int, error)
+	// GetComment returns a single comment without its replies, or
+	// ErrNotFound.
+	GetComment(commentID int) (Comment, error)
+	UpdateComment(commentID int, content string) error
+	// DeleteComment blanks a comment but keeps its row, so replies and
+	// reactions pointing at it stay valid.
+	DeleteComment(commentID int) error
+}
+
+type ReportStore interface {
+	// AddReport records a report of a post or comment and returns
+	// ErrNotFound when there is no such target. A second report by the same
+	// user of a target that is still waiting for a decision is ignored.
+	AddReport(reporterID int, targetType string, targetID int, reason string) error
+	// GetOpenReports returns the reports waiting for a decision, oldest first.
+	GetOpenReports() ([]Report, error)
+	// ResolveReport applies a decision to a report and to every other open
+	// report about the same target: DecisionHide hides the target,
+	// DecisionWarn warns its author and DecisionDismiss changes nothing.
+	// The decision is recorded in the moderation log. It returns
+	// ErrNotFound unless the report is open.
+	ResolveReport(reportID, moderatorID int, decision, note string) error
+	// GetModerationLog returns the most recent decisions, newest first.
+	GetModerationLog(limit int) ([]ModerationAction, error)
+	// GetWarnings returns the warnings a user has been given, newest first.
+	GetWarnings(userID int) ([]Warning, error)
+}
+
+type SearchStore interface {
+	// Search returns the visible posts and comments matching every word of
+	// the query text, best matches first. The author filter applies to the
+	// post or comment itself and the category filter to its post.
+	Search(query SearchQuery, limit int) ([]SearchResult, error)
+}
+
+type UserStore interface {
+	// GetUserByUsername returns ErrNotFound when the user does not exist.
+	GetUserByUsername(username string) (User, error)
+	// GetUserByEmail ignores case. It returns ErrNotFound when no user has
+	// the email.
+	GetUserByEmail(email string) (User, error)
+	// UserExists reports whether the email or the username is taken,
+	// ignoring case.
+	UserExists(email, username string) (bool, error)
+	// AddUser stores a user with the member role.
+	AddUser(email, username string, password []byte) (int, error)
+	// SetUserRole returns ErrNotFound when the user does not exist.
+	SetUserRole(username, role string) error
+	// VerifyEmail marks the user's email address verified. It returns
+	// ErrNotFound when the user does not exist.
+	VerifyEmail(userID int) error
+	// ClaimEmail records that an email of the kind, EmailVerification or
+	// EmailPasswordReset, is sent to the user now, and reports whether it
+	// may be: it is not when another of the kind was sent after since.
+	ClaimEmail(userID int, kind string, since time.Time) (bool, error)
+	// ReleaseEmail forgets the email of the kind ClaimEmail recorded, for
+	// one that could not be sent, so the user can ask again at once.
+	ReleaseEmail(userID int, kind string) error
+}
+
+type SessionStore interface {
+	// CreateSession stores a session by the hash of its token and returns
+	// its ID. A user may have any number of sessions.
+	CreateSession(tokenHash string, session Session) (int, error)
+	// GetSession returns ErrNotFound unless the hash belongs to an unexpired
+	// session.
+	GetSession(tokenHash string) (Session, error)
+	// GetUserSessions returns the user's unexpired sessions, the most
+	// recently used first.
+	GetUserSessions(userID int) ([]Session, error)
+	// TouchSession records when a session was last used and moves its
+	// expiry.
+	TouchSession(sessionID int, lastSeenAt, expiresAt time.Time) error
+	// DeleteSession ends the session with the token hash, if there is one.
+	DeleteSession(tokenHash string) error
+	// RevokeSession ends one of the user's sessions. It returns ErrNotFound
+	// unless the user has it.
+	RevokeSession(userID, sessionID int) error
+	DeleteExpiredSessions() error
+}
+
+type PasswordResetStore interface {
+	// AddPasswordReset stores a reset of the user's password by the hash of
+	// its token.
+	AddPasswordReset(userID int, tokenHash string, expiresAt time.Time) error
+	// GetPasswordReset returns the user a reset is for. It returns
+	// ErrNotFound unless the hash belongs to an unused, unexpired reset.
+	GetPasswordReset(tokenHash string) (User, error)
+	// ResetPassword sets the password of the user a reset is for, uses up
+	// the user's resets and ends their sessions. It returns ErrNotFound like
+	// GetPasswordReset.
+	ResetPassword(tokenHash string, password []byte) error
+}
+
+type TwoFactorStore interface {
+	// GetTOTPSecret returns the secret of the user's authenticator app,
+	// whether or not they confirmed it, or "" when they have none.
+	GetTOTPSecret(userID int) (string, error)
+	// SetTOTPSecret stores the secret of an authenticator app the user has
+	// not confirmed yet. It returns ErrNotFound when the user does not exist
+	// or already has two-factor authentication on.
+	SetTOTPSecret(userID int, secret string) error
+	// EnableTOTP turns two-factor authentication on with the stored secret,
+	// records step as that of the last code used and replaces the user's
+	// recovery codes with the hashes. It returns ErrNotFound when the user
+	// has no secret.
+	EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error
+	// DisableTOTP turns two-factor authentication off and deletes the
+	// secret and the recovery codes.
+	DisableTOTP(userID int) error
+	// UseTOTPStep records that a code of the time step was used. It reports
+	// false when a code of that step or a later one was used before, so
+	// each code works once.
+	UseTOTPStep(userID int, step int64) (bool, error)
+	// ReplaceRecoveryCodes replaces the user's recovery codes with the
+	// hashes.
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	// UseRecoveryCode uses up the user's unused code with the hash. It
+	// reports false when there is none.
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	// CountRecoveryCodes returns how many unused recovery codes the user
+	// has left.
+	CountRecoveryCodes(userID int) (int, error)
+
+	// FailSecondFactor counts a wrong code of the user, whichever login or
+	// page it was entered on. The maxFailures-th in a row locks the user's
+	// second factor until lockUntil and starts the count over; it reports
+	// whether it did. It returns ErrNotFound when the user does not exist.
+	FailSecondFactor(userID, maxFailures int, lockUntil time.Time) (bool, error)
+	// GetSecondFactorLock returns when the lock FailSecondFactor set ends,
+	// or the zero time when the user's second factor is not locked.
+	GetSecondFactorLock(userID int) (time.Time, error)
+	// ResetSecondFactorFailures starts the count of wrong codes over.
+	ResetSecondFactorFailures(userID int) error
+
+	// AddLoginChallenge stores a login waiting for the user's second factor
+	// by the hash of its token.
+	AddLoginChallenge(userID int, tokenHash string, expiresAt time.Time) error
+	// GetLoginChallenge returns the user a login waits for. It returns
+	// ErrNotFound unless the hash belongs to an unexpired challenge.
+	GetLoginChallenge(tokenHash string) (int, error)
+	// FailLoginChallenge counts a wrong code, and deletes the challenge once
+	// it had maxAttempts of them. It reports whether the challenge is still
+	// open.
+	FailLoginChallenge(tokenHash string, maxAttempts int) (bool, error)
+	// DeleteLoginChallenge deletes a challenge, and any that have expired.
+	DeleteLoginChallenge(tokenHash string) error
+}
+
+// SettingStore keeps the settings admins change from the forum, by name.
+type SettingStore interface {
+	// GetSetting returns ErrNotFound for a setting that was never set.
+	GetSetting(name string) (string, error)
+	SetSetting(name, value string) error
+}
+
+type TokenStore interface {
+	// AddAPIToken stores a token of the user by the hash of its value and
+	// returns its ID.
+	AddAPIToken(userID int, name, hash string, scopes []string) (int, error)
+	// GetAPITokens returns the user's tokens that have not been revoked,
+	// newest first.
+	GetAPITokens(userID int) ([]APIToken, error)
+	// RevokeAPIToken returns ErrNotFound unless the user has an unrevoked
+	// token with that ID.
+	RevokeAPIToken(userID, tokenID int) error
+	// UseAPIToken returns the owner and the token with that hash and records
+	// that it was used now. It returns ErrNotFound unless the token exists
+	// and has not been revoked.
+	UseAPIToken(hash string) (User, APIToken, error)
+}
+
+type ReactionStore interface {
+	// SetReaction records the user's like or dislike of a post or comment,
+	// replacing any earlier reaction to the same target. Setting the
+	// reaction the user already has removes it. It returns ErrNotFound for
+	// a reaction type that is unknown or disabled, and for a target that is
+	// missing, hidden or deleted or on a hidden post.
+	SetReaction(userID int, targetType string, targetID, reactionType int) error
+	// GetUserReactions returns the user's reactions to those of the posts or
+	// comments the user has reacted to, keyed by their IDs.
+	GetUserReactions(userID int, targetType string, targetIDs []int) (map[int]int, error)
+	// GetReactionCounts returns how many reactions of each enabled type the
+	// posts or comments have, keyed by their IDs.
+	GetReactionCounts(targetType string, targetIDs []int) (map[int][]ReactionCount, error)
+	// GetReactors returns who reacted to a post or comment, grouped by
+	// reaction type in their sort order and oldest first within a type.
+	GetReactors(targetType string, targetID int) ([]Reactor, error)
+	// GetReactionTypes returns every reaction type, enabled or not, in their
+	// sort order.
+	GetReactionTypes() ([]ReactionType, error)
+	// AddReactionType adds an enabled reaction type at the end of the sort
+	// order and returns its type. It returns ErrDuplicate when the name is
+	// taken.
+	AddReactionType(name, emoji string) (int, error)
+	// SetReactionTypeEnabled enables or disables the reaction type with that
+	// name, or returns ErrNotFound.
+	SetReactionTypeEnabled(name string, enabled bool) error
+	// Recount rebuilds the stored like, dislike and comment counts of posts
+	// and comments from the reactions and comments themselves, and returns
+	// how many posts and comments had wrong counts.
+	Recount() (posts, comments int, err error)
+}
+
+// Store is everything the handlers need from the data layer.
+type Store interface {
+	CategoryStore
+	PostStore
+	CommentStore
+	UserStore
+	SessionStore
+	PasswordResetStore
+	TwoFactorStore
+	SettingStore
+	TokenStore
+	ReactionStore
+	ReportStore
+	SearchStore
+}
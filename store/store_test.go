@@ -0,0 +1,675 @@
+package store_test
+
+import (
+	"errors"
+	"forum/store"
+	"testing"
+	"time"
+)
+
+// testStore runs the same checks against any Store; open returns an empty
+// one.
+func testStore(t *testing.T, open func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, st store.Store)
+	}{
+		{"users", testUsers},
+		{"posts", testPosts},
+		{"listing", testListing},
+		{"comments", testComments},
+		{"reactions", testReactions},
+		{"racing reactions", testRacingReactions},
+		{"closed targets", testClosedTargets},
+		{"revisions", testRevisions},
+		{"reports", testReports},
+		{"sessions", testSessions},
+		{"tokens", testTokens},
+		{"search", testSearch},
+		{"settings", testSettings},
+		{"second factor lock", testSecondFactorLock},
+		{"timestamps", testTimestamps},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := open(t)
+			for _, name := range []string{"General", "Help"} {
+				if _, err := st.AddCategory(store.Category{Category: name, Slug: store.Slugify(name)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.test(t, st)
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, func(t *testing.T) store.Store { return store.NewMemory() })
+}
+
+func addUser(t *testing.T, st store.Store, username string) store.User {
+	t.Helper()
+	if _, err := st.AddUser(username+"@example.com", username, []byte("hash")); err != nil {
+		t.Fatal(err)
+	}
+	user, err := st.GetUserByUsername(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func addPost(t *testing.T, st store.Store, user store.User, title string) int {
+	t.Helper()
+	postID, err := st.AddPost(user.UserID, title, "The text of "+title, []string{"General"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return postID
+}
+
+func postIDs(posts []store.Post) []int {
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.PostID
+	}
+	return ids
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testUsers(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	if alice.Email != "alice@example.com" || alice.Role != "member" || alice.EmailVerified {
+		t.Errorf("got %+v, want an unverified member", alice)
+	}
+	if exists, err := st.UserExists("ALICE@example.com", "nobody"); err != nil || !exists {
+		t.Errorf("UserExists by email = %v, %v; want true", exists, err)
+	}
+	if user, err := st.GetUserByEmail("Alice@Example.com"); err != nil || user.UserID != alice.UserID {
+		t.Errorf("GetUserByEmail = %+v, %v", user, err)
+	}
+	if _, err := st.GetUserByUsername("nobody"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("an unknown user: got %v, want ErrNotFound", err)
+	}
+	if err := st.SetUserRole("alice", "moderator"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.VerifyEmail(alice.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := st.GetUserByUsername("alice"); user.Role != "moderator" || !user.EmailVerified {
+		t.Errorf("got %+v, want a verified moderator", user)
+	}
+
+	now := time.Now()
+	if ok, err := st.ClaimEmail(alice.UserID, store.EmailVerification, now.Add(-time.Minute)); err != nil || !ok {
+		t.Errorf("the first claim = %v, %v; want true", ok, err)
+	}
+	if ok, err := st.ClaimEmail(alice.UserID, store.EmailVerification, now.Add(-time.Minute)); err != nil || ok {
+		t.Errorf("a second claim = %v, %v; want false", ok, err)
+	}
+	// Each kind of email has its own slot
+	if ok, err := st.ClaimEmail(alice.UserID, store.EmailPasswordReset, now.Add(-time.Minute)); err != nil || !ok {
+		t.Errorf("the first password reset claim = %v, %v; want true", ok, err)
+	}
+	if ok, err := st.ClaimEmail(alice.UserID, store.EmailPasswordReset, now.Add(-time.Minute)); err != nil || ok {
+		t.Errorf("a second password reset claim = %v, %v; want false", ok, err)
+	}
+	if ok, err := st.ClaimEmail(alice.UserID, store.EmailPasswordReset, now.Add(time.Minute)); err != nil || !ok {
+		t.Errorf("a claim after the interval = %v, %v; want true", ok, err)
+	}
+	// A released claim can be made again, for that kind only
+	if err := st.ReleaseEmail(alice.UserID, store.EmailVerification); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := st.ClaimEmail(alice.UserID, store.EmailVerification, now.Add(-time.Minute)); err != nil || !ok {
+		t.Errorf("a claim after the release = %v, %v; want true", ok, err)
+	}
+	if ok, err := st.ClaimEmail(alice.UserID, store.EmailPasswordReset, now.Add(-time.Minute)); err != nil || ok {
+		t.Errorf("a password reset claim after releasing another kind = %v, %v; want false", ok, err)
+	}
+}
+
+func testPosts(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	postID, err := st.AddPost(alice.UserID, "Hello", "World", []string{"General", "Help"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := st.GetPost(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "Hello" || post.Content != "World" || post.Username != "alice" || len(post.Categories) != 2 {
+		t.Errorf("got %+v", post)
+	}
+	if post.UpdatedAt != "" || post.Hidden || post.CreatedAt == "" {
+		t.Errorf("a new post: got updated %q, hidden %v, created %q", post.UpdatedAt, post.Hidden, post.CreatedAt)
+	}
+	if err := st.DeletePost(postID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetPost(postID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("a deleted post: got %v, want ErrNotFound", err)
+	}
+}
+
+func testListing(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	bob := addUser(t, st, "bob")
+	var ids []int
+	for _, title := range []string{"one", "two", "three", "four", "five"} {
+		ids = append(ids, addPost(t, st, alice, title))
+	}
+	if err := st.SetReaction(bob.UserID, store.TargetPost, ids[1], store.Like); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.AddComment(ids[2], bob.UserID, 0, "A comment"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Paging through the newest posts two at a time gives every post once
+	var got []int
+	opts := store.ListOptions{Sort: store.SortNewest, Limit: 2}
+	for {
+		page, err := st.GetPosts(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, postIDs(page.Posts)...)
+		if page.NextCursor == "" {
+			break
+		}
+		opts.After = page.NextCursor
+	}
+	if want := []int{ids[4], ids[3], ids[2], ids[1], ids[0]}; !equalIDs(got, want) {
+		t.Errorf("newest first: got %v, want %v", got, want)
+	}
+
+	// Timestamps have whole seconds, so the active order is not checked
+	for sort, first := range map[string]int{
+		store.SortOldest:        ids[0],
+		store.SortMostLiked:     ids[1],
+		store.SortMostCommented: ids[2],
+	} {
+		page, err := st.GetPosts(store.ListOptions{Sort: sort, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Posts) != 5 || page.Posts[0].PostID != first {
+			t.Errorf("sorted by %s: got %v, want %d first", sort, postIDs(page.Posts), first)
+		}
+	}
+	if _, err := st.GetPosts(store.ListOptions{Sort: store.SortMostLiked, After: "garbage", Limit: 2}); !errors.Is(err, store.ErrInvalidCursor) {
+		t.Errorf("a bad cursor: got %v, want ErrInvalidCursor", err)
+	}
+
+	if page, err := st.GetUserLikedPosts("bob", store.ListOptions{Limit: 10}); err != nil || !equalIDs(postIDs(page.Posts), []int{ids[1]}) {
+		t.Errorf("bob's liked posts = %v, %v", postIDs(page.Posts), err)
+	}
+	if page, err := st.GetUserCreatedPosts("bob", store.ListOptions{Limit: 10}); err != nil || len(page.Posts) != 0 {
+		t.Errorf("bob's posts = %v, %v", postIDs(page.Posts), err)
+	}
+	if page, err := st.GetPostsByCategory("help", store.ListOptions{Limit: 10}); err != nil || len(page.Posts) != 0 {
+		t.Errorf("the help category = %v, %v", postIDs(page.Posts), err)
+	}
+	if posts, err := st.GetPostsByID([]int{ids[3], ids[0]}); err != nil || !equalIDs(postIDs(posts), []int{ids[3], ids[0]}) {
+		t.Errorf("GetPostsByID = %v, %v", postIDs(posts), err)
+	}
+}
+
+func testComments(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	postID := addPost(t, st, alice, "Post")
+	top, err := st.AddComment(postID, alice.UserID, 0, "Top")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := st.AddComment(postID, alice.UserID, top, "Reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPost := addPost(t, st, alice, "Other")
+	if _, err := st.AddComment(otherPost, alice.UserID, top, "Elsewhere"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("a reply on another post: got %v, want ErrNotFound", err)
+	}
+
+	comments, err := st.GetCommentsForPost(postID, 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 1 || len(comments[0].Replies) != 1 || comments[0].Replies[0].CommentID != reply {
+		t.Fatalf("got %+v, want one comment with one reply", comments)
+	}
+	if err := st.UpdateComment(reply, "Edited"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeleteComment(top); err != nil {
+		t.Fatal(err)
+	}
+	if comment, err := st.GetComment(reply); err != nil || comment.Content != "Edited" || comment.UpdatedAt == "" {
+		t.Errorf("the edited reply = %+v, %v", comment, err)
+	}
+	if comment, err := st.GetComment(top); err != nil || !comment.Deleted {
+		t.Errorf("the deleted comment = %+v, %v", comment, err)
+	}
+	if post, _ := st.GetPost(postID); post.CommentCount != 2 {
+		t.Errorf("the post counts %d comments, want 2", post.CommentCount)
+	}
+}
+
+func testReactions(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	postID := addPost(t, st, alice, "Post")
+	if err := st.SetReaction(alice.UserID, store.TargetPost, postID, store.Like); err != nil {
+		t.Fatal(err)
+	}
+	if post, _ := st.GetPost(postID); post.Likes != 1 || post.Dislikes != 0 {
+		t.Errorf("after a like: %d likes and %d dislikes", post.Likes, post.Dislikes)
+	}
+	if err := st.SetReaction(alice.UserID, store.TargetPost, postID, store.Dislike); err != nil {
+		t.Fatal(err)
+	}
+	if post, _ := st.GetPost(postID); post.Likes != 0 || post.Dislikes != 1 {
+		t.Errorf("after switching to a dislike: %d likes and %d dislikes", post.Likes, post.Dislikes)
+	}
+	reactions, err := st.GetUserReactions(alice.UserID, store.TargetPost, []int{postID})
+	if err != nil || reactions[postID] != store.Dislike {
+		t.Errorf("GetUserReactions = %v, %v", reactions, err)
+	}
+	// The same reaction again takes it back
+	if err := st.SetReaction(alice.UserID, store.TargetPost, postID, store.Dislike); err != nil {
+		t.Fatal(err)
+	}
+	if post, _ := st.GetPost(postID); post.Dislikes != 0 {
+		t.Errorf("after taking the dislike back: %d dislikes", post.Dislikes)
+	}
+	if err := st.SetReaction(alice.UserID, store.TargetPost, postID, 99); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("an unknown reaction type: got %v, want ErrNotFound", err)
+	}
+	if posts, comments, err := st.Recount(); err != nil || posts != 0 || comments != 0 {
+		t.Errorf("Recount = %d, %d, %v; want nothing to fix", posts, comments, err)
+	}
+}
+
+// testRacingReactions sends the same reaction from several requests at once,
+// as a double click does. Each one either adds the reaction or takes it
+// back, and none of them fails.
+func testRacingReactions(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	postID := addPost(t, st, alice, "Post")
+	const requests = 8
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			errs <- st.SetReaction(alice.UserID, store.TargetPost, postID, store.Like)
+		}()
+	}
+	for i := 0; i < requests; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("SetReaction: %v", err)
+		}
+	}
+	// An even number of the same reaction takes it back in the end
+	if post, _ := st.GetPost(postID); post.Likes != 0 {
+		t.Errorf("after %d likes: %d likes", requests, post.Likes)
+	}
+	if posts, comments, err := st.Recount(); err != nil || posts != 0 || comments != 0 {
+		t.Errorf("Recount = %d, %d, %v; want nothing to fix", posts, comments, err)
+	}
+}
+
+func testRevisions(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	bob := addUser(t, st, "bob")
+	postID := addPost(t, st, alice, "First")
+	if err := st.UpdatePost(postID, alice.UserID, "Second", "Text two", []string{"Help"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.UpdatePost(postID, bob.UserID, "Third", "Text three", []string{"General", "Help"}); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := st.GetPostRevisions(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("got %d revisions, want 2", len(revisions))
+	}
+	if r := revisions[0]; r.Title != "First" || r.Editor != "alice" || len(r.Categories) != 1 || r.Categories[0].Category != "General" {
+		t.Errorf("the first revision: %+v", r)
+	}
+	if r := revisions[1]; r.Title != "Second" || r.Editor != "bob" || len(r.Categories) != 1 || r.Categories[0].Category != "Help" {
+		t.Errorf("the second revision: %+v", r)
+	}
+	if post, _ := st.GetPost(postID); post.Title != "Third" || post.UpdatedAt == "" || len(post.Categories) != 2 {
+		t.Errorf("the edited post: %+v", post)
+	}
+}
+
+// testClosedTargets checks that nothing is added to posts and comments
+// readers cannot see.
+func testClosedTargets(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	open := addPost(t, st, alice, "Open")
+	hiddenPost := addPost(t, st, alice, "Hidden")
+	onHiddenPost, err := st.AddComment(hiddenPost, alice.UserID, 0, "On a hidden post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := st.AddComment(open, alice.UserID, 0, "Deleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hiddenComment, err := st.AddComment(open, alice.UserID, 0, "Hidden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeleteComment(deleted); err != nil {
+		t.Fatal(err)
+	}
+	hide(t, st, alice, store.TargetPost, hiddenPost)
+	hide(t, st, alice, store.TargetComment, hiddenComment)
+
+	for _, postID := range []int{9999, hiddenPost} {
+		if _, err := st.AddComment(postID, alice.UserID, 0, "Orphan"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("commenting on post %d: got %v, want ErrNotFound", postID, err)
+		}
+		if err := st.SetReaction(alice.UserID, store.TargetPost, postID, store.Like); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("reacting to post %d: got %v, want ErrNotFound", postID, err)
+		}
+	}
+	for _, commentID := range []int{9999, onHiddenPost, deleted, hiddenComment} {
+		if err := st.SetReaction(alice.UserID, store.TargetComment, commentID, store.Like); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("reacting to comment %d: got %v, want ErrNotFound", commentID, err)
+		}
+	}
+	for _, parentID := range []int{9999, deleted, hiddenComment} {
+		if _, err := st.AddComment(open, alice.UserID, parentID, "A reply"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("replying to comment %d: got %v, want ErrNotFound", parentID, err)
+		}
+	}
+	if comments, err := st.GetCommentsForPost(9999, 0, 5); err != nil || len(comments) != 0 {
+		t.Errorf("post 9999 has comments %+v, %v", comments, err)
+	}
+	if reactions, err := st.GetReactionCounts(store.TargetPost, []int{hiddenPost}); err != nil || total(reactions[hiddenPost]) != 0 {
+		t.Errorf("the hidden post has reactions %+v, %v", reactions, err)
+	}
+}
+
+// hide hides a post or comment as a moderator deciding a report does.
+func hide(t *testing.T, st store.Store, mod store.User, targetType string, targetID int) {
+	t.Helper()
+	if err := st.AddReport(mod.UserID, targetType, targetID, "Hide it"); err != nil {
+		t.Fatal(err)
+	}
+	reports, err := st.GetOpenReports()
+	if err != nil || len(reports) == 0 {
+		t.Fatal("the report was not stored:", err)
+	}
+	if err := st.ResolveReport(reports[len(reports)-1].ReportID, mod.UserID, store.DecisionHide, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func total(counts []store.ReactionCount) int {
+	n := 0
+	for _, count := range counts {
+		n += count.Count
+	}
+	return n
+}
+
+func testReports(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	mod := addUser(t, st, "mod")
+	postID := addPost(t, st, alice, "Spam")
+	if err := st.AddReport(mod.UserID, store.TargetPost, postID, "Spam"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.AddReport(mod.UserID, store.TargetPost, 9999, "Spam"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("reporting a missing post: got %v, want ErrNotFound", err)
+	}
+	reports, err := st.GetOpenReports()
+	if err != nil || len(reports) != 1 || reports[0].Author != "alice" {
+		t.Fatalf("GetOpenReports = %+v, %v", reports, err)
+	}
+	if err := st.ResolveReport(reports[0].ReportID, mod.UserID, store.DecisionHide, "Gone"); err != nil {
+		t.Fatal(err)
+	}
+	if post, _ := st.GetPost(postID); !post.Hidden {
+		t.Error("the post was not hidden")
+	}
+	if page, _ := st.GetPosts(store.ListOptions{Limit: 10}); len(page.Posts) != 0 {
+		t.Errorf("the hidden post is still listed")
+	}
+	if log, err := st.GetModerationLog(10); err != nil || len(log) != 1 || log[0].Decision != store.DecisionHide {
+		t.Errorf("GetModerationLog = %+v, %v", log, err)
+	}
+	if err := st.ResolveReport(reports[0].ReportID, mod.UserID, store.DecisionHide, ""); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("resolving twice: got %v, want ErrNotFound", err)
+	}
+}
+
+func testSessions(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	now := time.Now().Truncate(time.Second)
+	sessionID, err := st.CreateSession("hash", store.Session{UserID: alice.UserID, CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.CreateSession("expired", store.Session{UserID: alice.UserID, CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	session, err := st.GetSession("hash")
+	if err != nil || session.SessionID != sessionID || session.Username != "alice" {
+		t.Errorf("GetSession = %+v, %v", session, err)
+	}
+	if _, err := st.GetSession("expired"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("an expired session: got %v, want ErrNotFound", err)
+	}
+	if err := st.TouchSession(sessionID, now.Add(time.Minute), now.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, err := st.GetUserSessions(alice.UserID); err != nil || len(sessions) != 1 || !sessions[0].ExpiresAt.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("GetUserSessions = %+v, %v", sessions, err)
+	}
+	if err := st.RevokeSession(alice.UserID+1, sessionID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("revoking another's session: got %v, want ErrNotFound", err)
+	}
+	if err := st.RevokeSession(alice.UserID, sessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetSession("hash"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("a revoked session: got %v, want ErrNotFound", err)
+	}
+	if err := st.DeleteExpiredSessions(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testTokens(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	tokenID, err := st.AddAPIToken(alice.UserID, "script", "token hash", []string{"read", "write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, token, err := st.UseAPIToken("token hash")
+	if err != nil || user.UserID != alice.UserID || len(token.Scopes) != 2 {
+		t.Errorf("UseAPIToken = %+v, %+v, %v", user, token, err)
+	}
+	if tokens, err := st.GetAPITokens(alice.UserID); err != nil || len(tokens) != 1 || tokens[0].LastUsedAt == "" {
+		t.Errorf("GetAPITokens = %+v, %v", tokens, err)
+	}
+	if err := st.RevokeAPIToken(alice.UserID, tokenID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := st.UseAPIToken("token hash"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("a revoked token: got %v, want ErrNotFound", err)
+	}
+}
+
+func testSearch(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	postID, err := st.AddPost(alice.UserID, "Growing tomatoes", "They need plenty of sun", []string{"Help"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addPost(t, st, alice, "Unrelated")
+	if _, err := st.AddComment(postID, alice.UserID, 0, "Tomatoes also need water"); err != nil {
+		t.Fatal(err)
+	}
+	results, err := st.Search(store.SearchQuery{Text: "tomato"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %+v, want the post and the comment", results)
+	}
+	for _, result := range results {
+		if result.PostID != postID {
+			t.Errorf("got a result from post %d, want %d", result.PostID, postID)
+		}
+	}
+	if results, err := st.Search(store.SearchQuery{Text: "tomato", Category: "general"}, 10); err != nil || len(results) != 0 {
+		t.Errorf("searching another category = %+v, %v", results, err)
+	}
+}
+
+func testSettings(t *testing.T, st store.Store) {
+	if _, err := st.GetSetting("name"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("an unset setting: got %v, want ErrNotFound", err)
+	}
+	for _, value := range []string{"one", "two"} {
+		if err := st.SetSetting("name", value); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := st.GetSetting("name"); err != nil || got != value {
+			t.Errorf("GetSetting = %q, %v; want %q", got, err, value)
+		}
+	}
+}
+
+func testSecondFactorLock(t *testing.T, st store.Store) {
+	alice := addUser(t, st, "alice")
+	until := time.Now().Add(time.Hour)
+	fail := func() bool {
+		t.Helper()
+		locked, err := st.FailSecondFactor(alice.UserID, 3, until)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return locked
+	}
+	lock := func() time.Time {
+		t.Helper()
+		got, err := st.GetSecondFactorLock(alice.UserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if fail() || fail() {
+		t.Error("locked before the third failure")
+	}
+	if !lock().IsZero() {
+		t.Error("GetSecondFactorLock returned a time before the lock")
+	}
+	if !fail() {
+		t.Error("not locked at the third failure")
+	}
+	if got := lock(); got.Unix() != until.Unix() {
+		t.Errorf("locked until %v, want %v", got, until)
+	}
+
+	// The count starts over with the lock and with a right code.
+	until = time.Now().Add(-time.Minute)
+	if fail() || fail() {
+		t.Error("locked again before three more failures")
+	}
+	if err := st.ResetSecondFactorFailures(alice.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if fail() || fail() {
+		t.Error("the failures before the reset still count")
+	}
+	if !fail() {
+		t.Error("not locked at the third failure after the reset")
+	}
+	if !lock().IsZero() {
+		t.Error("a lock that has ended is still returned")
+	}
+
+	if _, err := st.FailSecondFactor(alice.UserID+100, 3, until); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("an unknown user: got %v, want ErrNotFound", err)
+	}
+}
+
+// testTimestamps checks that posts, edits and comments get their times in
+// UTC, whatever the server's time zone, so that they sort together.
+func testTimestamps(t *testing.T, st store.Store) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+	defer func() { time.Local = local }()
+
+	alice := addUser(t, st, "alice")
+	postID := addPost(t, st, alice, "Times")
+	if err := st.UpdatePost(postID, alice.UserID, "Times, edited", "Edited", []string{"General"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.AddComment(postID, alice.UserID, 0, "A comment"); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, err := st.GetPostsByID([]int{postID})
+	if err != nil || len(posts) != 1 {
+		t.Fatalf("GetPostsByID = %v, %v", posts, err)
+	}
+	revisions, err := st.GetPostRevisions(postID)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("GetPostRevisions = %v, %v", revisions, err)
+	}
+	comments, err := st.GetCommentsForPost(postID, 0, 1)
+	if err != nil || len(comments) != 1 {
+		t.Fatalf("GetCommentsForPost = %v, %v", comments, err)
+	}
+	for what, value := range map[string]string{
+		"post created":    posts[0].CreatedAt,
+		"post updated":    posts[0].UpdatedAt,
+		"revision":        revisions[0].EditedAt,
+		"comment created": comments[0].CreatedAt,
+	} {
+		got, err := parseTime(value)
+		if err != nil {
+			t.Errorf("%s at %q: %v", what, value, err)
+			continue
+		}
+		if _, offset := got.Zone(); offset != 0 {
+			t.Errorf("%s at %q, want UTC", what, value)
+		}
+		if d := time.Since(got); d < -time.Minute || d > time.Minute {
+			t.Errorf("%s at %q, %v from now", what, value, d)
+		}
+	}
+}
+
+// parseTime reads the timestamps the stores return.
+func parseTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		t, err = time.Parse("2006-01-02 15:04:05.999999999-07:00", value)
+	}
+	return t, err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestTokenScopesLimitVisibility(t *testing.T) {
+	f := newTestForum(t)
+	mod := f.addUser(t, "mod", "moderator")
+	hidden := f.addPost(t, mod, true)
+	readOnly := f.addToken(t, mod, "read")
+	moderate := f.addToken(t, mod, "read", "moderate")
+	// Without the read scope a token reads nothing, not even as a guest
+	moderateOnly := f.addToken(t, mod, "moderate")
+	writeOnly := f.addToken(t, mod, "write")
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"anonymous", "", http.StatusNotFound},
+		{"read-only token", readOnly, http.StatusNotFound},
+		{"moderate token", moderate, http.StatusOK},
+		{"moderate-only token", moderateOnly, http.StatusForbidden},
+		{"write-only token", writeOnly, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := f.client(t)
+			for _, path := range []string{fmt.Sprintf("/api/v1/posts/%d", hidden), fmt.Sprintf("/post/%d", hidden)} {
+				req, err := http.NewRequest(http.MethodGet, f.URL+path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.token != "" {
+					req.Header = withToken(tt.token)
+				}
+				if res, _ := c.do(req); res.StatusCode != tt.want {
+					t.Errorf("GET %s: got %d, want %d", path, res.StatusCode, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenScopesLimitModeration(t *testing.T) {
+	f := newTestForum(t)
+	mod := f.addUser(t, "mod", "moderator")
+	member := f.addUser(t, "member", "member")
+	author := f.addUser(t, "author", "member")
+	write := f.addToken(t, mod, "write")
+	moderate := f.addToken(t, mod, "moderate")
+	memberModerate := f.addToken(t, member, "moderate")
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"write token", write, http.StatusForbidden},
+		{"member's moderate token", memberModerate, http.StatusForbidden},
+		{"moderate token", moderate, http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			postID := f.addPost(t, author, false)
+			c := f.client(t)
+			res := c.postWith(fmt.Sprintf("/post/%d/delete", postID), url.Values{}, withToken(tt.token))
+			if res.StatusCode != tt.want {
+				t.Errorf("deleting another's post: got %d, want %d", res.StatusCode, tt.want)
+			}
+		})
+	}
+
+	// Reading the queue takes the read and moderate scopes
+	readModerate := f.addToken(t, mod, "read", "moderate")
+	readWrite := f.addToken(t, mod, "read", "write")
+	for token, want := range map[string]int{
+		readWrite:    http.StatusForbidden,
+		moderate:     http.StatusForbidden,
+		readModerate: http.StatusOK,
+	} {
+		req, err := http.NewRequest(http.MethodGet, f.URL+"/moderation", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = withToken(token)
+		if res, _ := f.client(t).do(req); res.StatusCode != want {
+			t.Errorf("GET /moderation: got %d, want %d", res.StatusCode, want)
+		}
+	}
+}
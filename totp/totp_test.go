@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the test vectors in RFC 6238, Appendix B.
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestCodeRFC6238 checks Code against the SHA-1 vectors of RFC 6238. They
+// are eight digits long; a six-digit code is their last six.
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.want[len(tt.want)-Digits:]; got != want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestCodeTakesLowercaseSecrets(t *testing.T) {
+	upper, err := Code(rfcSecret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lower, err := Code(strings.ToLower(rfcSecret), 1); err != nil || lower != upper {
+		t.Errorf("Code of the lowercase secret = %s, %v; want %s", lower, err, upper)
+	}
+	if _, err := Code("not base32!", 1); err != ErrInvalidSecret {
+		t.Errorf("Code of a bad secret: got %v, want ErrInvalidSecret", err)
+	}
+}
+
+// TestValidateSkew checks that Validate accepts the codes of exactly Skew
+// steps either side of now.
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	for offset := int64(-Skew - 1); offset <= Skew+1; offset++ {
+		step := Step(now) + offset
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := Validate(rfcSecret, code, now)
+		if want := offset >= -Skew && offset <= Skew; ok != want {
+			t.Errorf("the code %d steps off: ok = %v, want %v", offset, ok, want)
+		} else if ok && got != step {
+			t.Errorf("the code %d steps off: step %d, want %d", offset, got, step)
+		}
+	}
+	// Spaces are ignored, and codes of another length refused
+	code, _ := Code(rfcSecret, Step(now))
+	if _, ok := Validate(rfcSecret, code[:3]+" "+code[3:], now); !ok {
+		t.Error("a code with a space was refused")
+	}
+	if _, ok := Validate(rfcSecret, code[:5], now); ok {
+		t.Error("a five-digit code was accepted")
+	}
+}
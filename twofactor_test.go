@@ -0,0 +1,137 @@
+package main
+
+import (
+	"forum/helpers"
+	"forum/store"
+	"forum/totp"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// enableTwoFactor turns two-factor authentication on for the user and
+// returns the secret of their app.
+func (f *testForum) enableTwoFactor(t *testing.T, user store.User) string {
+	t.Helper()
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.st.SetTOTPSecret(user.UserID, secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.st.EnableTOTP(user.UserID, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// startLogin sends the user's password, which asks for their code.
+func (c *testClient) startLogin(username string) {
+	c.t.Helper()
+	res := c.post("/login", url.Values{"username": {username}, "password": {testPassword}, helpers.CSRFField: {c.csrfToken()}})
+	if res.StatusCode != http.StatusOK {
+		c.t.Fatalf("logging in as %s: got %d, want the page asking for the code", username, res.StatusCode)
+	}
+}
+
+// enterCode sends a code for the login startLogin began.
+func (c *testClient) enterCode(code string) (*http.Response, string) {
+	c.t.Helper()
+	return c.submit("/login/2fa", url.Values{"code": {code}})
+}
+
+func currentCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestSecondFactorLockoutSpansLogins(t *testing.T) {
+	f := newTestForum(t)
+	alice := f.addUser(t, "alice", "member")
+	secret := f.enableTwoFactor(t, alice)
+	c := f.client(t)
+
+	// Each login allows MaxLoginAttempts codes, but starting another does
+	// not earn more: the failures add up until the second factor locks.
+	failures := 0
+	for failures < helpers.MaxSecondFactorFailures {
+		c.startLogin("alice")
+		for i := 0; i < helpers.MaxLoginAttempts && failures < helpers.MaxSecondFactorFailures; i++ {
+			_, body := c.enterCode("wrong-code")
+			failures++
+			locked := strings.Contains(body, "Too many wrong codes")
+			if locked != (failures == helpers.MaxSecondFactorFailures) {
+				t.Fatalf("after %d wrong codes the page says locked = %v", failures, locked)
+			}
+		}
+	}
+
+	// While locked, even the right code does not log in.
+	c.startLogin("alice")
+	res, body := c.enterCode(currentCode(t, secret))
+	if res.StatusCode == http.StatusSeeOther || !strings.Contains(body, "Too many wrong codes") {
+		t.Errorf("the right code while locked: got %d, want the page saying it is locked", res.StatusCode)
+	}
+	if until, err := f.st.GetSecondFactorLock(alice.UserID); err != nil || until.Before(time.Now().Add(helpers.SecondFactorLockout-time.Minute)) {
+		t.Errorf("the lock ends at %v, %v; want in about %v", until, err, helpers.SecondFactorLockout)
+	}
+}
+
+func TestRightCodeStartsTheCountOver(t *testing.T) {
+	f := newTestForum(t)
+	alice := f.addUser(t, "alice", "member")
+	secret := f.enableTwoFactor(t, alice)
+	c := f.client(t)
+
+	c.startLogin("alice")
+	for i := 0; i < helpers.MaxLoginAttempts-1; i++ {
+		c.enterCode("wrong-code")
+	}
+	if res, _ := c.enterCode(currentCode(t, secret)); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("the right code: got %d, want 303", res.StatusCode)
+	}
+	// A full count of failures more is needed to lock
+	for i := 0; i < helpers.MaxSecondFactorFailures-1; i++ {
+		if locked, err := f.st.FailSecondFactor(alice.UserID, helpers.MaxSecondFactorFailures, time.Now().Add(time.Hour)); err != nil || locked {
+			t.Fatalf("failure %d locked = %v, %v", i+1, locked, err)
+		}
+	}
+}
+
+// TestRequireTwoFactorIsPerForum checks that the setting lives with the
+// server it was changed on rather than in the package.
+func TestRequireTwoFactorIsPerForum(t *testing.T) {
+	required, other := newTestForum(t), newTestForum(t)
+	for _, f := range []*testForum{required, other} {
+		f.addUser(t, "mod", "moderator")
+	}
+	admin := required.addUser(t, "admin", "admin")
+	secret := required.enableTwoFactor(t, admin)
+
+	c := required.client(t)
+	c.startLogin("admin")
+	if res, _ := c.enterCode(currentCode(t, secret)); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("logging in as admin: got %d, want 303", res.StatusCode)
+	}
+	res := c.post("/admin/security", url.Values{"require_2fa": {"on"}, helpers.CSRFField: {c.csrfToken()}})
+	if res.StatusCode != http.StatusSeeOther || !required.settings.RequireTwoFactor() {
+		t.Fatalf("requiring two-factor authentication: got %d", res.StatusCode)
+	}
+
+	if res, _ := required.login(t, "mod").get("/moderation"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("a moderator without two-factor authentication where it is required: got %d, want 403", res.StatusCode)
+	}
+	if res, _ := other.login(t, "mod").get("/moderation"); res.StatusCode != http.StatusOK {
+		t.Errorf("a moderator on another forum: got %d, want 200", res.StatusCode)
+	}
+	if other.settings.RequireTwoFactor() {
+		t.Error("the other forum requires two-factor authentication too")
+	}
+}
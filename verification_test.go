@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"forum/helpers"
+	"forum/mail"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestResendVerification checks that visitors asking for another link get
+// the same answer whether or not the email has an account and whether or
+// not the email could be sent, and that a failed email does not count
+// towards the interval between links.
+func TestResendVerification(t *testing.T) {
+	f := newTestForum(t)
+	if _, err := f.st.AddUser("alice@example.com", "alice", []byte("hash")); err != nil {
+		t.Fatal(err)
+	}
+	c := f.client(t)
+	resend := func(email string) (int, string) {
+		t.Helper()
+		res, body := c.submit("/verify-email/resend", url.Values{"email": {email}})
+		return res.StatusCode, body
+	}
+
+	f.mailer.setDown(true)
+	status, body := resend("alice@example.com")
+	unknownStatus, unknownBody := resend("nobody@example.com")
+	if status != http.StatusOK || unknownStatus != status || unknownBody != body {
+		t.Errorf("answered %d for an account the mailer failed to reach and %d for no account, or with different pages",
+			status, unknownStatus)
+	}
+	if !strings.Contains(body, "we have sent it a new link") {
+		t.Errorf("the page does not say the link is on its way:\n%s", body)
+	}
+	f.mailer.waitFailed(t, 1)
+
+	f.mailer.setDown(false)
+	if status, _ := resend("alice@example.com"); status != http.StatusOK {
+		t.Errorf("asking again answered %d", status)
+	}
+	if sent := f.mailer.wait(t, 1); sent[0].To != "alice@example.com" || !strings.Contains(sent[0].Body, "/verify-email?") {
+		t.Errorf("sent %+v, want a verification link to alice", sent[0])
+	}
+}
+
+// TestResendVerificationLoggedIn checks that a logged-in user hears when
+// their link could not be sent, and can ask again straight away.
+func TestResendVerificationLoggedIn(t *testing.T) {
+	f := newTestForum(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unverified, which the read-only policy lets log in
+	if _, err := f.st.AddUser("bob@example.com", "bob", hash); err != nil {
+		t.Fatal(err)
+	}
+	c := f.login(t, "bob")
+
+	f.mailer.setDown(true)
+	if res, _ := c.submit("/verify-email/resend", url.Values{}); res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("with the mailer down: got %d, want 500", res.StatusCode)
+	}
+	f.mailer.setDown(false)
+	res, body := c.submit("/verify-email/resend", url.Values{})
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "We have sent a new link to bob@example.com") {
+		t.Errorf("asking again: got %d\n%s", res.StatusCode, body)
+	}
+}
+
+func TestParseVerificationPolicy(t *testing.T) {
+	smtp := &mail.SMTP{Addr: "localhost:25"}
+	tests := []struct {
+		setting string
+		mailer  mail.Mailer
+		want    helpers.VerificationPolicy
+		err     error
+	}{
+		{"", smtp, helpers.VerifyReadOnly, nil},
+		{"required", smtp, helpers.VerifyRequired, nil},
+		{"optional", smtp, helpers.VerifyOptional, nil},
+		// Links in the log cannot be followed, so nobody could verify
+		{"", mail.Log{}, helpers.VerifyOptional, nil},
+		{"optional", mail.Log{}, helpers.VerifyOptional, nil},
+		{"read-only", mail.Log{}, "", helpers.ErrVerificationWithoutMail},
+		{"required", mail.Log{}, "", helpers.ErrVerificationWithoutMail},
+		{"sometimes", smtp, "", helpers.ErrInvalidVerificationPolicy},
+	}
+	for _, tt := range tests {
+		got, err := helpers.ParseVerificationPolicy(tt.setting, tt.mailer)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("ParseVerificationPolicy(%q, %T) = %q, %v; want %q, %v", tt.setting, tt.mailer, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+// TestVerificationPolicyIsPerForum checks that the policy comes with the
+// forum's settings rather than from the package.
+func TestVerificationPolicyIsPerForum(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		policy helpers.VerificationPolicy
+		want   int
+	}{
+		{helpers.VerifyRequired, http.StatusOK}, // the page asking to verify
+		{helpers.VerifyOptional, http.StatusSeeOther},
+	} {
+		f := newTestForumWith(t, tt.policy)
+		if _, err := f.st.AddUser("carol@example.com", "carol", hash); err != nil {
+			t.Fatal(err)
+		}
+		c := f.client(t)
+		res := c.post("/login", url.Values{"username": {"carol"}, "password": {testPassword}, helpers.CSRFField: {c.csrfToken()}})
+		if res.StatusCode != tt.want {
+			t.Errorf("logging in unverified where verification is %s: got %d, want %d", tt.policy, res.StatusCode, tt.want)
+		}
+	}
+}